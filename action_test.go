@@ -0,0 +1,60 @@
+package charlie
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestActions(t *testing.T) {
+	p := New([]byte("yay"))
+
+	token := p.GenerateFor("woo", "delete-account")
+	if err := p.ValidateFor("woo", "delete-account", token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ValidateFor("woo", "transfer-funds", token); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+
+	if err := p.ValidateFor("woo", "delete-account", p.Generate("woo")); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+
+	// Unscoped tokens are the same as those with an empty action
+	if err := p.ValidateFor("woo", "", p.Generate("woo")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestActionsFormats(t *testing.T) {
+	for _, f := range []Format{FormatJWT, FormatPASETOLocal, FormatBranca, FormatCOSE, FormatCharlieV3} {
+		p := New([]byte("yay"))
+		p.Format = f
+
+		token := p.GenerateFor("woo", "delete-account")
+		if err := p.ValidateFor("woo", "delete-account", token); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+
+		if err := p.ValidateFor("woo", "transfer-funds", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: error was %v, but expected ErrInvalidToken", f, err)
+		}
+	}
+}
+
+func TestActionsMisconfigured(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.Hash = HashBLAKE2b256 + 1
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected GenerateFor to panic")
+		}
+	}()
+	p.GenerateFor("woo", "delete-account")
+}
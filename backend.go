@@ -0,0 +1,76 @@
+package charlie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+)
+
+var (
+	// ErrBackendUnavailable is returned when a token can't be validated
+	// because an external backend, such as a replay store, failed and the
+	// BackendPolicy is FailClosed.
+	ErrBackendUnavailable = errors.New("backend unavailable")
+)
+
+// A BackendPolicy determines what happens when an external backend, such as a
+// replay store, a remote keyring, or a revocation list, fails while a token is
+// being validated.
+type BackendPolicy int
+
+const (
+	// FailClosed rejects the token with ErrBackendUnavailable. It is the
+	// default.
+	FailClosed BackendPolicy = iota
+
+	// FailOpen skips the backend's check, logging its error to the Params'
+	// Logger. If the backend was needed to check the token at all (e.g. to
+	// fetch the key it was signed with), the token is accepted unchecked.
+	FailOpen
+
+	// Degrade validates the token using only local state, without logging.
+	// Checks which can be performed locally still are: while the ReplayStore
+	// is failing, tokens are recorded in memory instead, so replays to the
+	// same process are still rejected. Those which can't (e.g. the Revoker's)
+	// are skipped.
+	Degrade
+)
+
+func (bp BackendPolicy) String() string {
+	switch bp {
+	case FailClosed:
+		return "fail-closed"
+	case FailOpen:
+		return "fail-open"
+	case Degrade:
+		return "degrade"
+	}
+	return "unknown"
+}
+
+// backendFailed applies the BackendPolicy to an error returned by the named
+// backend, returning nil if validation should proceed without it. Errors from
+// ctx itself are always returned as-is.
+func (p *Params) backendFailed(ctx context.Context, backend string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	switch p.BackendPolicy {
+	case FailOpen:
+		if p.Logger != nil {
+			p.Logger.LogAttrs(ctx, slog.LevelWarn, "Skipping a check despite a backend failure",
+				slog.String("event", "csrf_backend_fail_open"),
+				slog.String("backend", backend),
+				slog.String("error", err.Error()))
+			return nil
+		}
+		log.Printf("Skipping a check despite %s failure: %v (event=csrf_backend_fail_open)", backend, err)
+		return nil
+	case Degrade:
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %v", ErrBackendUnavailable, backend, err)
+}
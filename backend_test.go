@@ -0,0 +1,78 @@
+package charlie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+var errTestBackend = errors.New("connection refused")
+
+func TestBackendFailClosed(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+
+	err := p.backendFailed(context.Background(), "replay store", errTestBackend)
+	if !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("Error was %v, but expected ErrBackendUnavailable", err)
+	}
+
+	if v, want := err.Error(), "backend unavailable: replay store: connection refused"; v != want {
+		t.Errorf("Error was %q, but expected %q", v, want)
+	}
+}
+
+func TestBackendFailOpen(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	p := New([]byte("ayellowsubmarine"))
+	p.BackendPolicy = FailOpen
+
+	if err := p.backendFailed(context.Background(), "replay store", errTestBackend); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "event=csrf_backend_fail_open") {
+		t.Errorf("Expected a log entry, but got %q", buf.String())
+	}
+
+	// With a Logger, the log package isn't used.
+	buf.Reset()
+	logs := new(bytes.Buffer)
+	p.Logger = slog.New(slog.NewJSONHandler(logs, nil))
+	if err := p.backendFailed(context.Background(), "replay store", errTestBackend); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 || !strings.Contains(logs.String(), `"event":"csrf_backend_fail_open"`) ||
+		!strings.Contains(logs.String(), `"backend":"replay store"`) {
+		t.Errorf("Expected a log entry with the Logger, but got %q and %q", logs.String(), buf.String())
+	}
+}
+
+func TestBackendDegrade(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.BackendPolicy = Degrade
+
+	if err := p.backendFailed(context.Background(), "replay store", errTestBackend); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackendContextDone(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.BackendPolicy = FailOpen
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := p.backendFailed(ctx, "replay store", errTestBackend); err != context.Canceled {
+		t.Fatalf("Error was %v, but expected context.Canceled", err)
+	}
+}
@@ -0,0 +1,20 @@
+package charlie
+
+import "time"
+
+// GenerateBatch returns n tokens for the given user, for clients which need to
+// make requests while offline. The first token is issued now, and each
+// following token is dated interval later than the one before it, so that the
+// batch remains usable for roughly MaxAge+(n-1)*interval. If n isn't positive,
+// no tokens are returned.
+//
+// Future-dated tokens are only accepted within BatchWindow, which should be at
+// least (n-1)*interval.
+func (p *Params) GenerateBatch(id string, n int, interval time.Duration) []string {
+	now := p.timer()
+	tokens := make([]string, max(n, 0))
+	for i := range tokens {
+		tokens[i] = p.generateAt(id, now.Add(time.Duration(i)*interval))
+	}
+	return tokens
+}
@@ -0,0 +1,59 @@
+package charlie
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGenerateBatch(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	p := New([]byte("yay"))
+	p.timer = func() time.Time { return now }
+	p.BatchWindow = 30 * time.Minute
+
+	tokens := p.GenerateBatch("woo", 4, 10*time.Minute)
+	if len(tokens) != 4 {
+		t.Fatalf("Expected 4 tokens, got %d", len(tokens))
+	}
+
+	for i, token := range tokens {
+		if err := p.Validate("woo", token); err != nil {
+			t.Errorf("Token %d was invalid when issued: %v", i, err)
+		}
+	}
+
+	// Later in the batch, earlier tokens expire but later ones remain valid.
+	now = now.Add(25 * time.Minute)
+	for i, token := range tokens {
+		err := p.Validate("woo", token)
+		if i < 2 && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Token %d was still valid", i)
+		} else if i >= 2 && err != nil {
+			t.Errorf("Token %d was invalid: %v", i, err)
+		}
+	}
+}
+
+func TestBatchWindow(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	p := New([]byte("yay"))
+	p.timer = func() time.Time { return now }
+	p.BatchWindow = 10 * time.Minute
+
+	tokens := p.GenerateBatch("woo", 3, 10*time.Minute)
+	if err := p.Validate("woo", tokens[1]); err != nil {
+		t.Errorf("Token within the window was invalid: %v", err)
+	}
+
+	if err := p.Validate("woo", tokens[2]); !errors.Is(err, ErrInvalidToken) {
+		t.Error("Token beyond the window was valid")
+	}
+}
+
+func TestGenerateBatchNegative(t *testing.T) {
+	p := New([]byte("yay"))
+	if tokens := p.GenerateBatch("woo", -1, time.Minute); len(tokens) != 0 {
+		t.Errorf("Batch was %v, but expected no tokens", tokens)
+	}
+}
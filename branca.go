@@ -0,0 +1,154 @@
+package charlie
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	brancaVersion    = 0xBA
+	brancaHeaderSize = 1 + 4 + chacha20poly1305.NonceSizeX
+
+	base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// maxBrancaIDSize is the longest identity Open accepts tokens for, which
+	// bounds the length of the tokens it decodes.
+	maxBrancaIDSize = 1024
+)
+
+func (p *Params) generateBranca(sk *signingKey, id string, now time.Time) string {
+	header := make([]byte, brancaHeaderSize, brancaHeaderSize+len(id)+chacha20poly1305.Overhead)
+	header[0] = brancaVersion
+	binary.BigEndian.PutUint32(header[1:], uint32(now.Unix()))
+	p.random(header[5:])
+
+	aead, _ := chacha20poly1305.NewX(p.brancaKey(sk, id))
+	return encodeBase62(aead.Seal(header, header[5:], []byte(id), header))
+}
+
+func (p *Params) openBranca(sk *signingKey, id, token string) (Claims, error) {
+	if len(token) > maxBrancaLen(len(id)) {
+		return Claims{}, ErrBadEncoding
+	}
+
+	data, ok := decodeBase62(token)
+	if !ok || len(data) < brancaHeaderSize+chacha20poly1305.Overhead || data[0] != brancaVersion {
+		return Claims{}, ErrBadEncoding
+	}
+
+	header := data[:brancaHeaderSize]
+	aead, _ := chacha20poly1305.NewX(p.brancaKey(sk, id))
+	payload, err := aead.Open(nil, header[5:], data[brancaHeaderSize:], header)
+	if err != nil {
+		return Claims{}, ErrBadMAC
+	}
+
+	if subtle.ConstantTimeCompare(payload, []byte(id)) != 1 {
+		return Claims{}, ErrBadMAC
+	}
+
+	return Claims{
+		IssuedAt: time.Unix(int64(binary.BigEndian.Uint32(header[1:])), 0),
+		Subject:  id,
+		tag:      string(data[len(data)-chacha20poly1305.Overhead:]),
+	}, nil
+}
+
+// Open validates the given FormatBranca token, whose encrypted payload is the
+// identity of the user it was generated for, and returns that identity. Unlike
+// Validate, it needs no ID, so it can protect requests which carry no session.
+// As their keys depend on the user's identity, tokens can't be opened if the
+// Params have a GenerationFunc. Tokens for identities longer than 1024 bytes
+// can't be opened either.
+func (p *Params) Open(token string) (string, error) {
+	if p.Format != FormatBranca || p.GenerationFunc != nil {
+		return "", ErrInvalidToken
+	} else if len(token) > maxBrancaLen(maxBrancaIDSize) {
+		return "", ErrBadEncoding
+	}
+
+	data, ok := decodeBase62(token)
+	if !ok || len(data) < brancaHeaderSize+chacha20poly1305.Overhead || data[0] != brancaVersion {
+		return "", ErrBadEncoding
+	}
+
+	ks := p.keys.load()
+	now := p.timer()
+	for _, sk := range append([]*signingKey{ks.current}, ks.previous...) {
+		if sk != ks.current && sk.retired(now) {
+			continue
+		}
+
+		header := data[:brancaHeaderSize]
+		aead, _ := chacha20poly1305.NewX(p.brancaKey(sk, ""))
+		if payload, err := aead.Open(nil, header[5:], data[brancaHeaderSize:], header); err == nil {
+			id := string(payload)
+			if _, err := p.validate(context.Background(), id, token); err != nil {
+				return "", err
+			}
+			return id, nil
+		}
+	}
+	return "", ErrBadMAC
+}
+
+// brancaKey returns the key of the given user's tokens: the key itself, as the
+// Branca spec has it, if it's 32 bytes long and nothing else is bound to the
+// tokens, and otherwise one derived from it.
+func (p *Params) brancaKey(sk *signingKey, id string) []byte {
+	key, derived := p.boundKey(sk, id)
+	if !derived && len(key) == chacha20poly1305.KeySize {
+		return key
+	}
+	return deriveKey(key, "charlie/branca")
+}
+
+// maxBrancaLen returns the maximum length of a token for an identity of the
+// given size, so that longer ones are rejected before they're decoded, which
+// takes time quadratic in their length.
+func maxBrancaLen(idSize int) int {
+	// Each byte takes log(256)/log(62), about 1.34, digits; leading zero
+	// bytes take one.
+	n := brancaHeaderSize + idSize + chacha20poly1305.Overhead
+	return n*3/2 + 1
+}
+
+func encodeBase62(b []byte) string {
+	var out []byte
+	n := new(big.Int).SetBytes(b)
+	base, mod := big.NewInt(62), new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base62[mod.Int64()])
+	}
+
+	// Leading zero bytes are encoded as leading zero digits.
+	for i := 0; i < len(b) && b[i] == 0; i++ {
+		out = append(out, base62[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func decodeBase62(s string) ([]byte, bool) {
+	n, base := new(big.Int), big.NewInt(62)
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base62, s[i])
+		if d < 0 {
+			return nil, false
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(d)))
+	}
+
+	zeros := len(s) - len(strings.TrimLeft(s, base62[:1]))
+	return append(make([]byte, zeros), n.Bytes()...), true
+}
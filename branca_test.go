@@ -0,0 +1,148 @@
+package charlie
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestBrancaRoundTrip(t *testing.T) {
+	p := formatParams(FormatBranca)
+	token := p.Generate("woo")
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBrancaSpecKey(t *testing.T) {
+	key := []byte("supersecretkeyyoushouldnotcommit")
+	p := New(key)
+	p.Format = FormatBranca
+
+	// A 32-byte key is used as-is, as other Branca implementations use it.
+	data, _ := decodeBase62(p.Generate("woo"))
+	aead, _ := chacha20poly1305.NewX(key)
+	payload, err := aead.Open(nil, data[5:brancaHeaderSize], data[brancaHeaderSize:], data[:brancaHeaderSize])
+	if err != nil || string(payload) != "woo" {
+		t.Fatalf("Token didn't open with the key: %q, %v", payload, err)
+	}
+
+	// Otherwise, it's derived.
+	p.Environment = "staging"
+	data, _ = decodeBase62(p.Generate("woo"))
+	if _, err := aead.Open(nil, data[5:brancaHeaderSize], data[brancaHeaderSize:], data[:brancaHeaderSize]); err == nil {
+		t.Error("Token bound to an environment opened with the key")
+	}
+}
+
+func TestBrancaWrongID(t *testing.T) {
+	p := formatParams(FormatBranca)
+	token := p.Generate("woo")
+
+	if err := p.Validate("yay", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestBrancaExpired(t *testing.T) {
+	p := formatParams(FormatBranca)
+	token := p.Generate("woo")
+
+	p.timer = func() time.Time {
+		return time.Now().Add(20 * time.Minute)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestBrancaBadEncoding(t *testing.T) {
+	p := formatParams(FormatBranca)
+	token := p.Generate("woo")
+
+	if err := p.Validate("woo", token+"_"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestBrancaOversized(t *testing.T) {
+	p := formatParams(FormatBranca)
+	token := strings.Repeat("z", 1<<20)
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrBadEncoding) {
+		t.Errorf("Error was %v, but expected ErrBadEncoding", err)
+	}
+
+	if _, err := p.Open(token); !errors.Is(err, ErrBadEncoding) {
+		t.Errorf("Error was %v, but expected ErrBadEncoding", err)
+	}
+
+	// The bound admits the longest encodings of tokens for identities of
+	// every size.
+	for n := 0; n <= 64; n++ {
+		size := brancaHeaderSize + n + chacha20poly1305.Overhead
+		for _, b := range [][]byte{bytes.Repeat([]byte{0xFF}, size), make([]byte, size)} {
+			if s := encodeBase62(b); len(s) > maxBrancaLen(n) {
+				t.Errorf("%d: encoding of %d bytes was %d long, but the bound was %d", n, size, len(s), maxBrancaLen(n))
+			}
+		}
+	}
+}
+
+func TestBase62RoundTrip(t *testing.T) {
+	for _, b := range [][]byte{
+		{},
+		{0},
+		{0, 0, 1},
+		{0xBA, 0xDC, 0x0F, 0xFE},
+		bytes.Repeat([]byte{0xFF}, 40),
+	} {
+		s := encodeBase62(b)
+		v, ok := decodeBase62(s)
+		if !ok || !bytes.Equal(v, b) {
+			t.Errorf("%x encoded as %q but decoded as %x", b, s, v)
+		}
+	}
+}
+
+func TestBrancaOpen(t *testing.T) {
+	p := formatParams(FormatBranca)
+	p.Environment = "staging"
+
+	id, err := p.Open(p.Generate("woo"))
+	if err != nil || id != "woo" {
+		t.Errorf("Opened %q, %v, but expected %q", id, err, "woo")
+	}
+
+	old := formatParams(FormatBranca)
+	old.Environment = "staging"
+	p.Rotate([]byte("anewkeyforbranca"))
+	if id, err := p.Open(old.Generate("boo")); err != nil || id != "boo" {
+		t.Errorf("Opened %q, %v, but expected %q", id, err, "boo")
+	}
+
+	if _, err := p.Open(formatParams(FormatBranca).Generate("woo")); err != ErrBadMAC {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+
+	if _, err := p.Open("!!!"); err != ErrBadEncoding {
+		t.Errorf("Error was %v, but expected ErrBadEncoding", err)
+	}
+
+	token := p.Generate("woo")
+	p.timer = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := p.Open(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Error was %v, but expected ErrTokenExpired", err)
+	}
+
+	p.GenerationFunc = func(string) uint32 { return 0 }
+	if _, err := p.Open(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,116 @@
+package charlie
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is the error to which the BackendPolicy is applied when a
+	// backend isn't called because its Breaker is open.
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+// A Breaker is a circuit breaker for an external backend, such as a replay
+// store or a remote keyring. After Failures consecutive failures, it opens for
+// Cooldown, during which the backend isn't called and the BackendPolicy
+// applies immediately, so that a degraded backend slows down a few requests
+// instead of all of them. Once Cooldown has passed, a single call is let
+// through to probe the backend: if it succeeds, the Breaker closes; otherwise,
+// it opens again.
+//
+// A Breaker must not be copied after first use.
+type Breaker struct {
+	Failures int           // Failures is the threshold. It defaults to 5.
+	Cooldown time.Duration // Cooldown defaults to 10 seconds.
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// Healthy returns false if the Breaker is open, or probing the backend after
+// being open.
+func (b *Breaker) Healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.openUntil.IsZero()
+}
+
+// allow returns true if the backend may be called.
+func (b *Breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+// record records the outcome of a call to the backend.
+func (b *Breaker) record(now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	threshold := b.Failures
+	if threshold <= 0 {
+		threshold = 5
+	}
+
+	if b.failures >= threshold || !b.openUntil.IsZero() {
+		cooldown := b.Cooldown
+		if cooldown <= 0 {
+			cooldown = 10 * time.Second
+		}
+		b.openUntil = now.Add(cooldown)
+	}
+}
+
+// callBackend calls the named backend through the given Breaker, if any,
+// applying the BackendPolicy to its failures as backendFailed does. Calls cut
+// short by ctx aren't counted as failures.
+func (p *Params) callBackend(ctx context.Context, backend string, b *Breaker, call func(ctx context.Context) error) error {
+	if b == nil {
+		if err := call(ctx); err != nil {
+			return p.backendFailed(ctx, backend, err)
+		}
+		return nil
+	}
+
+	if !b.allow(p.timer()) {
+		return p.backendFailed(ctx, backend, ErrCircuitOpen)
+	}
+
+	err := call(ctx)
+	if err != nil && ctx.Err() != nil {
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+
+	b.record(p.timer(), err)
+	if err != nil {
+		return p.backendFailed(ctx, backend, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package charlie
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	p := New([]byte("ayellowsubmarine"))
+	p.timer = func() time.Time { return now }
+	b := &Breaker{Failures: 2, Cooldown: time.Minute}
+
+	var calls int
+	failing := func(ctx context.Context) error {
+		calls++
+		return errTestBackend
+	}
+	working := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := p.callBackend(context.Background(), "replay store", b, failing); !errors.Is(err, ErrBackendUnavailable) {
+			t.Fatalf("Error was %v, but expected ErrBackendUnavailable", err)
+		}
+	}
+
+	if b.Healthy() {
+		t.Error("Expected the breaker to be open")
+	}
+
+	// While open, the backend isn't called.
+	err := p.callBackend(context.Background(), "replay store", b, working)
+	if !errors.Is(err, ErrBackendUnavailable) || calls != 2 {
+		t.Errorf("Error was %v after %d calls, but expected the breaker to be open", err, calls)
+	}
+
+	// After the cooldown, a failed probe reopens it.
+	now = now.Add(2 * time.Minute)
+	if err := p.callBackend(context.Background(), "replay store", b, failing); err == nil || calls != 3 {
+		t.Errorf("Error was %v after %d calls, but expected a failed probe", err, calls)
+	}
+
+	if err := p.callBackend(context.Background(), "replay store", b, working); err == nil || calls != 3 {
+		t.Errorf("Error was %v after %d calls, but expected the breaker to be open", err, calls)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(2 * time.Minute)
+	if err := p.callBackend(context.Background(), "replay store", b, working); err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.Healthy() {
+		t.Error("Expected the breaker to be closed")
+	}
+}
+
+func TestBreakerPolicy(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.BackendPolicy = Degrade
+	b := &Breaker{Failures: 1}
+
+	failing := func(ctx context.Context) error { return errTestBackend }
+	for i := 0; i < 3; i++ {
+		if err := p.callBackend(context.Background(), "replay store", b, failing); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBreakerContextDone(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	b := &Breaker{Failures: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := p.callBackend(ctx, "replay store", b, func(ctx context.Context) error { return ctx.Err() })
+	if err != context.Canceled {
+		t.Errorf("Error was %v, but expected Canceled", err)
+	}
+
+	if !b.Healthy() {
+		t.Error("Expected a canceled call not to open the breaker")
+	}
+}
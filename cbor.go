@@ -0,0 +1,125 @@
+package charlie
+
+import "encoding/binary"
+
+// CBOR major types.
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+)
+
+// cborAppendHead appends a CBOR data item head with the given major type and
+// argument, using the shortest encoding.
+func cborAppendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xff:
+		return append(b, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+func cborAppendBytes(b, v []byte) []byte {
+	return append(cborAppendHead(b, cborBytes, uint64(len(v))), v...)
+}
+
+func cborAppendText(b []byte, v string) []byte {
+	return append(cborAppendHead(b, cborText, uint64(len(v))), v...)
+}
+
+// cborReader decodes the small subset of CBOR used by tokens. Any malformed or
+// unsupported input sets ok to false, after which all reads fail.
+type cborReader struct {
+	b  []byte
+	ok bool
+}
+
+func newCBORReader(b []byte) *cborReader {
+	return &cborReader{b: b, ok: true}
+}
+
+func (r *cborReader) head() (major byte, n uint64) {
+	if !r.ok || len(r.b) == 0 {
+		r.ok = false
+		return 0, 0
+	}
+
+	major, info := r.b[0]>>5, r.b[0]&0x1f
+	r.b = r.b[1:]
+
+	size := 0
+	switch {
+	case info < 24:
+		return major, uint64(info)
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default: // indefinite lengths and reserved values aren't supported
+		r.ok = false
+		return 0, 0
+	}
+
+	if len(r.b) < size {
+		r.ok = false
+		return 0, 0
+	}
+
+	for _, c := range r.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	r.b = r.b[size:]
+	return major, n
+}
+
+// expect reads a data item head and checks its major type.
+func (r *cborReader) expect(major byte) uint64 {
+	m, n := r.head()
+	if m != major {
+		r.ok = false
+		return 0
+	}
+	return n
+}
+
+func (r *cborReader) bytes(major byte) []byte {
+	n := r.expect(major)
+	if !r.ok || uint64(len(r.b)) < n {
+		r.ok = false
+		return nil
+	}
+
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// skip skips over an unsigned integer, byte string, or text string.
+func (r *cborReader) skip() {
+	m, n := r.head()
+	switch m {
+	case cborUint:
+	case cborBytes, cborText:
+		if uint64(len(r.b)) < n {
+			r.ok = false
+			return
+		}
+		r.b = r.b[n:]
+	default:
+		r.ok = false
+	}
+}
@@ -0,0 +1,48 @@
+package charlie
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCBORHeads(t *testing.T) {
+	for _, v := range []struct {
+		major byte
+		n     uint64
+		want  []byte
+	}{
+		{cborUint, 0, []byte{0x00}},
+		{cborUint, 23, []byte{0x17}},
+		{cborUint, 24, []byte{0x18, 0x18}},
+		{cborUint, 1000, []byte{0x19, 0x03, 0xe8}},
+		{cborUint, 1000000, []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}},
+		{cborUint, 1000000000000, []byte{0x1b, 0x00, 0x00, 0x00, 0xe8, 0xd4, 0xa5, 0x10, 0x00}},
+		{cborTag, 17, []byte{0xd1}},
+		{cborArray, 4, []byte{0x84}},
+	} {
+		b := cborAppendHead(nil, v.major, v.n)
+		if !bytes.Equal(b, v.want) {
+			t.Errorf("Head(%d, %d) was %x, but expected %x", v.major, v.n, b, v.want)
+		}
+
+		r := newCBORReader(b)
+		if m, n := r.head(); !r.ok || m != v.major || n != v.n {
+			t.Errorf("Decoded %x as (%d, %d), but expected (%d, %d)", b, m, n, v.major, v.n)
+		}
+	}
+}
+
+func TestCBORReaderFailures(t *testing.T) {
+	for _, b := range [][]byte{
+		{},
+		{0x18},       // truncated argument
+		{0x5f},       // indefinite-length byte string
+		{0x43, 0x01}, // truncated byte string
+	} {
+		r := newCBORReader(b)
+		r.skip()
+		if r.ok {
+			t.Errorf("Expected %x to fail", b)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package charlie
+
+import (
+	"context"
+	"net/http"
+)
+
+// GenerateChained returns a new token for the given user which is bound to the
+// previous token in a chain. An empty prev starts a new chain. Tokens of every
+// format, including FormatPASETOPublic, are bound to their link. Like
+// Generate, it panics if the Params are misconfigured.
+//
+// Chaining holds no server-side state: the latest link is whatever prev the
+// caller passes to ValidateChained, usually as held by the client (e.g. in a
+// cookie). So it only guarantees that a token bound to one link isn't valid
+// with another. It stops a client which holds its latest link from being
+// tricked into using an older token, but not a client which holds an older
+// link, or none, from presenting tokens bound to it: with an empty prev,
+// ValidateChained accepts any token which isn't bound to a link, such as one
+// which started a chain, however many links have since been added to it.
+// Where replayed tokens must be rejected outright, use a ReplayStore.
+func (p *Params) GenerateChained(id, prev string) string {
+	return p.chained(prev).Generate(id)
+}
+
+// ValidateChained validates the given token for the given user, requiring that
+// it be bound to the given previous token in its chain, or, if prev is empty,
+// that it started a chain. See GenerateChained for what that guarantees.
+func (p *Params) ValidateChained(id, prev, token string) error {
+	_, err := p.chained(prev).validate(context.Background(), id, token)
+	return err
+}
+
+// chained returns a copy of p which binds tokens to the given previous token.
+func (p *Params) chained(prev string) *Params {
+	if prev == "" {
+		return p
+	}
+
+	c := *p
+	c.chain = prev
+	return &c
+}
+
+// chain returns the Params for the request's current link in its chain.
+func (hp *HTTPParams) chain(r *http.Request, csrf *Params) *Params {
+	if hp.ChainCookie == "" {
+		return csrf
+	}
+
+	prev, _ := extract(r, []Extractor{FromCookie(hp.ChainCookie)})
+	return csrf.chained(prev)
+}
+
+// advanceChain records the token the client presented as the latest link in
+// its chain, returning the Params for the next link.
+func (hp *HTTPParams) advanceChain(w http.ResponseWriter, r *http.Request, csrf *Params, token string) *Params {
+	if hp.ChainCookie == "" {
+		return csrf
+	}
+
+	http.SetCookie(w, newCookie(http.Cookie{Name: hp.ChainCookie, HttpOnly: true}, token, r, hp.InsecureCookies))
+	return csrf.chained(token)
+}
@@ -0,0 +1,110 @@
+package charlie
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChainedRoundTrip(t *testing.T) {
+	p := New([]byte("yay"))
+
+	t1 := p.GenerateChained("woo", "")
+	if err := p.ValidateChained("woo", "", t1); err != nil {
+		t.Fatal(err)
+	}
+
+	t2 := p.GenerateChained("woo", t1)
+	if err := p.ValidateChained("woo", t1, t2); err != nil {
+		t.Fatal(err)
+	}
+
+	t3 := p.GenerateChained("woo", t2)
+	if err := p.ValidateChained("woo", t2, t3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the chain has moved on, old tokens fail.
+	for _, token := range []string{t1, t2} {
+		if err := p.ValidateChained("woo", t2, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Replayed token %q was valid", token)
+		}
+	}
+
+	if err := p.Validate("woo", t2); !errors.Is(err, ErrInvalidToken) {
+		t.Error("Chained token was valid outside of its chain")
+	}
+
+	// Without the latest link, the token which started the chain is valid
+	// again; the chain holds no state beyond the link the caller passes.
+	if err := p.ValidateChained("woo", "", t1); err != nil {
+		t.Errorf("Token which started the chain was invalid without a link: %v", err)
+	}
+}
+
+func TestChainedMisconfigured(t *testing.T) {
+	p := New([]byte("yay"))
+	p.MACSize = 64
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected GenerateChained to panic")
+		}
+	}()
+	p.GenerateChained("woo", "prev")
+}
+
+func TestHTTPChain(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		IssueHeader:   "X-Next-Token",
+		ChainCookie:   "csrf-chain",
+	}
+	handler := v.Wrap(noContentHandler)
+
+	send := func(token, chain string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		req.Header.Set(testCSRFHeader, token)
+		if chain != "" {
+			req.AddCookie(&http.Cookie{Name: "csrf-chain", Value: chain})
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	chainOf := func(res *httptest.ResponseRecorder) string {
+		for _, c := range res.Result().Cookies() {
+			if c.Name == "csrf-chain" {
+				return c.Value
+			}
+		}
+		return ""
+	}
+
+	t1 := v.params().Generate(testSessionID)
+	res := send(t1, "")
+	if res.Code != 204 || chainOf(res) != t1 {
+		t.Fatalf("Expected the first token to start a chain, got %d", res.Code)
+	}
+
+	t2 := res.Header().Get("X-Next-Token")
+	res = send(t2, t1)
+	if res.Code != 204 || chainOf(res) != t2 {
+		t.Fatalf("Expected the next token to extend the chain, got %d", res.Code)
+	}
+
+	// Replaying the first token fails once the chain has moved on.
+	if res := send(t1, t2); res.Code != 403 {
+		t.Errorf("Expected a replayed token to be rejected, got %d", res.Code)
+	}
+
+	if res := send(t2, t2); res.Code != 403 {
+		t.Errorf("Expected a replayed token to be rejected, got %d", res.Code)
+	}
+}
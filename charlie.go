@@ -16,78 +16,499 @@
 //
 // Generation and validation each take ~4us on modern hardware, and the tokens
 // themselves are only 28 bytes long.
+//
+// Tokens use Charlie's own compact format by default. For interoperability with
+// systems which only understand standard formats, Params.Format selects an
+// alternative, such as an HS256 JWT, a PASETO v4 token, a Branca token, or a
+// COSE_Mac0 message.
 package charlie
 
 import (
+	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
+	"io"
+	"log/slog"
 	"time"
 )
 
 var (
-	// ErrInvalidToken is returned when the provided token is invalid.
+	// ErrInvalidToken is returned when the provided token is invalid. More
+	// specific errors, such as ErrTokenExpired, are returned where possible as
+	// ValidationErrors; for all of them, errors.Is(err, ErrInvalidToken) is
+	// true. Errors about authentic tokens carry their IssuedAt, so compare
+	// them with errors.Is rather than ==.
 	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrBadEncoding is returned when the provided token is malformed.
+	ErrBadEncoding error = &ValidationError{Reason: ReasonBadEncoding}
+
+	// ErrBadMAC is returned when the provided token fails authentication: it
+	// was forged, tampered with, generated with another key, or generated for
+	// another user.
+	ErrBadMAC error = &ValidationError{Reason: ReasonBadMAC}
+
+	// ErrTokenExpired is returned when the provided token is authentic, but
+	// has expired.
+	ErrTokenExpired error = &ValidationError{Reason: ReasonExpired}
+
+	// ErrMissingToken is the reason a request presenting no token is invalid.
+	ErrMissingToken error = &ValidationError{Reason: ReasonMissingToken}
+
+	// ErrMissingSession is the reason a request without a session is invalid.
+	ErrMissingSession error = &ValidationError{Reason: ReasonMissingSession}
 )
 
 // Params are the parameters used for generating and validating tokens.
 type Params struct {
-	key   []byte
-	timer func() time.Time
+	keys     *keyring
+	timer    func() time.Time
+	chain    string
+	action   string
+	audience string
+	bound    *boundKeyCache
 
 	MaxAge time.Duration // MaxAge is the maximum age of tokens.
+	Format Format        // Format is the wire format of generated tokens.
+
+	// SoftMaxAge, if non-zero, is the age after which tokens are stale. Stale
+	// tokens remain valid until MaxAge, but ValidateStale reports them as
+	// stale, so that they can be replaced before they expire.
+	SoftMaxAge time.Duration
+
+	// MACSize is the length, in bytes, of the MACs of FormatCharlie,
+	// FormatCharlieV2, and FormatCharlieV3 tokens, between 16 and 32. It
+	// defaults to 16; larger MACs make for longer tokens, but are harder
+	// still to forge. Tokens with MACs of another length are invalid, so
+	// changing it invalidates all outstanding tokens. Params with a MACSize
+	// out of range neither generate nor validate tokens.
+	MACSize int
+
+	// Hash is the hash function of the HMAC which authenticates
+	// FormatCharlieV2 and FormatCharlieV3 tokens. FormatCharlie tokens are
+	// always authenticated with HashSHA256, so Params generating them must
+	// use it; other formats fix their own. Tokens generated with other Hashes,
+	// including FormatCharlie tokens, are invalid, unless they're among the
+	// AcceptHashes.
+	Hash Hash
+
+	// AcceptHashes are other Hashes whose tokens are valid, e.g. the previous
+	// Hash while migrating to a new one.
+	AcceptHashes []Hash
+
+	// Codec, if non-nil, replaces the layout of FormatCharlie tokens' claims.
+	Codec TokenCodec
+
+	// BatchWindow, if non-zero, is how far in the future a token may be dated
+	// and still be valid, as with the later tokens of a batch. Tokens dated
+	// further in the future are invalid. If zero, future-dated tokens are
+	// accepted as they always have been.
+	BatchWindow time.Duration
+
+	// MaxClockSkew, if non-zero, is how far in the future a token may be
+	// dated, e.g. by a server whose clock runs fast, and still be valid.
+	// Tokens dated further in the future, whose lifetimes would otherwise be
+	// extended, are invalid. If BatchWindow is larger, it applies instead.
+	MaxClockSkew time.Duration
+
+	// GenerationFunc, if non-nil, returns the user's current generation, which
+	// is mixed into the MAC of their tokens. Bumping a user's generation (e.g.
+	// on logout everywhere) invalidates all of their outstanding tokens without
+	// a revocation list. Tokens generated at generation zero are identical to
+	// those generated without a GenerationFunc. FormatPASETOPublic tokens,
+	// which are verified with PublicKey, aren't bound to a generation.
+	GenerationFunc func(id string) uint32
+
+	// Environment, if non-empty, names the environment (e.g. "production" or
+	// "staging") which the Params belong to, and is mixed into the MAC of their
+	// tokens, so that tokens generated in one environment are never valid in
+	// another, even if both accidentally share a key. FormatPASETOPublic tokens
+	// carry it, with the user's identity, as their implicit assertion.
+	Environment string
+
+	// OnKeyUsed, if non-nil, is called with the ID of the key which validated
+	// each valid token, e.g. to count validations per key. See KeyUsage.
+	OnKeyUsed func(kid string)
+
+	// OnGenerate, if non-nil, is called with how long it took to generate each
+	// token, e.g. to record latency metrics.
+	OnGenerate func(d time.Duration)
+
+	// OnValidate, if non-nil, is called with the context and outcome of each
+	// token's validation, e.g. to count failures by reason.
+	OnValidate func(ctx context.Context, v Validation)
+
+	// IdleKeyTimeout, if non-zero, is how long a previous key (see SetKey)
+	// continues to be accepted without validating any tokens. Idle keys are
+	// dropped before their overlap ends, keeping the set of accepted keys to
+	// those still in use.
+	IdleKeyTimeout time.Duration
+
+	// Rand, if non-nil, is the source of the random nonces of FormatPASETOLocal
+	// and FormatBranca tokens, in place of crypto/rand, e.g. for deterministic
+	// tests or a DRBG backed by an HSM. Generation panics if it fails.
+	Rand io.Reader
+
+	// Revoker, if non-nil, records when each user's tokens were last
+	// revoked. Tokens issued at or before then are rejected with
+	// ErrTokenRevoked. Unlike bumping a user's generation (see
+	// GenerationFunc), revocations don't affect tokens issued afterwards.
+	Revoker Revoker
+
+	// RevokerBreaker, if non-nil, is the circuit breaker for the Revoker.
+	RevokerBreaker *Breaker
+
+	// ReplayStore, if non-nil, records which tokens have been redeemed, so
+	// that each is valid only once: once validated, a token is rejected with
+	// ErrTokenReplayed. Inspect doesn't redeem tokens. Tokens generated for
+	// the same user in the same second are identical in most formats, so it
+	// should be used with a format with random nonces (FormatPASETOLocal or
+	// FormatBranca) or nanosecond timestamps (FormatCharlieV3).
+	ReplayStore ReplayStore
+
+	// ReplayBreaker, if non-nil, is the circuit breaker for the ReplayStore.
+	ReplayBreaker *Breaker
+
+	// BackendPolicy determines how validation proceeds when an external
+	// backend fails.
+	BackendPolicy BackendPolicy
+
+	// Logger, if non-nil, receives the Params' logs, e.g. of backend failures
+	// under FailOpen. Otherwise, they're written with the log package.
+	Logger *slog.Logger
+
+	// degraded records tokens while the ReplayStore is failing, under the
+	// Degrade BackendPolicy.
+	degraded *MemoryReplayStore
+}
+
+// A Validation is the outcome of validating a token, for OnValidate.
+type Validation struct {
+	Duration time.Duration // Duration is how long validation took.
+	IssuedAt time.Time     // IssuedAt is when the token was issued, if it's authentic.
+	Err      error         // Err is the error validation returned, if any.
 }
 
-// New returns a new set of parameters given a key.
-func New(key []byte) *Params {
-	k := make([]byte, len(key))
-	copy(k, key)
+// New returns a new set of parameters given a key. Tokens are generated with
+// the key, and validated with it or any of the given old keys, so that tokens
+// generated before a key rotation remain valid. Old keys should be removed once
+// MaxAge has passed since the rotation; if the key is replaced with SetKey or
+// Rotate, they retire along with it.
+func New(key []byte, old ...[]byte) *Params {
 	return &Params{
-		key:    k,
-		timer:  time.Now,
-		MaxAge: 10 * time.Minute,
+		keys:     newKeyring(key, old, time.Now()),
+		timer:    time.Now,
+		MaxAge:   10 * time.Minute,
+		degraded: NewMemoryReplayStore(),
 	}
 }
 
-// Generate returns a new token for the given user.
+// Generate returns a new token for the given user. It panics if the Params are
+// misconfigured, e.g. with an unknown Hash; GenerateContext returns an error
+// instead.
 func (p *Params) Generate(id string) string {
-	buf := make([]byte, dataSize, dataSize+macSize)
-	binary.BigEndian.PutUint32(buf, uint32(p.timer().Unix()))
-	token := append(buf, hmacSHA256(p.key, buf, id)...)
-	return base64.URLEncoding.EncodeToString(token)
+	token, err := p.generate(context.Background(), id)
+	if err != nil {
+		panic(err.Error())
+	}
+	return token
+}
+
+// GenerateAt returns a new token for the given user, issued at the given time
+// rather than now, e.g. for test fixtures. See WithClock for validating tokens
+// at other times. Like Generate, it panics if the Params are misconfigured.
+func (p *Params) GenerateAt(id string, t time.Time) string {
+	return p.generateAt(id, t)
+}
+
+// GenerateContext returns a new token for the given user. It returns an error
+// only if ctx is done before the token is generated or the Params are
+// misconfigured.
+func (p *Params) GenerateContext(ctx context.Context, id string) (string, error) {
+	return p.generate(ctx, id)
 }
 
 // Validate validates the given token for the given user.
 func (p *Params) Validate(id, token string) error {
+	_, err := p.validate(context.Background(), id, token)
+	return err
+}
+
+// ValidateContext validates the given token for the given user. If ctx is done
+// before the token is validated, it returns ctx's error.
+func (p *Params) ValidateContext(ctx context.Context, id, token string) error {
+	_, err := p.validate(ctx, id, token)
+	return err
+}
+
+// ValidateStale validates the given token for the given user as ValidateContext
+// does, and also returns whether it's stale: valid, but older than SoftMaxAge.
+func (p *Params) ValidateStale(ctx context.Context, id, token string) (stale bool, err error) {
+	return p.validate(ctx, id, token)
+}
+
+// ValidateAndRefresh validates the given token for the given user and, if it's
+// valid, returns a new token to replace it. The user's key, with its
+// generation, is derived once for both, unless the token was generated with
+// an old key.
+func (p *Params) ValidateAndRefresh(id, token string) (string, error) {
+	c := *p
+	c.bound = new(boundKeyCache)
+	if _, err := c.validate(context.Background(), id, token); err != nil {
+		return "", err
+	}
+	return c.generateAt(id, c.timer()), nil
+}
+
+func (p *Params) generate(ctx context.Context, id string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if err := p.check(); err != nil {
+		return "", err
+	}
+
+	return p.generateAt(id, p.timer()), nil
+}
+
+// generateAt returns a new token for the given user, issued at the given time.
+func (p *Params) generateAt(id string, now time.Time) string {
+	if err := p.check(); err != nil {
+		panic(err.Error())
+	}
+
+	if p.OnGenerate != nil {
+		defer func(start time.Time) { p.OnGenerate(time.Since(start)) }(time.Now())
+	}
+
+	sk := p.keys.current()
+	switch p.Format {
+	case FormatJWT:
+		return p.generateJWT(sk, id, now)
+	case FormatPASETOLocal, FormatPASETOPublic:
+		return p.generatePASETO(sk, id, now)
+	case FormatBranca:
+		return p.generateBranca(sk, id, now)
+	case FormatCOSE:
+		return p.generateCOSE(sk, id, now)
+	case FormatCharlieV2:
+		return p.generateCharlieV2(sk, id, now)
+	case FormatCharlieV3:
+		return p.generateCharlieV3(sk, id, now)
+	}
+
+	if p.Codec != nil {
+		return p.generateCodec(sk, id, now)
+	}
+
+	buf := make([]byte, dataSize, dataSize+p.macSize())
+	binary.BigEndian.PutUint32(buf, uint32(now.Unix()))
+	token := append(buf, hmacSHA256(p.keyFor(sk, id), buf, id)[:p.macSize()]...)
+	return base64.URLEncoding.EncodeToString(token)
+}
+
+func (p *Params) validate(ctx context.Context, id, token string) (stale bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var c Claims
+	if p.OnValidate != nil {
+		defer func(start time.Time) {
+			p.OnValidate(ctx, Validation{Duration: time.Since(start), IssuedAt: c.IssuedAt, Err: err})
+		}(time.Now())
+	}
+	defer func() { err = issuedAt(err, c.IssuedAt) }()
+
+	now := p.timer()
+	c, sk, err := p.open(id, token)
+	if err != nil {
+		return false, err
+	}
+
+	if err := p.checkExpiry(c, now); err != nil {
+		return false, err
+	}
+
+	if err := p.checkRevoked(ctx, id, c); err != nil {
+		return false, err
+	}
+
+	if err := p.checkReplay(ctx, c); err != nil {
+		return false, err
+	}
+
+	sk.usage.record(now)
+	if p.OnKeyUsed != nil {
+		p.OnKeyUsed(sk.kid)
+	}
+	return p.stale(c, now), nil
+}
+
+// open authenticates the given token for the given user with each accepted key
+// in turn, returning its claims and the key which authenticated it. It doesn't
+// check whether the token has expired. Only keys whose IDs match the token's,
+// if it carries one in its encoding, are tried.
+func (p *Params) open(id, token string) (Claims, *signingKey, error) {
+	if err := p.check(); err != nil {
+		return Claims{}, nil, err
+	}
+
+	ks := p.keys.load()
+	kid, keyed := p.tokenKeyID(token)
+
+	c, err := Claims{}, ErrUnknownKey
+	if !keyed || ks.current.kidByte == kid {
+		c, err = p.openWith(ks.current, id, token)
+		if err == nil || len(ks.previous) == 0 {
+			return c, ks.current, err
+		}
+	}
+
+	now := p.timer()
+	for _, sk := range ks.previous {
+		if sk.retired(now) || (keyed && sk.kidByte != kid) {
+			continue
+		}
+
+		if p.IdleKeyTimeout > 0 && sk.idle(now, p.IdleKeyTimeout) {
+			p.keys.retireIdle(now, p.IdleKeyTimeout)
+			continue
+		}
+
+		c, e := p.openWith(sk, id, token)
+		if e == nil {
+			return c, sk, nil
+		} else if err == ErrUnknownKey {
+			err = e
+		}
+	}
+	return Claims{}, nil, err
+}
+
+// openWith authenticates the given token for the given user with the given key.
+func (p *Params) openWith(sk *signingKey, id, token string) (Claims, error) {
+	switch p.Format {
+	case FormatJWT:
+		return p.openJWT(sk, id, token)
+	case FormatPASETOLocal, FormatPASETOPublic:
+		return p.openPASETO(sk, id, token)
+	case FormatBranca:
+		return p.openBranca(sk, id, token)
+	case FormatCOSE:
+		return p.openCOSE(sk, id, token)
+	}
+
+	if p.Codec != nil && p.Format == FormatCharlie {
+		return p.openCodec(sk, id, token)
+	}
+
 	data, err := base64.URLEncoding.DecodeString(token)
-	if err != nil || len(data) < dataSize+macSize {
-		return ErrInvalidToken
+	if err == nil && p.isCharlieV2(data) {
+		return p.openCharlieV2(sk, id, data)
+	} else if err == nil && p.isCharlieV3(data) {
+		return p.openCharlieV3(sk, id, data)
+	} else if err != nil {
+		return Claims{}, ErrBadEncoding
+	} else if len(data) != dataSize+p.macSize() {
+		return Claims{}, errWrongLength
 	}
 
-	mac := data[dataSize:][:macSize]
+	if !p.accepts(HashSHA256) {
+		return Claims{}, ErrBadMAC
+	}
+
+	mac := data[dataSize:]
 	data = data[:dataSize]
-	if !hmac.Equal(hmacSHA256(p.key, data, id), mac) {
-		return ErrInvalidToken
+	if !hmac.Equal(hmacSHA256(p.keyFor(sk, id), data, id)[:p.macSize()], mac) {
+		return Claims{}, ErrBadMAC
+	}
+
+	return Claims{
+		IssuedAt: time.Unix(int64(binary.BigEndian.Uint32(data)), 0),
+		Subject:  id,
+		tag:      string(mac),
+	}, nil
+}
+
+// checkExpiry returns ErrTokenExpired if a token with the given claims has
+// expired, either by its own account or by MaxAge, or a ReasonFutureTimestamp
+// error if it was issued further in the future than BatchWindow or
+// MaxClockSkew allows.
+func (p *Params) checkExpiry(c Claims, now time.Time) error {
+	if (!c.Expires.IsZero() && now.After(c.Expires)) || now.Sub(c.IssuedAt) > p.MaxAge {
+		return ErrTokenExpired
+	}
+
+	future := max(p.BatchWindow, p.MaxClockSkew)
+	if future > 0 && c.IssuedAt.Sub(now) > future {
+		return errFutureTimestamp
+	}
+	return nil
+}
+
+// random fills b with random bytes from Rand.
+func (p *Params) random(b []byte) {
+	if p.Rand == nil {
+		_, _ = rand.Read(b)
+		return
+	}
+
+	if _, err := io.ReadFull(p.Rand, b); err != nil {
+		panic("charlie: reading random bytes: " + err.Error())
 	}
+}
+
+// stale returns true if a token with the given claims is older than SoftMaxAge.
+func (p *Params) stale(c Claims, now time.Time) bool {
+	return p.SoftMaxAge > 0 && now.Sub(c.IssuedAt) > p.SoftMaxAge
+}
 
-	t := time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
-	if p.timer().Sub(t) > p.MaxAge {
-		return ErrInvalidToken
+// errUnknownHash, errFormatHash, and errBadMACSize are returned by generation
+// and validation if the Params' Hash or MACSize is invalid.
+var (
+	errUnknownHash = errors.New("charlie: unknown hash")
+	errFormatHash  = errors.New("charlie: FormatCharlie tokens are authenticated with HashSHA256")
+	errBadMACSize  = errors.New("charlie: MAC size must be between 16 and 32 bytes")
+)
+
+// check returns an error if the Params are misconfigured, so that they fail
+// loudly rather than generating or accepting tokens other than those intended.
+func (p *Params) check() error {
+	if !p.Hash.valid() {
+		return errUnknownHash
+	} else if p.Format == FormatCharlie && p.Hash != HashSHA256 {
+		return errFormatHash
 	}
 
+	if p.MACSize != 0 && (p.MACSize < macSize || p.MACSize > maxMACSize) {
+		return errBadMACSize
+	}
 	return nil
 }
 
+// macSize returns the length of MACs: MACSize, if it's set, or the default.
+func (p *Params) macSize() int {
+	if p.MACSize == 0 {
+		return macSize
+	}
+	return p.MACSize
+}
+
 const (
-	dataSize = 4 // 32-bit timestamps
-	macSize  = 16
+	dataSize   = 4  // 32-bit timestamps
+	macSize    = 16 // the default and minimum MACSize
+	maxMACSize = sha256.Size
 )
 
 func hmacSHA256(key, data []byte, id string) []byte {
 	h := hmac.New(sha256.New, key)
 	_, _ = h.Write(data)
 	_, _ = h.Write([]byte(id))
-	return h.Sum(nil)[:macSize]
+	return h.Sum(nil)
 }
@@ -0,0 +1,91 @@
+// charlie.js attaches Charlie CSRF tokens to same-origin fetch and
+// XMLHttpRequest requests with unsafe methods. It's served, configured, by
+// HTTPParams.ScriptHandler.
+(function (config) {
+  "use strict";
+
+  var token = null;
+
+  function meta() {
+    var el = config.meta && document.querySelector('meta[name="' + config.meta + '"]');
+    return el ? el.getAttribute("content") : null;
+  }
+
+  function cookie() {
+    if (!config.cookie) {
+      return null;
+    }
+    var pairs = document.cookie ? document.cookie.split("; ") : [];
+    for (var i = 0; i < pairs.length; i++) {
+      var eq = pairs[i].indexOf("=");
+      if (pairs[i].slice(0, eq) === config.cookie) {
+        return decodeURIComponent(pairs[i].slice(eq + 1));
+      }
+    }
+    return null;
+  }
+
+  // current returns the freshest token available: one issued in a response
+  // header, then one in the cookie, then one in the meta tag.
+  function current() {
+    return token || cookie() || meta();
+  }
+
+  function applies(method, url) {
+    if (/^(GET|HEAD|OPTIONS|TRACE)$/i.test(method || "GET")) {
+      return false;
+    }
+    try {
+      return new URL(url, location.href).origin === location.origin;
+    } catch (e) {
+      return false;
+    }
+  }
+
+  function remember(value) {
+    if (value) {
+      token = value;
+    }
+  }
+
+  if (window.fetch) {
+    var fetch = window.fetch;
+    window.fetch = function (input, init) {
+      var req = new Request(input, init);
+      var t = current();
+      if (t && applies(req.method, req.url) && !req.headers.has(config.header)) {
+        req.headers.set(config.header, t);
+      }
+      return fetch.call(this, req).then(function (resp) {
+        if (config.issueHeader) {
+          remember(resp.headers.get(config.issueHeader));
+        }
+        return resp;
+      });
+    };
+  }
+
+  var open = XMLHttpRequest.prototype.open;
+  var send = XMLHttpRequest.prototype.send;
+
+  XMLHttpRequest.prototype.open = function (method, url) {
+    this._charlie = applies(method, url);
+    return open.apply(this, arguments);
+  };
+
+  XMLHttpRequest.prototype.send = function () {
+    var xhr = this;
+    var t = current();
+    if (xhr._charlie && t) {
+      xhr.setRequestHeader(config.header, t);
+    }
+    if (config.issueHeader) {
+      xhr.addEventListener("load", function () {
+        remember(xhr.getResponseHeader(config.issueHeader));
+      });
+    }
+    return send.apply(this, arguments);
+  };
+
+  window.charlie = { version: config.version, token: current };
+})
@@ -1,8 +1,11 @@
 package charlie
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -32,6 +35,13 @@ func Example() {
 
 var params = New([]byte("ayellowsubmarine"))
 
+// formatParams returns Params which generate tokens in the given format.
+func formatParams(f Format) *Params {
+	p := New([]byte("ayellowsubmarine"))
+	p.Format = f
+	return p
+}
+
 func TestRoundTrip(t *testing.T) {
 	token := params.Generate("woo")
 
@@ -49,7 +59,7 @@ func TestTokenLength(t *testing.T) {
 }
 
 func TestEmptyToken(t *testing.T) {
-	if err := params.Validate("woo", ""); err != ErrInvalidToken {
+	if err := params.Validate("woo", ""); !errors.Is(err, ErrInvalidToken) {
 		t.Errorf("Error was %v, but expected ErrInvalidToken", err)
 	}
 }
@@ -61,9 +71,10 @@ func TestRoundTripConcurrent(t *testing.T) {
 	wgP := new(sync.WaitGroup)
 	wgP.Add(producers)
 
+	// Consumers report their first error back to the test goroutine, which
+	// alone may call t.Fatal.
 	consumers := 10
-	wgC := new(sync.WaitGroup)
-	wgC.Add(consumers)
+	errs := make(chan error, consumers)
 
 	for i := 0; i < producers; i++ {
 		go func() {
@@ -76,18 +87,23 @@ func TestRoundTripConcurrent(t *testing.T) {
 
 	for i := 0; i < consumers; i++ {
 		go func() {
-			defer wgC.Done()
+			var first error
 			for token := range tokens {
-				if err := params.Validate("woo", token); err != nil {
-					t.Fatal(err)
+				if err := params.Validate("woo", token); err != nil && first == nil {
+					first = err
 				}
 			}
+			errs <- first
 		}()
 	}
 
 	wgP.Wait()
 	close(tokens)
-	wgC.Wait()
+	for i := 0; i < consumers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
 }
 
 func TestRoundTripExpired(t *testing.T) {
@@ -100,15 +116,45 @@ func TestRoundTripExpired(t *testing.T) {
 		params.timer = time.Now
 	}()
 
-	if err := params.Validate("woo", token); err != ErrInvalidToken {
+	if err := params.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
 		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
 	}
 }
 
+func TestValidateStale(t *testing.T) {
+	now := time.Now()
+	p := New([]byte("yay"))
+	p.SoftMaxAge = 5 * time.Minute
+	p.timer = func() time.Time { return now }
+
+	token := p.Generate("woo")
+	if stale, err := p.ValidateStale(context.Background(), "woo", token); err != nil || stale {
+		t.Errorf("Fresh token was stale=%v, err=%v", stale, err)
+	}
+
+	now = now.Add(6 * time.Minute)
+	if stale, err := p.ValidateStale(context.Background(), "woo", token); err != nil || !stale {
+		t.Errorf("Stale token was stale=%v, err=%v", stale, err)
+	}
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Stale token was invalid: %v", err)
+	}
+
+	if info := p.Inspect("woo", token); !info.Stale {
+		t.Error("Inspect didn't report the token as stale")
+	}
+
+	now = now.Add(5 * time.Minute)
+	if stale, err := p.ValidateStale(context.Background(), "woo", token); !errors.Is(err, ErrInvalidToken) || stale {
+		t.Errorf("Expired token was stale=%v, err=%v", stale, err)
+	}
+}
+
 func TestRoundTripBadEncoding(t *testing.T) {
 	token := params.Generate("woo")
 
-	if err := params.Validate("woo", "A"+token); err != ErrInvalidToken {
+	if err := params.Validate("woo", "A"+token); !errors.Is(err, ErrInvalidToken) {
 		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
 	}
 }
@@ -120,11 +166,37 @@ func TestRoundTripBadToken(t *testing.T) {
 	b[0] ^= 12
 	token = base64.URLEncoding.EncodeToString(b)
 
-	if err := params.Validate("woo", token); err != ErrInvalidToken {
+	if err := params.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
 		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
 	}
 }
 
+func TestContextRoundTrip(t *testing.T) {
+	token, err := params.GenerateContext(context.Background(), "woo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := params.ValidateContext(context.Background(), "woo", token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	token := params.Generate("woo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := params.GenerateContext(ctx, "woo"); err != context.Canceled {
+		t.Errorf("Error was %v, but expected context.Canceled", err)
+	}
+
+	if err := params.ValidateContext(ctx, "woo", token); err != context.Canceled {
+		t.Errorf("Error was %v, but expected context.Canceled", err)
+	}
+}
+
 func BenchmarkGenerate(b *testing.B) {
 	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
@@ -146,3 +218,228 @@ func BenchmarkValidate(b *testing.B) {
 		}
 	})
 }
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+func TestRand(t *testing.T) {
+	for _, format := range []Format{FormatPASETOLocal, FormatBranca} {
+		p := New([]byte("yay"))
+		p.Format = format
+		p.Rand = zeroReader{}
+		p.timer = func() time.Time { return time.Unix(1000000, 0) }
+
+		if a, b := p.Generate("woo"), p.Generate("woo"); a != b {
+			t.Errorf("%v: tokens with the same nonce differed", format)
+		}
+	}
+}
+
+func TestRandFailure(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatBranca
+	p.Rand = strings.NewReader("")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic")
+		}
+	}()
+	p.Generate("woo")
+}
+
+func TestValidateErrors(t *testing.T) {
+	for _, format := range []Format{
+		FormatCharlie, FormatJWT, FormatPASETOLocal, FormatPASETOPublic, FormatBranca, FormatCOSE, FormatCharlieV2,
+	} {
+		now := time.Now()
+		p := New([]byte("yay"))
+		p.Format = format
+		p.timer = func() time.Time { return now }
+
+		token := p.Generate("woo")
+		if err := p.Validate("wee", token); err != ErrBadMAC {
+			t.Errorf("%v: error for another user was %v, but expected ErrBadMAC", format, err)
+		}
+
+		if err := New([]byte("boo")).Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: error for another key was %v, but expected ErrInvalidToken", format, err)
+		}
+
+		if err := p.Validate("woo", "!"); err != ErrBadEncoding {
+			t.Errorf("%v: error for a malformed token was %v, but expected ErrBadEncoding", format, err)
+		}
+
+		now = now.Add(time.Hour)
+		if err := p.Validate("woo", token); !errors.Is(err, ErrTokenExpired) {
+			t.Errorf("%v: error for an expired token was %v, but expected ErrTokenExpired", format, err)
+		}
+	}
+
+	for _, err := range []error{ErrBadEncoding, ErrBadMAC, ErrTokenExpired} {
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v isn't ErrInvalidToken", err)
+		}
+	}
+}
+
+func TestGenerateAt(t *testing.T) {
+	p := New([]byte("yay"))
+
+	if err := p.Validate("woo", p.GenerateAt("woo", time.Now().Add(-5*time.Minute))); err != nil {
+		t.Errorf("Expected a recent token to be valid, but got %v", err)
+	}
+
+	if err := p.Validate("woo", p.GenerateAt("woo", time.Now().Add(-time.Hour))); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Error was %v, but expected ErrTokenExpired", err)
+	}
+}
+
+func TestValidateAndRefresh(t *testing.T) {
+	now := time.Now()
+	p := New([]byte("yay"))
+	p.timer = func() time.Time { return now }
+
+	token := p.Generate("woo")
+	now = now.Add(5 * time.Minute)
+
+	fresh, err := p.ValidateAndRefresh("woo", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fresh == token {
+		t.Error("Expected a new token")
+	}
+
+	now = now.Add(8 * time.Minute)
+	if err := p.Validate("woo", fresh); err != nil {
+		t.Errorf("Expected the new token to be valid, but got %v", err)
+	}
+
+	if fresh, err := p.ValidateAndRefresh("woo", token); !errors.Is(err, ErrTokenExpired) || fresh != "" {
+		t.Errorf("Was %q, %v, but expected ErrTokenExpired", fresh, err)
+	}
+
+	// The user's generation is looked up once for both steps.
+	var lookups int
+	p.GenerationFunc = func(id string) uint32 {
+		lookups++
+		return 2
+	}
+	token = p.Generate("woo")
+
+	lookups = 0
+	if _, err := p.ValidateAndRefresh("woo", token); err != nil || lookups != 1 {
+		t.Errorf("Generation was looked up %d times (%v), but expected once", lookups, err)
+	}
+}
+
+func TestMaxClockSkew(t *testing.T) {
+	now := time.Now()
+	p := New([]byte("yay"))
+	p.timer = func() time.Time { return now }
+
+	token := p.GenerateAt("woo", now.Add(3*time.Hour))
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Expected future tokens to be accepted by default, but got %v", err)
+	}
+
+	p.MaxClockSkew = time.Minute
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error was %v, but expected ErrInvalidToken", err)
+	}
+
+	if err := p.Validate("woo", p.GenerateAt("woo", now.Add(30*time.Second))); err != nil {
+		t.Errorf("Expected a slightly skewed token to be valid, but got %v", err)
+	}
+}
+
+func TestMACSize(t *testing.T) {
+	for _, f := range []Format{FormatCharlie, FormatCharlieV2, FormatCharlieV3} {
+		base := len(mustDecode(t, New([]byte("yay")), f))
+		for _, n := range []int{16, 24, 32} {
+			p := New([]byte("yay"))
+			p.Format = f
+			p.MACSize = n
+
+			token := p.Generate("woo")
+			if v, want := len(mustDecode(t, p, f)), base+n-16; v != want {
+				t.Errorf("%s/%d: token was %d bytes, but expected %d", f, n, v, want)
+			}
+
+			if err := p.Validate("woo", token); err != nil {
+				t.Errorf("%s/%d: %v", f, n, err)
+			}
+
+			if err := p.Validate("boo", token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("%s/%d: error was %v, but expected ErrInvalidToken", f, n, err)
+			}
+
+			if n != 16 {
+				if err := New([]byte("yay")).Validate("woo", token); err == nil {
+					t.Errorf("%s/%d: token was valid with a 16-byte MAC", f, n)
+				}
+			}
+		}
+	}
+
+	if _, err := NewWithOptions([]byte("a-key-of-at-least-16-bytes"), WithMACSize(8)); err == nil {
+		t.Error("Expected a short MAC size to be rejected")
+	}
+
+	// Params with a MAC size out of range neither generate nor validate tokens.
+	p := New([]byte("yay"))
+	token := p.Generate("woo")
+	for _, n := range []int{-1, 8, 33} {
+		p.MACSize = n
+		if _, err := p.GenerateContext(context.Background(), "woo"); err != errBadMACSize {
+			t.Errorf("%d: error was %v, but expected errBadMACSize", n, err)
+		}
+
+		if err := p.Validate("woo", token); err != errBadMACSize {
+			t.Errorf("%d: error was %v, but expected errBadMACSize", n, err)
+		}
+
+		if info := p.Inspect("woo", token); info.Err != errBadMACSize {
+			t.Errorf("%d: error was %v, but expected errBadMACSize", n, info.Err)
+		}
+	}
+}
+
+func mustDecode(t *testing.T, p *Params, f Format) []byte {
+	p.Format = f
+	data, err := base64.URLEncoding.DecodeString(p.Generate("woo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestOnGenerateAndOnValidate(t *testing.T) {
+	var generated int
+	var validated []Validation
+	p := New([]byte("yay for dumbledore"))
+	p.OnGenerate = func(d time.Duration) { generated++ }
+	p.OnValidate = func(ctx context.Context, v Validation) { validated = append(validated, v) }
+
+	token := p.Generate("woo")
+	_ = p.Validate("woo", token)
+	_ = p.Validate("yay", token)
+
+	if generated != 1 {
+		t.Errorf("OnGenerate was called %d times, but expected 1", generated)
+	}
+
+	if len(validated) != 2 || validated[0].Err != nil || !errors.Is(validated[1].Err, ErrBadMAC) {
+		t.Fatalf("OnValidate was called with %v", validated)
+	}
+
+	if validated[0].IssuedAt.IsZero() || !validated[1].IssuedAt.IsZero() {
+		t.Errorf("Only the authentic token should have an IssuedAt: %v", validated)
+	}
+}
@@ -0,0 +1,72 @@
+package charlie
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCharlieV2RoundTrip(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatCharlieV2
+
+	token := p.Generate("woo")
+	if v, want := len(token), 32; v != want {
+		t.Errorf("Token length was %d, but expected %d", v, want)
+	}
+
+	data, _ := base64.URLEncoding.DecodeString(token)
+	if data[0] != charlieV2Version || data[1] != p.keys.current().kidByte {
+		t.Errorf("Unexpected header: %x", data[:2])
+	}
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCharlieV2Compatibility(t *testing.T) {
+	v1 := New([]byte("yay"))
+	v2 := New([]byte("yay"))
+	v2.Format = FormatCharlieV2
+
+	if err := v1.Validate("woo", v2.Generate("woo")); err != nil {
+		t.Errorf("FormatCharlie didn't accept a FormatCharlieV2 token: %v", err)
+	}
+
+	if err := v2.Validate("woo", v1.Generate("woo")); err != nil {
+		t.Errorf("FormatCharlieV2 didn't accept a FormatCharlie token: %v", err)
+	}
+}
+
+func TestCharlieV2KeySelection(t *testing.T) {
+	old := New([]byte("one"))
+	old.Format = FormatCharlieV2
+	t1 := old.Generate("woo")
+
+	p := New([]byte("two"), []byte("one"))
+	p.Format = FormatCharlieV2
+	if err := p.Validate("woo", t1); err != nil {
+		t.Errorf("Token generated with an old key was invalid: %v", err)
+	}
+
+	if usage := p.KeyUsage(); usage[0].Validations != 0 || usage[1].Validations != 1 {
+		t.Errorf("Expected only the old key to be used, but got %+v", usage)
+	}
+
+	if err := New([]byte("two")).Validate("woo", t1); err != ErrUnknownKey {
+		t.Errorf("Error was %v, but expected ErrUnknownKey", err)
+	}
+}
+
+func TestCharlieV2Expired(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatCharlieV2
+	token := p.Generate("woo")
+
+	p.timer = func() time.Time { return time.Now().Add(20 * time.Minute) }
+	if err := p.Validate("woo", token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Error was %v, but expected ErrTokenExpired", err)
+	}
+}
@@ -0,0 +1,64 @@
+package charlie
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCharlieV3RoundTrip(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatCharlieV3
+
+	token := p.Generate("woo")
+	if v, want := len(token), 36; v != want {
+		t.Errorf("Token length was %d, but expected %d", v, want)
+	}
+
+	data, _ := base64.URLEncoding.DecodeString(token)
+	if data[0] != charlieV3Version || data[1] != p.keys.current().kidByte {
+		t.Errorf("Unexpected header: %x", data[:2])
+	}
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Error(err)
+	}
+
+	if err := p.Validate("boo", token); err != ErrBadMAC {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+}
+
+func TestCharlieV3Compatibility(t *testing.T) {
+	formats := []Format{FormatCharlie, FormatCharlieV2, FormatCharlieV3}
+	for _, from := range formats {
+		for _, to := range formats {
+			g, v := New([]byte("yay")), New([]byte("yay"))
+			g.Format, v.Format = from, to
+
+			if err := v.Validate("woo", g.Generate("woo")); err != nil {
+				t.Errorf("%s didn't accept a %s token: %v", to, from, err)
+			}
+		}
+	}
+}
+
+func TestCharlieV3Timestamps(t *testing.T) {
+	now := time.Date(2040, 1, 1, 0, 0, 0, 123456789, time.UTC)
+	p := New([]byte("yay"))
+	p.Format = FormatCharlieV3
+	p.timer = func() time.Time { return now }
+
+	token := p.Generate("woo")
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Expected a token issued after 2038 to be valid, but got %v", err)
+	}
+
+	if info := p.Inspect("woo", token); !info.IssuedAt.Equal(now) {
+		t.Errorf("Token was issued at %v, but expected %v", info.IssuedAt, now)
+	}
+
+	if info, err := p.Decode("yay", token); err != nil || !info.IssuedAt.Equal(now) {
+		t.Errorf("Token was decoded as issued at %v (%v), but expected %v", info.IssuedAt, err, now)
+	}
+}
@@ -0,0 +1,197 @@
+// Package charliecaddy provides a Caddy HTTP handler module which enforces
+// Charlie tokens at the reverse proxy, leaving upstream applications only
+// responsible for issuing them.
+//
+// Its configuration mirrors charlie.HTTPParams:
+//
+//	charlie {
+//		key {env.CSRF_KEY}
+//		old_key {env.OLD_CSRF_KEY}
+//		csrf_header X-CSRF-Token
+//		csrf_cookie csrf
+//		session_cookie session
+//	}
+//
+// The key is base64-encoded, and should be the same key the upstream
+// applications use to generate tokens.
+package charliecaddy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/codahale/charlie"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+	httpcaddyfile.RegisterHandlerDirective("charlie", parseCaddyfile)
+}
+
+// errInvalidToken is the error with which rejected requests are handled, so
+// that Caddy's error routes apply.
+var errInvalidToken = errors.New("invalid CSRF token")
+
+// Handler is a Caddy HTTP handler module which only passes on requests with a
+// valid CSRF token. Its fields correspond to those of charlie.HTTPParams.
+type Handler struct {
+	// Key is the base64-encoded key. Placeholders (e.g. {env.CSRF_KEY}) are
+	// replaced.
+	Key string `json:"key,omitempty"`
+
+	// OldKeys are base64-encoded keys which are also accepted, e.g. while
+	// rotating Key. Placeholders are replaced.
+	OldKeys []string `json:"old_keys,omitempty"`
+
+	CSRFCookie string `json:"csrf_cookie,omitempty"`
+	CSRFHeader string `json:"csrf_header,omitempty"`
+
+	SessionCookie string `json:"session_cookie,omitempty"`
+	SessionHeader string `json:"session_header,omitempty"`
+
+	handler http.Handler
+}
+
+// state is the state of a request passing through a Handler.
+type state struct {
+	next     caddyhttp.Handler
+	err      error
+	rejected bool
+}
+
+type stateKey struct{}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.charlie",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision sets up the handler. It returns an error if the key or any old key,
+// once placeholders are replaced, is shorter than charlie.MinKeySize, e.g.
+// because an environment variable is unset.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	repl := caddy.NewReplacer()
+	key, err := base64.StdEncoding.DecodeString(repl.ReplaceKnown(h.Key, ""))
+	if err != nil {
+		return fmt.Errorf("charlie: invalid key: %w", err)
+	} else if len(key) < charlie.MinKeySize {
+		return fmt.Errorf("charlie: invalid key: %w", charlie.ErrShortKey)
+	}
+
+	var oldKeys [][]byte
+	for _, k := range h.OldKeys {
+		old, err := base64.StdEncoding.DecodeString(repl.ReplaceKnown(k, ""))
+		if err != nil {
+			return fmt.Errorf("charlie: invalid old key: %w", err)
+		} else if len(old) < charlie.MinKeySize {
+			return fmt.Errorf("charlie: invalid old key: %w", charlie.ErrShortKey)
+		}
+		oldKeys = append(oldKeys, old)
+	}
+
+	hp := &charlie.HTTPParams{
+		Key:           key,
+		OldKeys:       oldKeys,
+		CSRFCookie:    h.CSRFCookie,
+		CSRFHeader:    h.CSRFHeader,
+		SessionCookie: h.SessionCookie,
+		SessionHeader: h.SessionHeader,
+		InvalidHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(stateKey{}).(*state).rejected = true
+		}),
+	}
+
+	h.handler = hp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := r.Context().Value(stateKey{}).(*state)
+		st.err = st.next.ServeHTTP(w, r)
+	}))
+	return nil
+}
+
+// Validate validates the handler's configuration.
+func (h *Handler) Validate() error {
+	if h.Key == "" {
+		return errors.New("charlie: key is required")
+	}
+
+	if h.CSRFCookie == "" && h.CSRFHeader == "" {
+		return errors.New("charlie: csrf_cookie or csrf_header is required")
+	}
+
+	if h.SessionCookie == "" && h.SessionHeader == "" {
+		return errors.New("charlie: session_cookie or session_header is required")
+	}
+	return nil
+}
+
+// ServeHTTP passes on requests with a valid CSRF token to the next handler, and
+// returns a 403 error for all others.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	st := &state{next: next}
+	h.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stateKey{}, st)))
+
+	if st.rejected {
+		return caddyhttp.Error(http.StatusForbidden, errInvalidToken)
+	}
+	return st.err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume the directive name
+
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+
+	for d.NextBlock(0) {
+		opt := d.Val()
+
+		var v string
+		if !d.AllArgs(&v) {
+			return d.ArgErr()
+		}
+
+		switch opt {
+		case "key":
+			h.Key = v
+		case "old_key":
+			h.OldKeys = append(h.OldKeys, v)
+		case "csrf_cookie":
+			h.CSRFCookie = v
+		case "csrf_header":
+			h.CSRFHeader = v
+		case "session_cookie":
+			h.SessionCookie = v
+		case "session_header":
+			h.SessionHeader = v
+		default:
+			return d.Errf("unrecognized subdirective %q", opt)
+		}
+	}
+	return nil
+}
+
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m Handler
+	err := m.UnmarshalCaddyfile(h.Dispenser)
+	return m, err
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.Validator             = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
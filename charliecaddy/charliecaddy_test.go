@@ -0,0 +1,109 @@
+package charliecaddy
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/codahale/charlie"
+	"github.com/codahale/charlie/charlietest"
+)
+
+func TestConformance(t *testing.T) {
+	charlietest.Run(t, func(hp *charlie.HTTPParams, next http.Handler) http.Handler {
+		h := Handler{
+			Key:           base64.StdEncoding.EncodeToString(hp.Key),
+			OldKeys:       oldKeys(hp.OldKeys),
+			CSRFCookie:    hp.CSRFCookie,
+			CSRFHeader:    hp.CSRFHeader,
+			SessionCookie: hp.SessionCookie,
+			SessionHeader: hp.SessionHeader,
+		}
+		if err := h.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := h.ServeHTTP(w, r, caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				next.ServeHTTP(w, r)
+				return nil
+			}))
+
+			var herr caddyhttp.HandlerError
+			if errors.As(err, &herr) {
+				w.WriteHeader(herr.StatusCode)
+			}
+		})
+	})
+}
+
+func oldKeys(keys [][]byte) []string {
+	var s []string
+	for _, k := range keys {
+		s = append(s, base64.StdEncoding.EncodeToString(k))
+	}
+	return s
+}
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	charlie {
+		key c2VjcmV0
+		old_key b2xk
+		csrf_header X-CSRF-Token
+		csrf_cookie csrf
+		session_header X-Session
+		session_cookie session
+	}`)
+
+	var h Handler
+	if err := h.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Handler{
+		Key:           "c2VjcmV0",
+		CSRFHeader:    "X-CSRF-Token",
+		CSRFCookie:    "csrf",
+		SessionHeader: "X-Session",
+		SessionCookie: "session",
+	}
+	if h.Key != want.Key || h.CSRFHeader != want.CSRFHeader || h.CSRFCookie != want.CSRFCookie ||
+		h.SessionHeader != want.SessionHeader || h.SessionCookie != want.SessionCookie ||
+		len(h.OldKeys) != 1 || h.OldKeys[0] != "b2xk" {
+		t.Errorf("Handler was %+v, but expected %+v", h, want)
+	}
+
+	if err := h.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`charlie { nope x }`)); err == nil {
+		t.Error("Expected an error for an unknown subdirective")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (&Handler{CSRFHeader: "X-CSRF-Token", SessionCookie: "session"}).Validate(); err == nil {
+		t.Error("Expected an error without a key")
+	}
+}
+
+func TestProvisionShortKey(t *testing.T) {
+	t.Setenv("CHARLIE_TEST_KEY", "")
+
+	for _, h := range []Handler{
+		{Key: "{env.CHARLIE_TEST_KEY}"},
+		{Key: "c2VjcmV0"},
+		{Key: base64.StdEncoding.EncodeToString([]byte("ayellowsubmarine")), OldKeys: []string{"{env.CHARLIE_TEST_KEY}"}},
+	} {
+		h.CSRFHeader, h.SessionCookie = "X-CSRF-Token", "session"
+		if err := h.Provision(caddy.Context{}); !errors.Is(err, charlie.ErrShortKey) {
+			t.Errorf("%+v: error was %v, but expected ErrShortKey", h, err)
+		}
+	}
+}
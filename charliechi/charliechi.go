@@ -0,0 +1,95 @@
+// Package charliechi adapts Charlie's middleware to chi routers, exempting
+// requests by the patterns of the routes they're routed to:
+//
+//	r := chi.NewRouter()
+//	r.Use(charliechi.Middleware(hp, "POST /webhooks/{provider}", "/oauth/callback"))
+//
+// Handlers find the token issued with their responses with Token.
+package charliechi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/codahale/charlie"
+	"github.com/go-chi/chi/v5"
+)
+
+// Middleware returns hp.Middleware(), for use with a chi Router's Use, With,
+// or Group, which doesn't enforce tokens for requests routed to any of the
+// given exempt route patterns. Each is a chi route pattern as RoutePattern
+// returns it, e.g. "/webhooks/{provider}" or, for a mounted router,
+// "/api/hooks/*", optionally preceded by a method, e.g. "POST /hooks". It
+// prepends an exempt Override to hp's Overrides, so it should be called once
+// for each HTTPParams.
+func Middleware(hp *charlie.HTTPParams, exempt ...string) func(http.Handler) http.Handler {
+	if len(exempt) > 0 {
+		hp.Overrides = append([]charlie.Override{{
+			Match:  func(r *http.Request) bool { return exempts(r, exempt) },
+			Exempt: true,
+		}}, hp.Overrides...)
+	}
+	return hp.Middleware()
+}
+
+// RoutePattern returns the pattern of the route the request is routed to by
+// the chi router serving it, e.g. "/users/{id}", or an empty string if it's
+// not served by a chi router or no route matches. Unlike chi's
+// Context.RoutePattern, it's complete in middleware added with Use, which
+// runs before the request is routed.
+func RoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+
+	method := rctx.RouteMethod
+	if method == "" {
+		method = r.Method
+	}
+
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	// Find the route from the top-level router, which chi's context always
+	// holds, so the pattern includes those of any mounted routers.
+	pattern := rctx.Routes.Find(chi.NewRouteContext(), method, path)
+	for strings.Contains(pattern, "/*/") {
+		pattern = strings.ReplaceAll(pattern, "/*/", "/")
+	}
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return pattern
+}
+
+// Token returns the token the middleware issued with the response to the
+// request, for handlers to embed in HTML or JSON bodies. See
+// charlie.TokenFromContext.
+func Token(r *http.Request) string {
+	return charlie.TokenFromContext(r.Context())
+}
+
+// exempts returns true if the request is routed to any of the given patterns.
+func exempts(r *http.Request, exempt []string) bool {
+	pattern := RoutePattern(r)
+	if pattern == "" {
+		return false
+	}
+
+	for _, e := range exempt {
+		if method, p, ok := strings.Cut(e, " "); ok {
+			if method == r.Method && strings.TrimSpace(p) == pattern {
+				return true
+			}
+		} else if e == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package charliechi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codahale/charlie"
+	"github.com/go-chi/chi/v5"
+)
+
+func Example() {
+	hp := &charlie.HTTPParams{
+		Key:           []byte("yay for dumbledore"),
+		CSRFHeader:    "X-CSRF-Token",
+		SessionCookie: "session",
+	}
+
+	r := chi.NewRouter()
+	r.Use(Middleware(hp, "POST /webhooks/{provider}"))
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		// embed the token for the session in the page
+		_, _ = io.WriteString(w, `<meta name="csrf-token" content="`+Token(r)+`">`)
+	})
+
+	r.Post("/webhooks/{provider}", func(w http.ResponseWriter, r *http.Request) {
+		// webhooks are authenticated by their signatures instead
+		// ...
+	})
+
+	_ = http.ListenAndServe(":8080", r)
+}
+
+func TestMiddleware(t *testing.T) {
+	hp := &charlie.HTTPParams{
+		Key:           []byte("yay for dumbledore"),
+		CSRFHeader:    "csrf",
+		SessionHeader: "session",
+	}
+
+	noContent := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}
+
+	api := chi.NewRouter()
+	api.Post("/hooks", noContent)
+	api.Post("/items/{id}", noContent)
+
+	r := chi.NewRouter()
+	r.Use(Middleware(hp, "POST /webhooks/{provider}", "/api/hooks"))
+	r.Get("/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, Token(r))
+	})
+	r.Post("/webhooks/{provider}", noContent)
+	r.Post("/submit", noContent)
+	r.Mount("/api", api)
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("session", "woo")
+		if token != "" {
+			req.Header.Set("csrf", token)
+		}
+
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		return res
+	}
+
+	token := serve("GET", "/token", "").Body.String()
+	if token == "" {
+		t.Fatal("Expected a token in the body")
+	}
+
+	for _, tc := range []struct {
+		path, token string
+		code        int
+	}{
+		{path: "/submit", code: http.StatusForbidden},
+		{path: "/submit", token: token, code: 204},
+		{path: "/webhooks/github", code: 204},
+		{path: "/api/hooks", code: 204},
+		{path: "/api/items/1", code: http.StatusForbidden},
+		{path: "/api/items/1", token: token, code: 204},
+	} {
+		if res := serve("POST", tc.path, tc.token); res.Code != tc.code {
+			t.Errorf("Expected a %d for %s, got %d", tc.code, tc.path, res.Code)
+		}
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	var patterns []string
+	record := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			patterns = append(patterns, RoutePattern(r))
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	api := chi.NewRouter()
+	api.Use(record)
+	api.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	api.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := chi.NewRouter()
+	r.Use(record)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	r.Mount("/api", api)
+
+	for _, path := range []string{"/", "/api/users/1", "/api", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	want := []string{"/", "/api/users/{id}", "/api/users/{id}", "/api", "/api", ""}
+	if len(patterns) != len(want) {
+		t.Fatalf("Patterns were %q, but expected %q", patterns, want)
+	}
+	for i := range want {
+		if patterns[i] != want[i] {
+			t.Errorf("Patterns were %q, but expected %q", patterns, want)
+			break
+		}
+	}
+
+	if p := RoutePattern(httptest.NewRequest("GET", "/", nil)); p != "" {
+		t.Errorf("Pattern outside of chi was %q", p)
+	}
+}
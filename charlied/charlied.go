@@ -0,0 +1,184 @@
+// Package charlied provides a sidecar which generates and validates tokens on
+// behalf of other services on the same host, so that services not written in
+// Go can use Charlie tokens without reimplementing its cryptography.
+//
+// The sidecar speaks HTTP over a Unix-domain socket. Both endpoints take and
+// return JSON:
+//
+//	POST /v1/generate {"id": "..."}                -> {"token": "..."}
+//	POST /v1/validate {"id": "...", "token": "..."} -> {"valid": true}
+//
+// For example, with curl:
+//
+//	curl --unix-socket /run/charlied.sock -d '{"id":"session"}' http://charlied/v1/generate
+//
+// Client is a Go client for the sidecar, and cmd/charlied is its daemon.
+package charlied
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/codahale/charlie"
+)
+
+type request struct {
+	ID    string `json:"id"`
+	Token string `json:"token,omitempty"`
+}
+
+type response struct {
+	Token string `json:"token,omitempty"`
+	Valid bool   `json:"valid,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Handler returns an http.Handler which serves the sidecar's API for the given
+// Params.
+func Handler(p *charlie.Params) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/generate", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decode(w, r)
+		if !ok {
+			return
+		}
+
+		token, err := p.GenerateContext(r.Context(), req.ID)
+		if err != nil {
+			respond(w, http.StatusServiceUnavailable, response{Error: err.Error()})
+			return
+		}
+		respond(w, http.StatusOK, response{Token: token})
+	})
+	mux.HandleFunc("POST /v1/validate", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decode(w, r)
+		if !ok {
+			return
+		}
+
+		err := p.ValidateContext(r.Context(), req.ID, req.Token)
+		switch {
+		case err == nil:
+			respond(w, http.StatusOK, response{Valid: true})
+		case errors.Is(err, charlie.ErrInvalidToken):
+			respond(w, http.StatusOK, response{Error: err.Error()})
+		default:
+			respond(w, http.StatusServiceUnavailable, response{Error: err.Error()})
+		}
+	})
+	return mux
+}
+
+func decode(w http.ResponseWriter, r *http.Request) (request, bool) {
+	var req request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		respond(w, http.StatusBadRequest, response{Error: err.Error()})
+		return req, false
+	}
+	return req, true
+}
+
+func respond(w http.ResponseWriter, code int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ListenAndServe serves the sidecar's API for the given Params on a Unix-domain
+// socket at the given path, replacing any stale socket. The socket is only
+// accessible to the daemon's user and group.
+func ListenAndServe(path string, p *charlie.Params) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if err := os.Chmod(path, 0660); err != nil {
+		return err
+	}
+	return http.Serve(l, Handler(p))
+}
+
+// Client is a client for a sidecar listening on a Unix-domain socket.
+type Client struct {
+	hc *http.Client
+}
+
+// NewClient returns a Client for the sidecar listening at the given path.
+func NewClient(path string) *Client {
+	return &Client{
+		hc: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// Generate returns a new token for the given user.
+func (c *Client) Generate(ctx context.Context, id string) (string, error) {
+	resp, err := c.call(ctx, "/v1/generate", request{ID: id})
+	if err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// Validate validates the given token for the given user, returning
+// charlie.ErrInvalidToken if it's invalid.
+func (c *Client) Validate(ctx context.Context, id, token string) error {
+	resp, err := c.call(ctx, "/v1/validate", request{ID: id, Token: token})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Valid {
+		return charlie.ErrInvalidToken
+	}
+	return nil
+}
+
+func (c *Client) call(ctx context.Context, path string, req request) (response, error) {
+	var resp response
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, "POST", "http://charlied"+path, bytes.NewReader(b))
+	if err != nil {
+		return resp, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	res, err := c.hc.Do(r)
+	if err != nil {
+		return resp, err
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return resp, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf("charlied: %s: %s", res.Status, resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,75 @@
+package charlied
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codahale/charlie"
+)
+
+func TestClient(t *testing.T) {
+	dir, err := os.MkdirTemp("", "charlied")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "charlied.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := charlie.New([]byte("yay"))
+	s := httptest.NewUnstartedServer(Handler(p))
+	s.Listener = l
+	s.Start()
+	defer s.Close()
+
+	ctx := context.Background()
+	c := NewClient(path)
+
+	token, err := c.Generate(ctx, "woo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Generated token was invalid: %v", err)
+	}
+
+	if err := c.Validate(ctx, "woo", token); err != nil {
+		t.Errorf("Expected the token to be valid, but was %v", err)
+	}
+
+	if err := c.Validate(ctx, "yay", token); !errors.Is(err, charlie.ErrInvalidToken) {
+		t.Errorf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestHandlerBadRequest(t *testing.T) {
+	h := Handler(charlie.New([]byte("yay")))
+
+	req := httptest.NewRequest("POST", "/v1/validate", strings.NewReader("{"))
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("Expected a 400, but got %d", res.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/generate", nil)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected a 405, but got %d", res.Code)
+	}
+}
@@ -0,0 +1,133 @@
+// Package charlieecho adapts Charlie's middleware to Echo, as a replacement for
+// Echo's own CSRF middleware which needs no server-side token storage:
+//
+//	e := echo.New()
+//	e.Use(charlieecho.Middleware(hp))
+//
+// Rejected requests are returned as errors, to be handled by Echo's
+// HTTPErrorHandler like any other, and handlers find the token issued with
+// their responses with Token.
+package charlieecho
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/codahale/charlie"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Config is the configuration of the middleware.
+type Config struct {
+	// HTTP checks requests and issues tokens. Its InvalidHandler, ErrorHandler,
+	// and OnInvalid hook are set by the middleware, calling any OnInvalid hook
+	// it already has, so it should be used by only one middleware.
+	HTTP *charlie.HTTPParams
+
+	// Skipper, if non-nil, returns true for requests which are served without
+	// being checked or issued tokens.
+	Skipper middleware.Skipper
+
+	// ErrorHandler, if non-nil, returns the error for a rejected request, given
+	// the reason it was rejected (e.g. charlie.ErrMissingToken or
+	// charlie.ErrTokenExpired) or the error with which checking it failed
+	// unexpectedly (e.g. charlie.ErrBackendUnavailable). Otherwise, rejected
+	// requests return middleware.ErrCSRFInvalid, with the reason as its
+	// internal error, and failures return their errors.
+	ErrorHandler func(err error, c echo.Context) error
+}
+
+// Middleware returns middleware which checks requests with hp.
+func Middleware(hp *charlie.HTTPParams) echo.MiddlewareFunc {
+	return WithConfig(Config{HTTP: hp})
+}
+
+// WithConfig returns middleware with the given configuration.
+func WithConfig(config Config) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	hp := config.HTTP
+	onInvalid := hp.OnInvalid
+	hp.OnInvalid = func(r *http.Request, err error) {
+		if s, ok := r.Context().Value(stateKey{}).(*state); ok {
+			s.reason = err
+		}
+
+		if onInvalid != nil {
+			onInvalid(r, err)
+		}
+	}
+
+	hp.InvalidHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s, ok := r.Context().Value(stateKey{}).(*state); ok {
+			s.rejected = true
+		}
+	})
+
+	hp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if s, ok := r.Context().Value(stateKey{}).(*state); ok {
+			s.failed = err
+		}
+	}
+
+	h := hp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := r.Context().Value(stateKey{}).(*state)
+
+		// Write the response with the middleware's writer, so that it can set
+		// headers and inject tokens, and hand the handler the request with the
+		// token in its context.
+		res := s.c.Response()
+		writer := res.Writer
+		res.Writer = w
+		s.c.SetRequest(r)
+		s.err = s.next(s.c)
+		res.Writer = writer
+	}))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			s := &state{c: c, next: next}
+			r := c.Request()
+			h.ServeHTTP(c.Response().Writer, r.WithContext(context.WithValue(r.Context(), stateKey{}, s)))
+
+			switch {
+			case s.failed != nil:
+				if config.ErrorHandler != nil {
+					return config.ErrorHandler(s.failed, c)
+				}
+				return s.failed
+			case s.rejected:
+				if config.ErrorHandler != nil {
+					return config.ErrorHandler(s.reason, c)
+				}
+				return middleware.ErrCSRFInvalid.WithInternal(s.reason)
+			}
+			return s.err
+		}
+	}
+}
+
+// Token returns the token the middleware issued with the response, for
+// handlers to embed in HTML or JSON bodies. See charlie.TokenFromContext.
+func Token(c echo.Context) string {
+	return charlie.TokenFromContext(c.Request().Context())
+}
+
+type stateKey struct{}
+
+// state is the state of a request's check.
+type state struct {
+	c        echo.Context
+	next     echo.HandlerFunc
+	err      error // err is the handler's error.
+	reason   error // reason is why the request was invalid.
+	rejected bool
+	failed   error // failed is the error with which checking failed.
+}
@@ -0,0 +1,116 @@
+package charlieecho
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codahale/charlie"
+	"github.com/labstack/echo/v4"
+)
+
+func serve(e *echo.Echo, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("session", "woo")
+	if token != "" {
+		req.Header.Set("csrf", token)
+	}
+
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	return res
+}
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(&charlie.HTTPParams{
+		Key:           []byte("yay for dumbledore"),
+		CSRFHeader:    "csrf",
+		IssueHeader:   "csrf",
+		SessionHeader: "session",
+	}))
+	e.GET("/token", func(c echo.Context) error {
+		return c.String(http.StatusOK, Token(c))
+	})
+	e.POST("/submit", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.POST("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot)
+	})
+
+	res := serve(e, "GET", "/token", "")
+	token := res.Body.String()
+	if token == "" || res.Header().Get("csrf") != token {
+		t.Fatalf("Expected a token in the body and header, got %q and %q", token, res.Header().Get("csrf"))
+	}
+
+	for _, tc := range []struct {
+		path, token string
+		code        int
+	}{
+		{path: "/submit", code: http.StatusForbidden},
+		{path: "/submit", token: "%%%", code: http.StatusForbidden},
+		{path: "/submit", token: token, code: http.StatusNoContent},
+		{path: "/fail", token: token, code: http.StatusTeapot},
+	} {
+		if res := serve(e, "POST", tc.path, tc.token); res.Code != tc.code {
+			t.Errorf("Expected a %d for %s with %q, got %d", tc.code, tc.path, tc.token, res.Code)
+		}
+	}
+}
+
+func TestWithConfig(t *testing.T) {
+	p := charlie.New([]byte("yay for dumbledore"))
+	p.Revoker = failingRevoker{}
+
+	var reasons []error
+	e := echo.New()
+	e.Use(WithConfig(Config{
+		HTTP: &charlie.HTTPParams{
+			Key:           []byte("yay for dumbledore"),
+			CSRFHeader:    "csrf",
+			SessionHeader: "session",
+			Params:        p,
+		},
+		Skipper: func(c echo.Context) bool {
+			return c.Request().URL.Path == "/skipped"
+		},
+		ErrorHandler: func(err error, c echo.Context) error {
+			reasons = append(reasons, err)
+			return echo.NewHTTPError(http.StatusUnauthorized)
+		},
+	}))
+	e.POST("/*", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	if res := serve(e, "POST", "/skipped", ""); res.Code != http.StatusNoContent {
+		t.Errorf("Expected a 204 for a skipped request, got %d", res.Code)
+	}
+
+	if res := serve(e, "POST", "/submit", ""); res.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 from the ErrorHandler, got %d", res.Code)
+	}
+
+	token := p.Generate("woo")
+	if res := serve(e, "POST", "/submit", token); res.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 from the ErrorHandler, got %d", res.Code)
+	}
+
+	if len(reasons) != 2 || !errors.Is(reasons[0], charlie.ErrMissingToken) ||
+		!errors.Is(reasons[1], charlie.ErrBackendUnavailable) {
+		t.Errorf("Unexpected reasons: %v", reasons)
+	}
+}
+
+var errUnavailable = errors.New("unavailable")
+
+type failingRevoker struct{}
+
+func (failingRevoker) RevokedAt(ctx context.Context, id string) (time.Time, error) {
+	return time.Time{}, errUnavailable
+}
@@ -0,0 +1,169 @@
+// Package charlieenvoy provides a gRPC server implementing Envoy's external
+// authorization API, so that a service mesh can enforce Charlie tokens
+// centrally:
+//
+//	s := grpc.NewServer()
+//	charlieenvoy.Register(s, &charlie.HTTPParams{
+//		Key:           key,
+//		CSRFHeader:    "X-CSRF-Token",
+//		SessionCookie: "session",
+//	})
+//
+// Each check is decided by the reference middleware, HTTPParams.Wrap, against
+// a request reconstructed from the check's attributes, so the semantics of
+// HTTPParams options (policies, overrides, hooks, and so on) carry over. The
+// headers the middleware sets on allowed requests, such as issued tokens, are
+// added to the response. Envoy only sends request bodies if the filter's
+// with_request_body is set; without it, tokens in form fields or JSON bodies
+// (CSRFFormField, CSRFJSONField, and their extractors) aren't found.
+//
+// Keys are rotated and metrics recorded as for the middleware, by giving the
+// HTTPParams a Params which a charlie.Reloader (or charliek8s.Watcher) reloads,
+// and instrumenting it (e.g. with charlieprom) before calling Register:
+//
+//	hp := &charlie.HTTPParams{Params: csrf, CSRFHeader: "X-CSRF-Token", SessionCookie: "session"}
+//	metrics.InstrumentHTTP(hp)
+//	go (&charlie.Reloader{Params: csrf, KeyFile: "/etc/charlie/key"}).Run(ctx)
+//	charlieenvoy.Register(s, hp)
+package charlieenvoy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/codahale/charlie"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// Server is an Envoy external authorization server which allows requests with
+// a valid CSRF token.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+
+	handler http.Handler
+}
+
+type allowedKey struct{}
+
+// NewServer returns a Server which checks requests as configured by the given
+// HTTPParams.
+func NewServer(hp *charlie.HTTPParams) *Server {
+	allow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*r.Context().Value(allowedKey{}).(*bool) = true
+	})
+	return &Server{handler: hp.Wrap(allow)}
+}
+
+// Register registers a Server for the given HTTPParams with a gRPC server.
+func Register(s grpc.ServiceRegistrar, hp *charlie.HTTPParams) {
+	authv3.RegisterAuthorizationServer(s, NewServer(hp))
+}
+
+// Check implements authv3.AuthorizationServer.
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	r, err := httpRequest(ctx, req)
+	if err != nil {
+		return nil, grpcstatus.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+
+	var allowed bool
+	rec := &recorder{header: make(http.Header)}
+	s.handler.ServeHTTP(rec, r.WithContext(context.WithValue(ctx, allowedKey{}, &allowed)))
+
+	if allowed {
+		return &authv3.CheckResponse{
+			Status: &status.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{
+				OkResponse: &authv3.OkHttpResponse{
+					ResponseHeadersToAdd: headers(rec.header),
+				},
+			},
+		}, nil
+	}
+
+	code := rec.code
+	if code == 0 {
+		code = http.StatusForbidden
+	}
+
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.PermissionDenied)},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(code)},
+				Headers: headers(rec.header),
+			},
+		},
+	}, nil
+}
+
+// httpRequest reconstructs the HTTP request described by a check's attributes.
+func httpRequest(ctx context.Context, req *authv3.CheckRequest) (*http.Request, error) {
+	attrs := req.GetAttributes().GetRequest().GetHttp()
+
+	path := attrs.GetPath()
+	if path == "" {
+		path = "/"
+	}
+
+	body := attrs.GetRawBody()
+	if body == nil && attrs.GetBody() != "" {
+		body = []byte(attrs.GetBody())
+	}
+
+	r, err := http.NewRequestWithContext(ctx, attrs.GetMethod(), path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Host = attrs.GetHost()
+	r.RequestURI = path
+	for k, v := range attrs.GetHeaders() {
+		r.Header.Set(k, v)
+	}
+	return r, nil
+}
+
+// headers converts response headers to Envoy's header options.
+func headers(h http.Header) []*corev3.HeaderValueOption {
+	var opts []*corev3.HeaderValueOption
+	for k, vs := range h {
+		for _, v := range vs {
+			opts = append(opts, &corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{Key: k, Value: v},
+			})
+		}
+	}
+	return opts
+}
+
+// recorder is a minimal http.ResponseWriter which records the status code and
+// headers of a response.
+type recorder struct {
+	header http.Header
+	code   int
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.code == 0 {
+		rec.code = code
+	}
+}
@@ -0,0 +1,139 @@
+package charlieenvoy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/codahale/charlie"
+	"github.com/codahale/charlie/charlietest"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc/codes"
+)
+
+func checkRequest(r *http.Request) *authv3.CheckRequest {
+	headers := make(map[string]string)
+	for k, vs := range r.Header {
+		headers[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+	if cookies := r.Header.Values("Cookie"); len(cookies) > 0 {
+		headers["cookie"] = strings.Join(cookies, "; ")
+	}
+
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:  r.Method,
+					Path:    r.URL.RequestURI(),
+					Host:    r.Host,
+					Headers: headers,
+				},
+			},
+		},
+	}
+}
+
+func TestConformance(t *testing.T) {
+	charlietest.Run(t, func(hp *charlie.HTTPParams, next http.Handler) http.Handler {
+		s := NewServer(hp)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := s.Check(r.Context(), checkRequest(r))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.GetStatus().GetCode() == int32(codes.OK) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.WriteHeader(int(res.GetDeniedResponse().GetStatus().GetCode()))
+		})
+	})
+}
+
+func TestMissingStatusCode(t *testing.T) {
+	s := NewServer(&charlie.HTTPParams{
+		Key:               []byte("secret"),
+		CSRFHeader:        "X-CSRF-Token",
+		SessionCookie:     "session",
+		MissingStatusCode: http.StatusUnauthorized,
+	})
+
+	r, _ := http.NewRequest("POST", "/", nil)
+	res, err := s.Check(context.Background(), checkRequest(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := res.GetStatus().GetCode(); v != int32(codes.PermissionDenied) {
+		t.Errorf("Status was %d, but expected PermissionDenied", v)
+	}
+
+	if v := res.GetDeniedResponse().GetStatus().GetCode(); v != http.StatusUnauthorized {
+		t.Errorf("HTTP status was %d, but expected 401", v)
+	}
+}
+
+func TestAllowedHeaders(t *testing.T) {
+	csrf := charlie.New([]byte("ayellowsubmarine"))
+	s := NewServer(&charlie.HTTPParams{
+		Params:        csrf,
+		CSRFFormField: "csrf",
+		SessionCookie: "session",
+		IssueHeader:   "X-Next-Token",
+	})
+
+	body := "csrf=" + csrf.Generate("woo")
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "woo"})
+
+	req := checkRequest(r)
+	req.Attributes.Request.Http.RawBody = []byte(body)
+	res, err := s.Check(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := res.GetStatus().GetCode(); v != int32(codes.OK) {
+		t.Fatalf("Status was %d, but expected OK", v)
+	}
+
+	var issued bool
+	for _, h := range res.GetOkResponse().GetResponseHeadersToAdd() {
+		if h.GetHeader().GetKey() == "X-Next-Token" && csrf.Validate("woo", h.GetHeader().GetValue()) == nil {
+			issued = true
+		}
+	}
+
+	if !issued {
+		t.Errorf("Expected a token to be issued, but headers were %v", res.GetOkResponse().GetResponseHeadersToAdd())
+	}
+}
+
+func TestKeyReload(t *testing.T) {
+	csrf := charlie.New([]byte("ayellowsubmarine"))
+	s := NewServer(&charlie.HTTPParams{
+		Params:        csrf,
+		CSRFHeader:    "X-CSRF-Token",
+		SessionCookie: "session",
+	})
+
+	csrf.SetKey([]byte("anothersubmarine"), 0)
+	token := charlie.New([]byte("anothersubmarine")).Generate("woo")
+
+	r, _ := http.NewRequest("POST", "/", nil)
+	r.Header.Set("X-CSRF-Token", token)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "woo"})
+
+	res, err := s.Check(context.Background(), checkRequest(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := res.GetStatus().GetCode(); v != int32(codes.OK) {
+		t.Errorf("Status was %d, but expected OK with the reloaded key", v)
+	}
+}
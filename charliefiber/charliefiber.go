@@ -0,0 +1,176 @@
+// Package charliefiber provides Fiber middleware which checks Charlie tokens,
+// reading them and session IDs from the fasthttp request directly rather than
+// converting it to a net/http request:
+//
+//	app := fiber.New()
+//	app.Use(charliefiber.New(charliefiber.Config{
+//		Params:        p,
+//		CSRFHeader:    "X-CSRF-Token",
+//		SessionCookie: "session",
+//	}))
+//
+// Its configuration mirrors the parts of charlie.HTTPParams which apply to
+// APIs. Headers and cookies aren't copied, so checking a request allocates
+// only what validating its token does, unless the Params have a ReplayStore,
+// which may keep tokens after the request.
+package charliefiber
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/codahale/charlie"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Config is the configuration of the middleware.
+type Config struct {
+	// Params validates and generates tokens.
+	Params *charlie.Params
+
+	// Next, if non-nil, returns true for requests which are served without
+	// being checked.
+	Next func(c *fiber.Ctx) bool
+
+	// CSRFHeader and CSRFCookie name the header and cookie in which tokens
+	// are found. If a request has both, either token may be valid.
+	CSRFHeader string
+	CSRFCookie string
+
+	// SessionHeader and SessionCookie name the header and cookie in which
+	// session IDs are found. The header is preferred.
+	SessionHeader string
+	SessionCookie string
+
+	// IssueHeader, if set, names a response header in which responses to
+	// requests with a session carry a new token, which handlers also find
+	// with Token.
+	IssueHeader string
+
+	// SafeMethods are the methods of requests which aren't checked. They
+	// default to GET, HEAD, OPTIONS, and TRACE.
+	SafeMethods []string
+
+	// ErrorHandler, if non-nil, returns the error for a rejected request,
+	// given the reason it was rejected (e.g. charlie.ErrMissingToken or
+	// charlie.ErrTokenExpired) or the error with which checking it failed
+	// unexpectedly (e.g. charlie.ErrBackendUnavailable). Otherwise, rejected
+	// requests return fiber.ErrForbidden and failures return their errors.
+	ErrorHandler fiber.ErrorHandler
+}
+
+var defaultSafeMethods = []string{
+	fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace,
+}
+
+type tokenKey struct{}
+
+// New returns middleware with the given configuration.
+func New(config Config) fiber.Handler {
+	if config.SafeMethods == nil {
+		config.SafeMethods = defaultSafeMethods
+	}
+
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *fiber.Ctx, err error) error {
+			if errors.Is(err, charlie.ErrInvalidToken) {
+				return fiber.ErrForbidden
+			}
+			return err
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		id := config.sessionID(c)
+		if !config.safe(c.Method()) {
+			if err := config.validate(c, id); err != nil {
+				return config.ErrorHandler(c, err)
+			}
+		}
+
+		if config.IssueHeader != "" && id != "" {
+			token, err := config.Params.GenerateContext(c.UserContext(), id)
+			if err != nil {
+				return err
+			}
+			c.Locals(tokenKey{}, token)
+			c.Set(config.IssueHeader, token)
+			c.Set(fiber.HeaderCacheControl, "no-store")
+			c.Vary(fiber.HeaderCookie)
+		}
+		return c.Next()
+	}
+}
+
+// Token returns the token the middleware issued with the response, or an
+// empty string if it issued none.
+func Token(c *fiber.Ctx) string {
+	token, _ := c.Locals(tokenKey{}).(string)
+	return token
+}
+
+func (config *Config) safe(method string) bool {
+	for _, m := range config.SafeMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (config *Config) sessionID(c *fiber.Ctx) string {
+	if config.SessionHeader != "" {
+		if id := c.Get(config.SessionHeader); id != "" {
+			return id
+		}
+	}
+
+	if config.SessionCookie != "" {
+		return c.Cookies(config.SessionCookie)
+	}
+	return ""
+}
+
+// validate returns nil if either the header or the cookie holds a valid token
+// for the given session, or else why neither does.
+func (config *Config) validate(c *fiber.Ctx, id string) error {
+	if id == "" {
+		return charlie.ErrMissingSession
+	}
+
+	var header, cookie string
+	if config.CSRFHeader != "" {
+		header = c.Get(config.CSRFHeader)
+	}
+	if config.CSRFCookie != "" {
+		cookie = c.Cookies(config.CSRFCookie)
+	}
+
+	if header == "" && cookie == "" {
+		return charlie.ErrMissingToken
+	}
+
+	var err error
+	for _, token := range [...]string{header, cookie} {
+		if token == "" {
+			continue
+		}
+
+		// Fiber's strings are only valid until the handler returns, so those
+		// a ReplayStore may keep must be copied.
+		if config.Params.ReplayStore != nil {
+			token = strings.Clone(token)
+		}
+
+		if e := config.Params.ValidateContext(c.UserContext(), id, token); e == nil {
+			return nil
+		} else if err == nil || !errors.Is(e, charlie.ErrInvalidToken) {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package charliefiber
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codahale/charlie"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNew(t *testing.T) {
+	p := charlie.New([]byte("yay for dumbledore"))
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Params:        p,
+		CSRFHeader:    "csrf",
+		CSRFCookie:    "csrf",
+		SessionHeader: "session",
+		SessionCookie: "session",
+		IssueHeader:   "csrf",
+	}))
+	app.Get("/token", func(c *fiber.Ctx) error {
+		return c.SendString(Token(c))
+	})
+	app.Post("/submit", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	token := p.Generate("woo")
+	for _, tc := range []struct {
+		name   string
+		header map[string]string
+		cookie map[string]string
+		code   int
+	}{
+		{name: "no session", header: map[string]string{"csrf": token}, code: http.StatusForbidden},
+		{name: "no token", header: map[string]string{"session": "woo"}, code: http.StatusForbidden},
+		{name: "invalid token", header: map[string]string{"session": "woo", "csrf": "%%%"}, code: http.StatusForbidden},
+		{name: "other session", header: map[string]string{"session": "yay", "csrf": token}, code: http.StatusForbidden},
+		{name: "headers", header: map[string]string{"session": "woo", "csrf": token}, code: http.StatusNoContent},
+		{name: "cookies", cookie: map[string]string{"session": "woo", "csrf": token}, code: http.StatusNoContent},
+		{
+			name:   "stale header, valid cookie",
+			header: map[string]string{"session": "woo", "csrf": "%%%"},
+			cookie: map[string]string{"csrf": token},
+			code:   http.StatusNoContent,
+		},
+	} {
+		req := httptest.NewRequest("POST", "/submit", nil)
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		for k, v := range tc.cookie {
+			req.AddCookie(&http.Cookie{Name: k, Value: v})
+		}
+
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != tc.code {
+			t.Errorf("%s: expected a %d, got %d", tc.name, tc.code, res.StatusCode)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/token", nil)
+	req.Header.Set("session", "woo")
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued := res.Header.Get("csrf")
+	if err := p.Validate("woo", issued); err != nil {
+		t.Errorf("Issued token was invalid: %v", err)
+	}
+
+	if res.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected a no-store response, got %q", res.Header.Get("Cache-Control"))
+	}
+}
+
+func TestNewErrorHandlerAndNext(t *testing.T) {
+	var reasons []error
+	app := fiber.New()
+	app.Use(New(Config{
+		Params:        charlie.New([]byte("yay for dumbledore")),
+		CSRFHeader:    "csrf",
+		SessionHeader: "session",
+		Next: func(c *fiber.Ctx) bool {
+			return c.Path() == "/skipped"
+		},
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			reasons = append(reasons, err)
+			return fiber.ErrUnauthorized
+		},
+	}))
+	app.Post("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	for path, code := range map[string]int{
+		"/skipped": http.StatusNoContent,
+		"/submit":  http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("session", "woo")
+
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != code {
+			t.Errorf("Expected a %d for %s, got %d", code, path, res.StatusCode)
+		}
+	}
+
+	if len(reasons) != 1 || !errors.Is(reasons[0], charlie.ErrMissingToken) {
+		t.Errorf("Unexpected reasons: %v", reasons)
+	}
+}
@@ -0,0 +1,136 @@
+// Package charliegrpc provides gRPC server interceptors which check Charlie
+// tokens, so that gRPC-Web services called by browsers are protected as
+// handlers wrapped by charlie.HTTPParams are:
+//
+//	config := charliegrpc.Config{
+//		Params:        p,
+//		TokenKey:      "x-csrf-token",
+//		SessionCookie: "session",
+//	}
+//	s := grpc.NewServer(
+//		grpc.UnaryInterceptor(charliegrpc.UnaryServerInterceptor(config)),
+//		grpc.StreamInterceptor(charliegrpc.StreamServerInterceptor(config)),
+//	)
+//
+// Calls without a valid token fail with codes.PermissionDenied.
+package charliegrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/codahale/charlie"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Config is the configuration of the interceptors.
+type Config struct {
+	// Params validates tokens.
+	Params *charlie.Params
+
+	// TokenKey is the metadata key in which tokens are found, e.g.
+	// "x-csrf-token" for tokens sent in the X-CSRF-Token header. If it has
+	// several values, any may be valid.
+	TokenKey string
+
+	// SessionKey and SessionCookie name the metadata key and the cookie (in
+	// the "cookie" metadata, as gRPC-Web proxies pass on browsers' cookies)
+	// in which session IDs are found. The key is preferred.
+	SessionKey    string
+	SessionCookie string
+
+	// Exempt, if non-nil, returns true for the full names of methods (e.g.
+	// "/pkg.Service/Method") which are called without being checked, e.g.
+	// those which are safe.
+	Exempt func(fullMethod string) bool
+}
+
+// UnaryServerInterceptor returns an interceptor which checks unary calls.
+func UnaryServerInterceptor(config Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := config.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor which checks streaming calls
+// when they start.
+func StreamServerInterceptor(config Config) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := config.check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// check returns nil if the call has a valid token for its session, or else a
+// status error: PermissionDenied with the reason it's invalid,
+// Unavailable if a backend is, or Internal.
+func (config *Config) check(ctx context.Context, fullMethod string) error {
+	if config.Exempt != nil && config.Exempt(fullMethod) {
+		return nil
+	}
+
+	err := config.validate(ctx)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, charlie.ErrInvalidToken):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, charlie.ErrBackendUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	case status.Code(err) != codes.Unknown:
+		return err
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (config *Config) validate(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	id := config.sessionID(md)
+	if id == "" {
+		return charlie.ErrMissingSession
+	}
+
+	var tokens []string
+	if config.TokenKey != "" {
+		tokens = md.Get(config.TokenKey)
+	}
+	if len(tokens) == 0 {
+		return charlie.ErrMissingToken
+	}
+
+	var err error
+	for _, token := range tokens {
+		if e := config.Params.ValidateContext(ctx, id, token); e == nil {
+			return nil
+		} else if err == nil || !errors.Is(e, charlie.ErrInvalidToken) {
+			err = e
+		}
+	}
+	return err
+}
+
+func (config *Config) sessionID(md metadata.MD) string {
+	if config.SessionKey != "" {
+		if v := md.Get(config.SessionKey); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+
+	if config.SessionCookie != "" {
+		r := http.Request{Header: http.Header{"Cookie": md.Get("cookie")}}
+		if c, err := r.Cookie(config.SessionCookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package charliegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/codahale/charlie"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	p := charlie.New([]byte("yay for dumbledore"))
+	interceptor := UnaryServerInterceptor(Config{
+		Params:        p,
+		TokenKey:      "x-csrf-token",
+		SessionKey:    "x-session",
+		SessionCookie: "session",
+		Exempt: func(fullMethod string) bool {
+			return fullMethod == "/charlie.Test/Exempt"
+		},
+	})
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	token := p.Generate("woo")
+	for _, tc := range []struct {
+		method string
+		md     metadata.MD
+		code   codes.Code
+	}{
+		{md: metadata.Pairs("x-csrf-token", token), code: codes.PermissionDenied},
+		{md: metadata.Pairs("x-session", "woo"), code: codes.PermissionDenied},
+		{md: metadata.Pairs("x-session", "woo", "x-csrf-token", "%%%"), code: codes.PermissionDenied},
+		{md: metadata.Pairs("x-session", "yay", "x-csrf-token", token), code: codes.PermissionDenied},
+		{md: metadata.Pairs("x-session", "woo", "x-csrf-token", token), code: codes.OK},
+		{md: metadata.Pairs("cookie", "a=b; session=woo", "x-csrf-token", "%%%", "x-csrf-token", token), code: codes.OK},
+		{method: "/charlie.Test/Exempt", code: codes.OK},
+	} {
+		method := tc.method
+		if method == "" {
+			method = "/charlie.Test/Call"
+		}
+
+		ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+		res, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		if code := status.Code(err); code != tc.code {
+			t.Errorf("%s with %v: expected %v, got %v", method, tc.md, tc.code, err)
+		} else if err == nil && res != "ok" {
+			t.Errorf("Unexpected response: %v", res)
+		}
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	p := charlie.New([]byte("yay for dumbledore"))
+	p.Revoker = failingRevoker{}
+	interceptor := StreamServerInterceptor(Config{
+		Params:     p,
+		TokenKey:   "x-csrf-token",
+		SessionKey: "x-session",
+	})
+
+	called := false
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		called = true
+		return nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("x-session", "woo", "x-csrf-token", p.Generate("woo")))
+	err := interceptor(nil, &stream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/charlie.Test/Stream"}, handler)
+	if status.Code(err) != codes.Unavailable || called {
+		t.Errorf("Expected Unavailable without calling the handler, got %v", err)
+	}
+}
+
+type stream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+type failingRevoker struct{}
+
+func (failingRevoker) RevokedAt(ctx context.Context, id string) (time.Time, error) {
+	return time.Time{}, errors.New("unavailable")
+}
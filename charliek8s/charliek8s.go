@@ -0,0 +1,197 @@
+// Package charliek8s keeps the key of a charlie.Params in sync with a
+// Kubernetes Secret, so that rotating the Secret rotates the key without
+// restarting pods:
+//
+//	src := charliek8s.MountedSecret("/etc/csrf", "key")
+//	key, err := src.Key(ctx)
+//	if err != nil {
+//		return err
+//	}
+//
+//	p := charlie.New(key)
+//	go (&charliek8s.Watcher{Params: p, Source: src}).Run(ctx)
+//
+// Tokens generated with the previous key remain valid for an overlap window,
+// so that pods picking up the new key at different times don't reject each
+// other's tokens.
+package charliek8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codahale/charlie"
+)
+
+// A Source returns the current key.
+type Source interface {
+	Key(ctx context.Context) ([]byte, error)
+}
+
+// MountedSecret returns a Source which reads the given key of a Secret mounted
+// as a volume in the given directory. The kubelet updates mounted Secrets in
+// place when they change.
+func MountedSecret(dir, key string) Source {
+	return mountedSecret(filepath.Join(dir, key))
+}
+
+type mountedSecret string
+
+func (path mountedSecret) Key(ctx context.Context) ([]byte, error) {
+	return os.ReadFile(string(path))
+}
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// InClusterSecret returns a Source which reads the given key of the named
+// Secret from the Kubernetes API, authenticating with the pod's ServiceAccount,
+// which must be allowed to get the Secret. If namespace is empty, the pod's own
+// namespace is used.
+func InClusterSecret(namespace, name, key string) (Source, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("charliek8s: not running in a Kubernetes cluster")
+	}
+
+	if namespace == "" {
+		ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("charliek8s: invalid ServiceAccount CA certificate")
+	}
+
+	return &apiSecret{
+		url: "https://" + net.JoinHostPort(host, port) + "/api/v1/namespaces/" +
+			url.PathEscape(namespace) + "/secrets/" + url.PathEscape(name),
+		key:       key,
+		tokenFile: filepath.Join(serviceAccountDir, "token"),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+type apiSecret struct {
+	url, key, tokenFile string
+	client              *http.Client
+}
+
+func (s *apiSecret) Key(ctx context.Context) ([]byte, error) {
+	// ServiceAccount tokens are rotated, so are read for every request.
+	token, err := os.ReadFile(s.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("charliek8s: getting secret: %s", resp.Status)
+	}
+
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, err
+	}
+
+	key, ok := secret.Data[s.key]
+	if !ok || len(key) == 0 {
+		return nil, fmt.Errorf("charliek8s: secret has no key %q", s.key)
+	}
+	return key, nil
+}
+
+// A Watcher polls a Source for changes to the key, replacing the key of its
+// Params when it changes.
+type Watcher struct {
+	Params *charlie.Params
+	Source Source
+
+	// Interval is how often the Source is polled. It defaults to 10 seconds.
+	Interval time.Duration
+
+	// Overlap is how long tokens generated with a previous key remain valid.
+	// It defaults to the Params' MaxAge.
+	Overlap time.Duration
+
+	// OnError, if non-nil, is called with errors reading the key, including
+	// charlie.ErrShortKey if it's shorter than charlie.MinKeySize. The current
+	// key remains in use.
+	OnError func(err error)
+}
+
+// Run polls the Source until ctx is done, returning ctx's error.
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			w.poll(ctx)
+		}
+	}
+}
+
+func (w *Watcher) poll(ctx context.Context) {
+	key, err := w.Source.Key(ctx)
+	if err == nil && len(key) < charlie.MinKeySize {
+		err = fmt.Errorf("charliek8s: %w", charlie.ErrShortKey)
+	}
+
+	if err != nil {
+		if w.OnError != nil {
+			w.OnError(err)
+		}
+		return
+	}
+
+	overlap := w.Overlap
+	if overlap == 0 {
+		overlap = w.Params.MaxAge
+	}
+	w.Params.SetKey(key, overlap)
+}
@@ -0,0 +1,145 @@
+package charliek8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codahale/charlie"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "key"), []byte("one"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := MountedSecret(dir, "key")
+	key, err := src.Key(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := charlie.New(key)
+	old := p.Generate("woo")
+
+	w := &Watcher{Params: p, Source: src}
+	if err := os.WriteFile(filepath.Join(dir, "key"), []byte("ayellowsubmarine2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.poll(ctx)
+
+	if p.KeyID() != charlie.New([]byte("ayellowsubmarine2")).KeyID() {
+		t.Error("Expected the key to have been replaced")
+	}
+
+	if err := p.Validate("woo", old); err != nil {
+		t.Errorf("Token generated with the previous key was invalid: %v", err)
+	}
+
+	if err := charlie.New([]byte("ayellowsubmarine2")).Validate("woo", p.Generate("woo")); err != nil {
+		t.Errorf("Token wasn't generated with the new key: %v", err)
+	}
+}
+
+func TestWatcherError(t *testing.T) {
+	var errs []error
+	p := charlie.New([]byte("one"))
+	w := &Watcher{
+		Params:  p,
+		Source:  MountedSecret(t.TempDir(), "key"),
+		OnError: func(err error) { errs = append(errs, err) },
+	}
+	w.poll(context.Background())
+
+	if len(errs) != 1 {
+		t.Errorf("Expected an error, but got %v", errs)
+	}
+
+	if p.KeyID() != charlie.New([]byte("one")).KeyID() {
+		t.Error("Expected the key to be unchanged")
+	}
+}
+
+func TestWatcherShortKey(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "key"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []error
+	p := charlie.New([]byte("one"))
+	w := &Watcher{
+		Params:  p,
+		Source:  MountedSecret(dir, "key"),
+		OnError: func(err error) { errs = append(errs, err) },
+	}
+	w.poll(context.Background())
+
+	if len(errs) != 1 || !errors.Is(errs[0], charlie.ErrShortKey) {
+		t.Errorf("Errors were %v, but expected ErrShortKey", errs)
+	}
+
+	if p.KeyID() != charlie.New([]byte("one")).KeyID() {
+		t.Error("Expected the key to be unchanged")
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	w := &Watcher{
+		Params:   charlie.New([]byte("one")),
+		Source:   MountedSecret(t.TempDir(), "key"),
+		Interval: time.Millisecond,
+	}
+	if err := w.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Error was %v, but expected DeadlineExceeded", err)
+	}
+}
+
+func TestAPISecret(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/secrets/csrf" || r.Header.Get("Authorization") != "Bearer sa-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"key":"c2VjcmV0"}}`))
+	}))
+	defer s.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	src := &apiSecret{
+		url:       s.URL + "/api/v1/namespaces/default/secrets/csrf",
+		key:       "key",
+		tokenFile: tokenFile,
+		client:    s.Client(),
+	}
+
+	key, err := src.Key(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(key) != "secret" {
+		t.Errorf("Key was %q, but expected secret", key)
+	}
+
+	src.key = "other"
+	if _, err := src.Key(context.Background()); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+}
@@ -0,0 +1,161 @@
+// Package charlieotel records OpenTelemetry spans and metrics for the
+// validation of CSRF tokens by a charlie.HTTPParams, so that failures show up
+// in traces alongside the requests they rejected:
+//
+//	in, err := charlieotel.New(otel.GetTracerProvider(), otel.GetMeterProvider())
+//	if err != nil {
+//		return err
+//	}
+//	handler := in.Wrap(hp, mux)
+//
+// Each checked request gets a "charlie.csrf" span, which ends when the wrapped
+// handler is called or the request is rejected, with these attributes:
+//
+//   - charlie.outcome: "valid" or "invalid"
+//   - charlie.error: why the request was invalid, e.g. "invalid token: expired"
+//   - charlie.token_source: where the valid token was found, e.g. "header"
+//   - charlie.token_age: the age of the token in seconds, if it was authentic
+package charlieotel
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/codahale/charlie"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const name = "github.com/codahale/charlie/charlieotel"
+
+// Instrumentation records spans and metrics for middleware.
+type Instrumentation struct {
+	tracer      trace.Tracer
+	validations metric.Int64Counter
+	age         metric.Float64Histogram
+}
+
+// New returns Instrumentation which records spans with the given
+// TracerProvider and metrics with the given MeterProvider:
+//
+//   - charlie.validations, a counter of checked requests by outcome
+//   - charlie.token.age, a histogram of the ages of authentic tokens in seconds
+func New(tp trace.TracerProvider, mp metric.MeterProvider) (*Instrumentation, error) {
+	meter := mp.Meter(name)
+
+	validations, err := meter.Int64Counter("charlie.validations",
+		metric.WithDescription("The number of requests whose CSRF tokens were checked, by outcome."))
+	if err != nil {
+		return nil, err
+	}
+
+	age, err := meter.Float64Histogram("charlie.token.age",
+		metric.WithDescription("The ages of authentic CSRF tokens."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Instrumentation{
+		tracer:      tp.Tracer(name),
+		validations: validations,
+		age:         age,
+	}, nil
+}
+
+// Wrap returns hp.Wrap(h), instrumented. It sets hp's OnValid, OnInvalid, and
+// OnTokenSource hooks and, if set, its Params' OnValidate hook, calling any it
+// already has.
+func (in *Instrumentation) Wrap(hp *charlie.HTTPParams, h http.Handler) http.Handler {
+	in.instrument(hp)
+
+	inner := hp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if s, ok := ctx.Value(spanKey{}).(*span); ok {
+			// End the span before serving, and serve within the parent span, so
+			// that the span measures only the middleware.
+			s.end()
+			ctx = trace.ContextWithSpan(ctx, s.parent)
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent := trace.SpanFromContext(r.Context())
+		ctx, sp := in.tracer.Start(r.Context(), "charlie.csrf")
+		s := &span{Span: sp, parent: parent}
+		defer s.end()
+
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(ctx, spanKey{}, s)))
+	})
+}
+
+// instrument sets the hooks of the given middleware and its Params.
+func (in *Instrumentation) instrument(hp *charlie.HTTPParams) {
+	onValid, onInvalid, onTokenSource := hp.OnValid, hp.OnInvalid, hp.OnTokenSource
+
+	hp.OnValid = func(r *http.Request) {
+		in.outcome(r.Context(), "valid", nil)
+		if onValid != nil {
+			onValid(r)
+		}
+	}
+
+	hp.OnInvalid = func(r *http.Request, err error) {
+		in.outcome(r.Context(), "invalid", err)
+		if onInvalid != nil {
+			onInvalid(r, err)
+		}
+	}
+
+	hp.OnTokenSource = func(r *http.Request, source string) {
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("charlie.token_source", source))
+		if onTokenSource != nil {
+			onTokenSource(r, source)
+		}
+	}
+
+	if p := hp.Params; p != nil {
+		onValidate := p.OnValidate
+		p.OnValidate = func(ctx context.Context, v charlie.Validation) {
+			if !v.IssuedAt.IsZero() {
+				age := time.Since(v.IssuedAt).Seconds()
+				in.age.Record(ctx, age)
+				trace.SpanFromContext(ctx).SetAttributes(attribute.Float64("charlie.token_age", age))
+			}
+
+			if onValidate != nil {
+				onValidate(ctx, v)
+			}
+		}
+	}
+}
+
+// outcome records the outcome of checking a request.
+func (in *Instrumentation) outcome(ctx context.Context, outcome string, err error) {
+	attrs := []attribute.KeyValue{attribute.String("charlie.outcome", outcome)}
+	in.validations.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+	if err != nil {
+		attrs = append(attrs, attribute.String("charlie.error", err.Error()))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+type spanKey struct{}
+
+// span is the span of a request's check, which ends at most once.
+type span struct {
+	trace.Span
+	parent trace.Span
+	ended  bool
+}
+
+func (s *span) end() {
+	if !s.ended {
+		s.ended = true
+		s.End()
+	}
+}
@@ -0,0 +1,102 @@
+package charlieotel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codahale/charlie"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWrap(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	in, err := New(tp, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := charlie.New([]byte("yay for dumbledore"))
+	hp := &charlie.HTTPParams{
+		Params:        p,
+		CSRFHeader:    "csrf",
+		SessionHeader: "session",
+	}
+
+	var parent trace.Span
+	handler := in.Wrap(hp, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent = trace.SpanFromContext(r.Context())
+		w.WriteHeader(204)
+	}))
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("session", "woo")
+	req.Header.Set("csrf", p.Generate("woo"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req.Header.Set("csrf", "%%%")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("Expected a 403, got %d", res.Code)
+	}
+
+	if parent == nil || parent.SpanContext().IsValid() {
+		t.Error("Expected the handler to be served outside of the span")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(ended))
+	}
+
+	valid := attrs(ended[0].Attributes())
+	if valid["charlie.outcome"] != "valid" || valid["charlie.token_source"] != "header" ||
+		valid["charlie.token_age"] == "" {
+		t.Errorf("Unexpected attributes for a valid request: %v", valid)
+	}
+
+	invalid := attrs(ended[1].Attributes())
+	if invalid["charlie.outcome"] != "invalid" || invalid["charlie.error"] != charlie.ErrBadEncoding.Error() {
+		t.Errorf("Unexpected attributes for an invalid request: %v", invalid)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == "charlie.validations" {
+				for _, dp := range sum.DataPoints {
+					outcome, _ := dp.Attributes.Value("charlie.outcome")
+					counts[outcome.AsString()] += dp.Value
+				}
+			}
+		}
+	}
+
+	if counts["valid"] != 1 || counts["invalid"] != 1 {
+		t.Errorf("Unexpected charlie.validations: %v", counts)
+	}
+}
+
+func attrs(kvs []attribute.KeyValue) map[string]string {
+	m := map[string]string{}
+	for _, kv := range kvs {
+		m[string(kv.Key)] = kv.Value.Emit()
+	}
+	return m
+}
@@ -0,0 +1,140 @@
+// Package charlieprom exports Prometheus metrics for the tokens generated and
+// validated by a charlie.Params:
+//
+//	m, err := charlieprom.New(prometheus.DefaultRegisterer)
+//	if err != nil {
+//		return err
+//	}
+//	m.Instrument(p)
+//
+// Failed validations are counted by reason, e.g. "expired" or "bad_mac".
+package charlieprom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codahale/charlie"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the Prometheus metrics of token operations.
+type Metrics struct {
+	Generated        prometheus.Counter     // charlie_tokens_generated_total
+	Succeeded        prometheus.Counter     // charlie_validations_succeeded_total
+	Failed           *prometheus.CounterVec // charlie_validations_failed_total, by reason
+	GenerateDuration prometheus.Histogram   // charlie_generate_duration_seconds
+	ValidateDuration prometheus.Histogram   // charlie_validate_duration_seconds
+}
+
+// buckets range from 1µs to about a quarter of a second, since most tokens are
+// generated and validated in microseconds, but a Revoker or ReplayStore may
+// take a network round trip.
+var buckets = prometheus.ExponentialBuckets(1e-6, 4, 10)
+
+// New returns Metrics registered with the given Registerer.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		Generated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "charlie_tokens_generated_total",
+			Help: "The number of tokens generated.",
+		}),
+		Succeeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "charlie_validations_succeeded_total",
+			Help: "The number of tokens which were valid.",
+		}),
+		Failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "charlie_validations_failed_total",
+			Help: "The number of tokens which were invalid, by reason.",
+		}, []string{"reason"}),
+		GenerateDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "charlie_generate_duration_seconds",
+			Help:    "How long it took to generate tokens.",
+			Buckets: buckets,
+		}),
+		ValidateDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "charlie_validate_duration_seconds",
+			Help:    "How long it took to validate tokens.",
+			Buckets: buckets,
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.Generated, m.Succeeded, m.Failed, m.GenerateDuration, m.ValidateDuration,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Instrument records the metrics of the tokens generated and validated by the
+// given Params, in addition to calling any OnGenerate and OnValidate hooks it
+// already has.
+func (m *Metrics) Instrument(p *charlie.Params) {
+	onGenerate, onValidate := p.OnGenerate, p.OnValidate
+
+	p.OnGenerate = func(d time.Duration) {
+		m.Generated.Inc()
+		m.GenerateDuration.Observe(d.Seconds())
+		if onGenerate != nil {
+			onGenerate(d)
+		}
+	}
+
+	p.OnValidate = func(ctx context.Context, v charlie.Validation) {
+		m.observe(v.Err)
+		m.ValidateDuration.Observe(v.Duration.Seconds())
+		if onValidate != nil {
+			onValidate(ctx, v)
+		}
+	}
+}
+
+// InstrumentHTTP records the metrics of the given middleware's Params, which
+// must be set, and counts requests without a token or session as failed with
+// the reasons "missing_token" and "missing_session", in addition to calling
+// any OnInvalid hook it already has.
+func (m *Metrics) InstrumentHTTP(hp *charlie.HTTPParams) {
+	if hp.Params != nil {
+		m.Instrument(hp.Params)
+	}
+
+	onInvalid := hp.OnInvalid
+	hp.OnInvalid = func(r *http.Request, err error) {
+		if errors.Is(err, charlie.ErrMissingToken) || errors.Is(err, charlie.ErrMissingSession) {
+			m.observe(err)
+		}
+
+		if onInvalid != nil {
+			onInvalid(r, err)
+		}
+	}
+}
+
+func (m *Metrics) observe(err error) {
+	if err == nil {
+		m.Succeeded.Inc()
+		return
+	}
+	m.Failed.WithLabelValues(Reason(err)).Inc()
+}
+
+// Reason returns the label with which the given validation error is counted,
+// e.g. "bad_mac" for charlie.ReasonBadMAC.
+func Reason(err error) string {
+	var e *charlie.ValidationError
+	switch {
+	case errors.As(err, &e):
+		return strings.ReplaceAll(strings.ToLower(e.Reason.String()), " ", "_")
+	case errors.Is(err, charlie.ErrBackendUnavailable):
+		return "backend_unavailable"
+	case errors.Is(err, charlie.ErrInvalidToken):
+		return "invalid"
+	}
+	return "error"
+}
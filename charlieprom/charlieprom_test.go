@@ -0,0 +1,99 @@
+package charlieprom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codahale/charlie"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var validated int
+	p := charlie.New([]byte("yay for dumbledore"))
+	p.OnValidate = func(context.Context, charlie.Validation) { validated++ }
+	m.Instrument(p)
+
+	token := p.Generate("woo")
+	_ = p.Validate("woo", token)
+	_ = p.Validate("yay", token)
+	_ = p.Validate("woo", "%%%")
+
+	if v := testutil.ToFloat64(m.Generated); v != 1 {
+		t.Errorf("Generated was %v, but expected 1", v)
+	}
+
+	if v := testutil.ToFloat64(m.Succeeded); v != 1 {
+		t.Errorf("Succeeded was %v, but expected 1", v)
+	}
+
+	for reason, want := range map[string]float64{"bad_mac": 1, "bad_encoding": 1, "expired": 0} {
+		if v := testutil.ToFloat64(m.Failed.WithLabelValues(reason)); v != want {
+			t.Errorf("Failed{reason=%q} was %v, but expected %v", reason, v, want)
+		}
+	}
+
+	if n := testutil.CollectAndCount(m.ValidateDuration); n != 1 {
+		t.Errorf("Expected a validation histogram, got %d", n)
+	}
+
+	if validated != 3 {
+		t.Errorf("Existing OnValidate was called %d times, but expected 3", validated)
+	}
+
+	if _, err := New(reg); err == nil {
+		t.Error("Expected registering twice to fail")
+	}
+}
+
+func TestInstrumentHTTP(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hp := &charlie.HTTPParams{
+		Params:        charlie.New([]byte("yay for dumbledore")),
+		CSRFHeader:    "csrf",
+		SessionHeader: "session",
+	}
+	m.InstrumentHTTP(hp)
+	handler := hp.Wrap(http.NotFoundHandler())
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("session", "woo")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req.Header.Set("csrf", "%%%")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	for reason, want := range map[string]float64{"missing_token": 1, "bad_encoding": 1} {
+		if v := testutil.ToFloat64(m.Failed.WithLabelValues(reason)); v != want {
+			t.Errorf("Failed{reason=%q} was %v, but expected %v", reason, v, want)
+		}
+	}
+}
+
+func TestReason(t *testing.T) {
+	for err, want := range map[error]string{
+		charlie.ErrTokenExpired:  "expired",
+		charlie.ErrTokenReplayed: "replayed",
+		&charlie.ValidationError{Reason: charlie.ReasonWrongLength}: "wrong_length",
+		charlie.ErrInvalidToken: "invalid",
+		errors.New("woo"):       "error",
+	} {
+		if got := Reason(err); got != want {
+			t.Errorf("Reason(%v) was %q, but expected %q", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package charlieredis provides a charlie.ReplayStore backed by Redis, so that
+// each token can be redeemed only once across a fleet of servers:
+//
+//	p := charlie.New(key)
+//	p.Format = charlie.FormatBranca
+//	p.ReplayStore = &charlieredis.ReplayStore{Client: rdb}
+//
+// Tokens are recorded under a hash of their contents, and expire from Redis
+// when they would expire anyway.
+package charlieredis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A Client is the subset of a Redis client used by a ReplayStore. It's
+// implemented by redis.Client, redis.ClusterClient, and redis.UniversalClient.
+type Client interface {
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+}
+
+// A ReplayStore is a charlie.ReplayStore which records redeemed tokens in Redis.
+type ReplayStore struct {
+	Client Client
+
+	// Prefix is the prefix of the keys under which tokens are recorded. It
+	// defaults to "charlie:replay:".
+	Prefix string
+}
+
+// Seen implements charlie.ReplayStore. Tokens are recorded with SET NX, so of
+// concurrent redemptions of the same token, only one succeeds.
+func (s *ReplayStore) Seen(ctx context.Context, token string, expires time.Time) (bool, error) {
+	ttl := time.Until(expires)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	set, err := s.Client.SetNX(ctx, s.key(token), 1, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	return !set, nil
+}
+
+// key returns the Redis key under which the given token is recorded.
+func (s *ReplayStore) key(token string) string {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "charlie:replay:"
+	}
+
+	h := sha256.Sum256([]byte(token))
+	return prefix + base64.RawURLEncoding.EncodeToString(h[:])
+}
@@ -0,0 +1,65 @@
+package charlieredis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codahale/charlie"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeClient is an in-memory Client.
+type fakeClient struct {
+	keys map[string]time.Duration
+	err  error
+}
+
+func (c *fakeClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	if c.err != nil {
+		return redis.NewBoolResult(false, c.err)
+	}
+
+	if _, ok := c.keys[key]; ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	c.keys[key] = expiration
+	return redis.NewBoolResult(true, nil)
+}
+
+func TestReplayStore(t *testing.T) {
+	client := &fakeClient{keys: make(map[string]time.Duration)}
+	p := charlie.New([]byte("ayellowsubmarine"))
+	p.Format = charlie.FormatBranca
+	p.ReplayStore = &ReplayStore{Client: client}
+
+	token := p.Generate("woo")
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, charlie.ErrTokenReplayed) {
+		t.Errorf("Error was %v, but expected ErrTokenReplayed", err)
+	}
+
+	for key, ttl := range client.keys {
+		if !strings.HasPrefix(key, "charlie:replay:") || strings.Contains(key, token) {
+			t.Errorf("Unexpected key: %q", key)
+		}
+
+		if ttl <= 9*time.Minute || ttl > p.MaxAge {
+			t.Errorf("TTL was %v, but expected about %v", ttl, p.MaxAge)
+		}
+	}
+}
+
+func TestReplayStoreFailure(t *testing.T) {
+	p := charlie.New([]byte("ayellowsubmarine"))
+	p.ReplayStore = &ReplayStore{Client: &fakeClient{err: errors.New("connection refused")}}
+
+	if err := p.Validate("woo", p.Generate("woo")); !errors.Is(err, charlie.ErrBackendUnavailable) {
+		t.Errorf("Error was %v, but expected ErrBackendUnavailable", err)
+	}
+}
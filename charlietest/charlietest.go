@@ -0,0 +1,219 @@
+// Package charlietest provides a conformance suite for adapters which enforce
+// Charlie tokens, such as middleware for other web frameworks.
+//
+// An adapter which passes the suite behaves equivalently to HTTPParams.Wrap,
+// the reference middleware:
+//
+//	func TestConformance(t *testing.T) {
+//		charlietest.Run(t, func(hp *charlie.HTTPParams, h http.Handler) http.Handler {
+//			return myframework.Adapt(hp, h)
+//		})
+//	}
+package charlietest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codahale/charlie"
+)
+
+// An Adapter wraps an http.Handler with CSRF protection configured by the
+// given HTTPParams.
+type Adapter func(hp *charlie.HTTPParams, h http.Handler) http.Handler
+
+// Reference is the reference adapter, HTTPParams.Wrap.
+func Reference(hp *charlie.HTTPParams, h http.Handler) http.Handler {
+	return hp.Wrap(h)
+}
+
+const (
+	csrfHeader    = "X-CSRF-Token"
+	csrfCookie    = "csrf"
+	sessionHeader = "X-Session"
+	sessionCookie = "session"
+	sessionID     = "conformance"
+)
+
+var (
+	key     = []byte("charlie conformance suite")
+	oldKey  = []byte("charlie conformance suite, rotated out")
+	unknown = []byte("charlie conformance suite, never used")
+)
+
+// A behavior is a request and whether an adapter should accept it.
+type behavior struct {
+	name   string
+	req    func() *http.Request
+	accept bool
+}
+
+var behaviors = []behavior{
+	{
+		name: "valid pair in headers",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(csrfHeader, token(key, 0))
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+		accept: true,
+	},
+	{
+		name: "valid pair in cookies",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token(key, 0)})
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessionID})
+			return r
+		},
+		accept: true,
+	},
+	{
+		name: "safe method without token",
+		req: func() *http.Request {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+		accept: true,
+	},
+	{
+		name: "HEAD without token",
+		req: func() *http.Request {
+			r := httptest.NewRequest("HEAD", "/", nil)
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+		accept: true,
+	},
+	{
+		name: "OPTIONS without token",
+		req: func() *http.Request {
+			r := httptest.NewRequest("OPTIONS", "/", nil)
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+		accept: true,
+	},
+	{
+		name: "unsafe method without token",
+		req: func() *http.Request {
+			r := httptest.NewRequest("DELETE", "/", nil)
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+	},
+	{
+		name: "missing token",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+	},
+	{
+		name: "missing session",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(csrfHeader, token(key, 0))
+			return r
+		},
+	},
+	{
+		name: "wrong session",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(csrfHeader, token(key, 0))
+			r.Header.Set(sessionHeader, "someone else")
+			return r
+		},
+	},
+	{
+		name: "expired token",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(csrfHeader, token(key, 24*time.Hour))
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+	},
+	{
+		name: "malformed token",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(csrfHeader, "!"+token(key, 0))
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+	},
+	{
+		name: "token from a rotated key",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(csrfHeader, token(oldKey, 0))
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+		accept: true,
+	},
+	{
+		name: "token from an unknown key",
+		req: func() *http.Request {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set(csrfHeader, token(unknown, 0))
+			r.Header.Set(sessionHeader, sessionID)
+			return r
+		},
+	},
+}
+
+// Run runs the conformance suite against the given adapter, as a subtest per
+// behavior. The adapter must honor the HTTPParams' Key, OldKeys, CSRFHeader,
+// CSRFCookie, SessionHeader, and SessionCookie.
+func Run(t *testing.T, adapter Adapter) {
+	for _, b := range behaviors {
+		t.Run(b.name, func(t *testing.T) {
+			hp := &charlie.HTTPParams{
+				Key:           key,
+				OldKeys:       [][]byte{oldKey},
+				CSRFHeader:    csrfHeader,
+				CSRFCookie:    csrfCookie,
+				SessionHeader: sessionHeader,
+				SessionCookie: sessionCookie,
+			}
+
+			served := false
+			h := adapter(hp, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, b.req())
+
+			switch {
+			case b.accept && !served:
+				t.Errorf("Expected the request to be served, but it was rejected with a %d", w.Code)
+			case !b.accept && served:
+				t.Error("Expected the request to be rejected, but it was served")
+			case !b.accept && w.Code != http.StatusForbidden:
+				t.Errorf("Expected the request to be rejected with a 403, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// token returns a token for the session generated with the given key, the
+// given age ago.
+func token(key []byte, age time.Duration) string {
+	p, err := charlie.NewWithOptions(key, charlie.WithClock(func() time.Time {
+		return time.Now().Add(-age)
+	}))
+	if err != nil {
+		panic(err)
+	}
+	return p.Generate(sessionID)
+}
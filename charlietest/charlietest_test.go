@@ -0,0 +1,7 @@
+package charlietest
+
+import "testing"
+
+func TestReference(t *testing.T) {
+	Run(t, Reference)
+}
@@ -0,0 +1,265 @@
+// Package charlietraefik is a Traefik middleware plugin which enforces Charlie
+// tokens at the edge, using the same key and format as the Go applications
+// behind it.
+//
+// Traefik runs plugins in the Yaegi interpreter, which can't run the assembly
+// in Charlie's cryptographic dependencies, so this package reimplements token
+// validation for FormatCharlie (including FormatCharlieV2) and FormatJWT using
+// only the standard library.
+// Its tests check it against package charlie.
+//
+// A dynamic configuration might look like:
+//
+//	http:
+//	  middlewares:
+//	    csrf:
+//	      plugin:
+//	        charlie:
+//	          key: c2VjcmV0
+//	          csrfHeader: X-CSRF-Token
+//	          sessionCookie: session
+package charlietraefik
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config is the plugin's configuration. Its fields correspond to those of
+// charlie.Params and charlie.HTTPParams.
+type Config struct {
+	Key     string   `json:"key,omitempty"`     // Key is the base64-encoded key.
+	OldKeys []string `json:"oldKeys,omitempty"` // OldKeys are base64-encoded keys which are also accepted.
+	Format  string   `json:"format,omitempty"`  // Format is "charlie" (the default), "charlie-v2", or "jwt".
+	MaxAge  string   `json:"maxAge,omitempty"`  // MaxAge is the maximum age of tokens, e.g. "3h".
+
+	CSRFCookie string `json:"csrfCookie,omitempty"`
+	CSRFHeader string `json:"csrfHeader,omitempty"`
+
+	SessionCookie string `json:"sessionCookie,omitempty"`
+	SessionHeader string `json:"sessionHeader,omitempty"`
+}
+
+// CreateConfig returns the default configuration.
+func CreateConfig() *Config {
+	return &Config{
+		Format: "charlie",
+		MaxAge: "3h",
+	}
+}
+
+// Middleware only passes on requests with safe methods (GET, HEAD, OPTIONS,
+// and TRACE) or with a valid CSRF token.
+type Middleware struct {
+	next   http.Handler
+	config Config
+	keys   []key
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// key is a key which validates tokens, with its key ID.
+type key struct {
+	key     []byte
+	kid     string
+	kidByte byte
+}
+
+// newKey returns the key encoded in s, or false if it's invalid.
+func newKey(s string) (key, bool) {
+	k, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(k) == 0 {
+		return key{}, false
+	}
+
+	kid := mac(k, []byte("charlie/kid"))[:6]
+	return key{key: k, kid: base64.RawURLEncoding.EncodeToString(kid), kidByte: kid[0]}, true
+}
+
+// New returns a new Middleware.
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	k, ok := newKey(config.Key)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid key", name)
+	}
+
+	keys := []key{k}
+	for _, s := range config.OldKeys {
+		k, ok := newKey(s)
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid old key", name)
+		}
+		keys = append(keys, k)
+	}
+
+	maxAge, err := time.ParseDuration(config.MaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid maxAge: %w", name, err)
+	}
+
+	if config.Format != "charlie" && config.Format != "charlie-v2" && config.Format != "jwt" {
+		return nil, fmt.Errorf("%s: unsupported format: %q", name, config.Format)
+	}
+
+	return &Middleware{
+		next:   next,
+		config: *config,
+		keys:   keys,
+		maxAge: maxAge,
+		now:    time.Now,
+	}, nil
+}
+
+func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	id := value(r, m.config.SessionHeader, m.config.SessionCookie)
+	if id != "" {
+		for _, token := range values(r, m.config.CSRFHeader, m.config.CSRFCookie) {
+			if m.validate(id, token) == nil {
+				m.next.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+func (m *Middleware) validate(id, token string) error {
+	for _, k := range m.keys {
+		var err error
+		if m.config.Format == "jwt" {
+			err = m.validateJWT(k, id, token)
+		} else {
+			err = m.validateCharlie(k, id, token)
+		}
+
+		if err == nil {
+			return nil
+		}
+	}
+	return errInvalidToken
+}
+
+func (m *Middleware) validateCharlie(k key, id, token string) error {
+	data, err := base64.URLEncoding.DecodeString(token)
+	if err != nil || len(data) < 20 {
+		return errInvalidToken
+	}
+
+	// FormatCharlieV2 tokens have a version byte and a key ID byte.
+	header := data[:4]
+	if len(data) == 22 && data[0] == 0x02 {
+		if data[1] != k.kidByte {
+			return errInvalidToken
+		}
+		header, data = data[:6], data[2:]
+	}
+
+	if !hmac.Equal(mac(k.key, header, []byte(id))[:16], data[4:20]) {
+		return errInvalidToken
+	}
+	return m.checkAge(int64(binary.BigEndian.Uint32(data)), 0)
+}
+
+func (m *Middleware) validateJWT(k key, id, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(b, &header) != nil || header.Alg != "HS256" {
+		return errInvalidToken
+	}
+
+	if header.Kid != "" && header.Kid != k.kid {
+		return errInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac(k.key, []byte(parts[0]+"."+parts[1])), sig) {
+		return errInvalidToken
+	}
+
+	var claims struct {
+		IssuedAt int64  `json:"iat"`
+		Expires  int64  `json:"exp"`
+		Subject  string `json:"sub"`
+	}
+	b, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(b, &claims) != nil {
+		return errInvalidToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Subject), []byte(id)) != 1 {
+		return errInvalidToken
+	}
+	return m.checkAge(claims.IssuedAt, claims.Expires)
+}
+
+func (m *Middleware) checkAge(iat, exp int64) error {
+	now := m.now()
+	if (exp != 0 && now.After(time.Unix(exp, 0))) || now.Sub(time.Unix(iat, 0)) > m.maxAge {
+		return errInvalidToken
+	}
+	return nil
+}
+
+func mac(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// value returns the value of the given header or, failing that, cookie.
+func value(r *http.Request, header, cookie string) string {
+	if vs := values(r, header, cookie); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// values returns the non-empty values of the given header and cookie.
+func values(r *http.Request, header, cookie string) []string {
+	var vs []string
+	if header != "" {
+		for _, v := range r.Header.Values(header) {
+			if v != "" {
+				vs = append(vs, v)
+			}
+		}
+	}
+
+	if cookie != "" {
+		for _, c := range r.Cookies() {
+			if c.Name == cookie && c.Value != "" {
+				vs = append(vs, c.Value)
+			}
+		}
+	}
+	return vs
+}
@@ -0,0 +1,89 @@
+package charlietraefik
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/codahale/charlie"
+	"github.com/codahale/charlie/charlietest"
+)
+
+func adapter(format string) charlietest.Adapter {
+	return func(hp *charlie.HTTPParams, next http.Handler) http.Handler {
+		config := CreateConfig()
+		config.Key = base64.StdEncoding.EncodeToString(hp.Key)
+		for _, k := range hp.OldKeys {
+			config.OldKeys = append(config.OldKeys, base64.StdEncoding.EncodeToString(k))
+		}
+		config.Format = format
+		config.CSRFHeader = hp.CSRFHeader
+		config.CSRFCookie = hp.CSRFCookie
+		config.SessionHeader = hp.SessionHeader
+		config.SessionCookie = hp.SessionCookie
+
+		h, err := New(context.Background(), next, config, "charlie")
+		if err != nil {
+			panic(err)
+		}
+		return h
+	}
+}
+
+func TestConformance(t *testing.T) {
+	charlietest.Run(t, adapter("charlie"))
+}
+
+func TestCompatibility(t *testing.T) {
+	key := []byte("ayellowsubmarine")
+
+	for _, format := range []charlie.Format{charlie.FormatCharlie, charlie.FormatCharlieV2, charlie.FormatJWT} {
+		p := charlie.New(key)
+		p.Format = format
+		p.MaxAge = 3 * time.Hour
+
+		config := CreateConfig()
+		config.Key = base64.StdEncoding.EncodeToString(key)
+		config.Format = format.String()
+
+		h, err := New(context.Background(), http.NotFoundHandler(), config, "charlie")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := h.(*Middleware)
+
+		token := p.Generate("woo")
+		if err := m.validate("woo", token); err != nil {
+			t.Errorf("%v: token was invalid: %v", format, err)
+		}
+
+		if err := m.validate("yay", token); err == nil {
+			t.Errorf("%v: token was valid for the wrong session", format)
+		}
+
+		other := charlie.New([]byte("adifferentsubmarine"))
+		other.Format = format
+		if err := m.validate("woo", other.Generate("woo")); err == nil {
+			t.Errorf("%v: token with the wrong key was valid", format)
+		}
+
+		m.now = func() time.Time { return time.Now().Add(4 * time.Hour) }
+		if err := m.validate("woo", token); err == nil {
+			t.Errorf("%v: expired token was valid", format)
+		}
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	for _, config := range []*Config{
+		{Key: "", Format: "charlie", MaxAge: "1h"},
+		{Key: "c2VjcmV0", Format: "branca", MaxAge: "1h"},
+		{Key: "c2VjcmV0", Format: "charlie", MaxAge: "soon"},
+	} {
+		if _, err := New(context.Background(), http.NotFoundHandler(), config, "charlie"); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
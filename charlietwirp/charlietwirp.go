@@ -0,0 +1,57 @@
+// Package charlietwirp provides Twirp server hooks which check Charlie tokens,
+// so that Twirp services mounted alongside an app wrapped by
+// charlie.HTTPParams accept the same tokens:
+//
+//	hooks := charlietwirp.ServerHooks(p, charlie.WithSession(charlie.FromCookie("session")))
+//	server := pb.NewServiceServer(svc, twirp.WithServerHooks(hooks))
+//	mux.Handle(server.PathPrefix(), charlietwirp.WithRequest(server))
+//
+// Twirp doesn't give hooks the request's headers, so the server must be
+// wrapped with WithRequest. Calls without a valid token fail with
+// twirp.PermissionDenied.
+package charlietwirp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/codahale/charlie"
+	"github.com/twitchtv/twirp"
+)
+
+type requestKey struct{}
+
+// WithRequest wraps a Twirp server so that its hooks can read the headers and
+// cookies of the requests it serves.
+func WithRequest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestKey{}, r)))
+	})
+}
+
+// ServerHooks returns hooks which validate the token presented with each
+// request when it's received, as Params.ValidateRequest does with the given
+// options. Errors are returned as twirp.PermissionDenied for invalid tokens,
+// twirp.Unavailable if a backend is, or twirp.Internal.
+func ServerHooks(p *charlie.Params, opts ...charlie.RequestOption) *twirp.ServerHooks {
+	return &twirp.ServerHooks{
+		RequestReceived: func(ctx context.Context) (context.Context, error) {
+			r, ok := ctx.Value(requestKey{}).(*http.Request)
+			if !ok {
+				return ctx, twirp.InternalErrorWith(errors.New("charlietwirp: server not wrapped with WithRequest"))
+			}
+
+			err := p.ValidateRequest(r.WithContext(ctx), opts...)
+			switch {
+			case err == nil:
+				return ctx, nil
+			case errors.Is(err, charlie.ErrInvalidToken):
+				return ctx, twirp.NewError(twirp.PermissionDenied, err.Error())
+			case errors.Is(err, charlie.ErrBackendUnavailable):
+				return ctx, twirp.NewError(twirp.Unavailable, err.Error())
+			}
+			return ctx, twirp.InternalErrorWith(err)
+		},
+	}
+}
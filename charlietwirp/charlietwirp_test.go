@@ -0,0 +1,56 @@
+package charlietwirp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codahale/charlie"
+	"github.com/twitchtv/twirp"
+)
+
+func TestServerHooks(t *testing.T) {
+	p := charlie.New([]byte("yay for dumbledore"))
+	hooks := ServerHooks(p, charlie.WithSession(charlie.FromCookie("session")))
+
+	// Stand in for a Twirp server, which calls RequestReceived with the
+	// request's context.
+	var err error
+	handler := WithRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err = hooks.RequestReceived(r.Context())
+	}))
+
+	token := p.Generate("woo")
+	for _, tc := range []struct {
+		session, token string
+		code           twirp.ErrorCode
+	}{
+		{session: "woo", token: token},
+		{session: "woo", code: twirp.PermissionDenied},
+		{token: token, code: twirp.PermissionDenied},
+		{session: "yay", token: token, code: twirp.PermissionDenied},
+	} {
+		req := httptest.NewRequest("POST", "/twirp/charlie.Test/Call", nil)
+		if tc.session != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: tc.session})
+		}
+		if tc.token != "" {
+			req.Header.Set("X-CSRF-Token", tc.token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		var terr twirp.Error
+		switch {
+		case tc.code == "" && err != nil:
+			t.Errorf("Unexpected error: %v", err)
+		case tc.code != "" && (!errors.As(err, &terr) || terr.Code() != tc.code):
+			t.Errorf("Expected a %s error, got %v", tc.code, err)
+		}
+	}
+
+	if _, err := hooks.RequestReceived(context.Background()); err == nil {
+		t.Error("Expected an error without WithRequest")
+	}
+}
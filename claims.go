@@ -0,0 +1,106 @@
+package charlie
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var errMalformedClaims = errors.New("malformed claims")
+
+// Claims are the claims carried by a token, independent of its format.
+type Claims struct {
+	IssuedAt time.Time // IssuedAt is the time at which the token was issued.
+	Expires  time.Time // Expires is the time after which the token is invalid.
+	Subject  string    // Subject is the identity to which the token is bound.
+
+	// tag is the decoded MAC, signature, or AEAD tag which authenticated the
+	// token. Unlike the token itself, which may be encoded in many ways which
+	// all decode alike, it identifies the token for a ReplayStore.
+	tag string
+}
+
+// Protobuf field numbers and wire types, per charlie.proto.
+const (
+	protoIssuedAt = 1
+	protoExpires  = 2
+	protoSubject  = 3
+
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// MarshalProto returns the claims encoded as a charlie.v1.Claims protobuf
+// message, as defined in charlie.proto. Times are truncated to the second.
+func (c Claims) MarshalProto() []byte {
+	var b []byte
+	if v := c.IssuedAt.Unix(); !c.IssuedAt.IsZero() && v != 0 {
+		b = binary.AppendUvarint(b, protoIssuedAt<<3|protoVarint)
+		b = binary.AppendUvarint(b, uint64(v))
+	}
+
+	if v := c.Expires.Unix(); !c.Expires.IsZero() && v != 0 {
+		b = binary.AppendUvarint(b, protoExpires<<3|protoVarint)
+		b = binary.AppendUvarint(b, uint64(v))
+	}
+
+	if c.Subject != "" {
+		b = binary.AppendUvarint(b, protoSubject<<3|protoBytes)
+		b = binary.AppendUvarint(b, uint64(len(c.Subject)))
+		b = append(b, c.Subject...)
+	}
+	return b
+}
+
+// UnmarshalProto decodes a charlie.v1.Claims protobuf message, as defined in
+// charlie.proto. Unknown fields are ignored.
+func (c *Claims) UnmarshalProto(b []byte) error {
+	*c = Claims{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformedClaims
+		}
+		b = b[n:]
+
+		var v uint64
+		var data []byte
+		switch key & 7 {
+		case protoVarint:
+			v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errMalformedClaims
+			}
+			b = b[n:]
+		case protoBytes:
+			v, n = binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < v {
+				return errMalformedClaims
+			}
+			data, b = b[n:n+int(v)], b[n+int(v):]
+		case protoFixed64, protoFixed32:
+			size := 8
+			if key&7 == protoFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errMalformedClaims
+			}
+			b = b[size:]
+		default:
+			return errMalformedClaims
+		}
+
+		switch key {
+		case protoIssuedAt<<3 | protoVarint:
+			c.IssuedAt = time.Unix(int64(v), 0)
+		case protoExpires<<3 | protoVarint:
+			c.Expires = time.Unix(int64(v), 0)
+		case protoSubject<<3 | protoBytes:
+			c.Subject = string(data)
+		}
+	}
+	return nil
+}
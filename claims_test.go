@@ -0,0 +1,65 @@
+package charlie
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestClaimsProtoRoundTrip(t *testing.T) {
+	c := Claims{
+		IssuedAt: time.Unix(1400000000, 0),
+		Expires:  time.Unix(1400000600, 0),
+		Subject:  "woo",
+	}
+
+	var v Claims
+	if err := v.UnmarshalProto(c.MarshalProto()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.IssuedAt.Equal(c.IssuedAt) || !v.Expires.Equal(c.Expires) || v.Subject != c.Subject {
+		t.Errorf("Claims were %+v, but expected %+v", v, c)
+	}
+}
+
+func TestClaimsProtoEncoding(t *testing.T) {
+	b := Claims{IssuedAt: time.Unix(150, 0), Subject: "woo"}.MarshalProto()
+	want := []byte{0x08, 0x96, 0x01, 0x1a, 0x03, 'w', 'o', 'o'}
+
+	if !bytes.Equal(b, want) {
+		t.Errorf("Encoding was %x, but expected %x", b, want)
+	}
+}
+
+func TestClaimsProtoUnknownFields(t *testing.T) {
+	b := []byte{
+		0x1a, 0x03, 'w', 'o', 'o', // subject
+		0x20, 0x01, // field 4, varint
+		0x2d, 0x01, 0x02, 0x03, 0x04, // field 5, fixed32
+		0x32, 0x01, 'x', // field 6, bytes
+	}
+
+	var c Claims
+	if err := c.UnmarshalProto(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Subject != "woo" {
+		t.Errorf("Subject was %q, but expected %q", c.Subject, "woo")
+	}
+}
+
+func TestClaimsProtoMalformed(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x08},             // missing varint
+		{0x1a, 0x05, 'w'},  // truncated string
+		{0x0b},             // start group
+		{0x29, 0x01, 0x02}, // truncated fixed64
+	} {
+		var c Claims
+		if err := c.UnmarshalProto(b); err != errMalformedClaims {
+			t.Errorf("Error for %x was %v, but expected errMalformedClaims", b, err)
+		}
+	}
+}
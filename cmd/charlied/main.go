@@ -0,0 +1,67 @@
+// Command charlied is a sidecar which generates and validates Charlie tokens
+// over HTTP on a Unix-domain socket. See package charlied for its API. Sending
+// it SIGHUP reloads the key file; tokens generated with the previous key remain
+// valid for -max-age.
+//
+//	charlied -socket /run/charlied.sock -key-file /etc/charlied/key
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/codahale/charlie"
+	"github.com/codahale/charlie/charlied"
+)
+
+func main() {
+	var (
+		socket  = flag.String("socket", "/run/charlied.sock", "the path of the Unix-domain socket")
+		keyFile = flag.String("key-file", "", "the path of the file containing the key")
+		maxAge  = flag.Duration("max-age", 10*time.Minute, "the maximum age of tokens")
+		format  = flag.String("format", charlie.FormatCharlie.String(), "the wire format of tokens")
+	)
+	flag.Parse()
+
+	key, err := os.ReadFile(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := parseFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := charlie.New(key)
+	p.MaxAge = *maxAge
+	p.Format = f
+
+	rl := &charlie.Reloader{
+		Params:  p,
+		KeyFile: *keyFile,
+		OnReload: func(err error) {
+			if err != nil {
+				log.Printf("Unable to reload the key: %v", err)
+				return
+			}
+			log.Printf("Reloaded the key, now %s", p.KeyID())
+		},
+	}
+	go func() { _ = rl.Run(context.Background()) }()
+
+	log.Fatal(charlied.ListenAndServe(*socket, p))
+}
+
+func parseFormat(s string) (charlie.Format, error) {
+	for f := charlie.FormatCharlie; f.String() != "unknown"; f++ {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format: %q", s)
+}
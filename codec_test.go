@@ -0,0 +1,97 @@
+package charlie
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.Codec = ProtoCodec{}
+	token := p.Generate("woo")
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Validate("yay", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestCodecClaims(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.Codec = ProtoCodec{}
+	p.timer = func() time.Time {
+		return time.Unix(1400000000, 0)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(p.Generate("woo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := ProtoCodec{}.UnmarshalClaims(b[:len(b)-macSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The subject is bound through the MAC, not disclosed in the token.
+	if c.IssuedAt.Unix() != 1400000000 || c.Expires.Unix() != 1400000600 || c.Subject != "" {
+		t.Errorf("Claims were %+v", c)
+	}
+
+	if bytes.Contains(b, []byte("woo")) {
+		t.Errorf("Token disclosed the subject: %q", b)
+	}
+}
+
+func TestCodecExpired(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.Codec = ProtoCodec{}
+	token := p.Generate("woo")
+
+	p.timer = func() time.Time {
+		return time.Now().Add(20 * time.Minute)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+// lenientCodec encodes only the issue time, and ignores trailing bytes.
+type lenientCodec struct{}
+
+func (lenientCodec) MarshalClaims(c Claims) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(c.IssuedAt.Unix()))
+}
+
+func (lenientCodec) UnmarshalClaims(b []byte) (Claims, error) {
+	if len(b) < 8 {
+		return Claims{}, ErrBadEncoding
+	}
+	return Claims{IssuedAt: time.Unix(int64(binary.BigEndian.Uint64(b)), 0)}, nil
+}
+
+func TestCodecBoundary(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	p.Codec = lenientCodec{}
+
+	b, err := base64.RawURLEncoding.DecodeString(p.Generate("12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving the first byte of the identity into the claims keeps the
+	// MAC's input the same, unless the claims are length-prefixed.
+	claims, mac := b[:len(b)-macSize], b[len(b)-macSize:]
+	forged := append(append(append([]byte{}, claims...), '1'), mac...)
+	if err := p.Validate("2", base64.RawURLEncoding.EncodeToString(forged)); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+}
@@ -0,0 +1,270 @@
+package charlie
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Config is the effective configuration of a Params, for logging at startup or
+// serving from a diagnostics endpoint. It identifies keys only by their IDs,
+// never including the keys themselves.
+type Config struct {
+	KeyID          string   `json:"key_id"`
+	PreviousKeyIDs []string `json:"previous_key_ids,omitempty"`
+	IdleKeyTimeout string   `json:"idle_key_timeout,omitempty"`
+	Format         string   `json:"format"`
+	Hash           string   `json:"hash"`
+	AcceptHashes   []string `json:"accept_hashes,omitempty"`
+	MACSize        int      `json:"mac_size"`
+	Codec          string   `json:"codec,omitempty"`
+	MaxAge         string   `json:"max_age"`
+	SoftMaxAge     string   `json:"soft_max_age,omitempty"`
+	BatchWindow    string   `json:"batch_window,omitempty"`
+	MaxClockSkew   string   `json:"max_clock_skew,omitempty"`
+	Environment    string   `json:"environment,omitempty"`
+	Generations    bool     `json:"generations"`
+	Revoker        bool     `json:"revoker"`
+	ReplayStore    bool     `json:"replay_store"`
+	BackendPolicy  string   `json:"backend_policy"`
+}
+
+// Config returns the effective configuration of the Params.
+func (p *Params) Config() Config {
+	ks := p.keys.load()
+	c := Config{
+		KeyID:         ks.current.kid,
+		Format:        p.Format.String(),
+		Hash:          p.Hash.String(),
+		MACSize:       p.macSize(),
+		MaxAge:        p.MaxAge.String(),
+		Environment:   p.Environment,
+		Generations:   p.GenerationFunc != nil,
+		Revoker:       p.Revoker != nil,
+		ReplayStore:   p.ReplayStore != nil,
+		BackendPolicy: p.BackendPolicy.String(),
+	}
+
+	for _, h := range p.AcceptHashes {
+		c.AcceptHashes = append(c.AcceptHashes, h.String())
+	}
+
+	for _, sk := range ks.previous {
+		c.PreviousKeyIDs = append(c.PreviousKeyIDs, sk.kid)
+	}
+
+	if p.Codec != nil {
+		c.Codec = fmt.Sprintf("%T", p.Codec)
+	}
+
+	if p.IdleKeyTimeout != 0 {
+		c.IdleKeyTimeout = p.IdleKeyTimeout.String()
+	}
+
+	if p.SoftMaxAge != 0 {
+		c.SoftMaxAge = p.SoftMaxAge.String()
+	}
+
+	if p.BatchWindow != 0 {
+		c.BatchWindow = p.BatchWindow.String()
+	}
+
+	if p.MaxClockSkew != 0 {
+		c.MaxClockSkew = p.MaxClockSkew.String()
+	}
+	return c
+}
+
+// MarshalJSON returns the effective configuration of the middleware as JSON,
+// including that of the Params it validates tokens with. Keys are identified
+// only by their IDs, and functions and handlers only by whether they're set.
+func (hp *HTTPParams) MarshalJSON() ([]byte, error) {
+	c := httpConfig{
+		Params:              hp.params().Config(),
+		CSRFHeader:          hp.CSRFHeader,
+		CSRFCookie:          hp.CSRFCookie,
+		CSRFFormField:       hp.CSRFFormField,
+		CSRFJSONField:       hp.CSRFJSONField,
+		TokenExtractors:     tokenSources(hp.TokenExtractors),
+		SessionHeader:       hp.SessionHeader,
+		SessionCookie:       hp.SessionCookie,
+		SessionExtractors:   len(hp.SessionExtractors),
+		SessionFunc:         hp.SessionFunc != nil,
+		DoubleSubmit:        hp.DoubleSubmit,
+		MissingStatusCode:   hp.MissingStatusCode,
+		InvalidStatusCode:   hp.InvalidStatusCode,
+		InvalidContentTypes: hp.InvalidContentTypes,
+		ExemptPaths:         hp.ExemptPaths,
+		BindRequest:         hp.BindRequest,
+		InvalidHandler:      hp.InvalidHandler != nil,
+		ErrorHandler:        hp.ErrorHandler != nil,
+		WebSocketQuery:      hp.WebSocketQuery,
+		LegacyValidator:     hp.LegacyValidator != nil,
+		OnValid:             hp.OnValid != nil,
+		OnInvalid:           hp.OnInvalid != nil,
+		ChainCookie:         hp.ChainCookie,
+		StaleHeader:         hp.StaleHeader,
+		CrossOrigin:         hp.CrossOriginProtection != nil,
+		RejectCrossSite:     hp.RejectCrossSite,
+		TrustSameOrigin:     hp.TrustSameOrigin,
+		TrustedOrigins:      hp.TrustedOrigins,
+		SafeMethods:         hp.SafeMethods,
+		EnforceIf:           hp.EnforceIf != nil,
+		ReportOnly:          hp.ReportOnly,
+		IssueHeader:         hp.IssueHeader,
+		IssueCookie:         hp.IssueCookie,
+		InsecureCookies:     hp.InsecureCookies,
+		InjectMeta:          hp.InjectMeta,
+		InjectForms:         hp.InjectForms,
+		TokenWriters:        len(hp.TokenWriters),
+		CacheControl:        hp.CacheControl,
+		RequestIDHeader:     hp.RequestIDHeader,
+		Logger:              hp.Logger != nil,
+		LogTokens:           hp.LogTokens,
+		RecoverPanics:       hp.RecoverPanics,
+	}
+
+	if hp.Policy != nil {
+		c.Policy = &policyConfig{
+			Rules:   len(hp.Policy.Rules),
+			Default: hp.Policy.Default.String(),
+		}
+	}
+
+	if c.SafeMethods == nil {
+		c.SafeMethods = defaultSafeMethods
+	}
+
+	if c.CacheControl == "" {
+		c.CacheControl = "no-store"
+	}
+
+	if hp.DoubleSubmit {
+		c.DoubleSubmitCookie = hp.doubleSubmitCookie()
+	}
+
+	if hp.PreviousSession != nil {
+		grace := hp.RotationGrace
+		if grace == 0 {
+			grace = defaultRotationGrace
+		}
+		c.RotationGrace = grace.String()
+	}
+
+	if hp.IssueLimit != nil {
+		c.IssueLimit = hp.IssueLimit.PerMinute
+	}
+
+	if hp.LogSampling != nil {
+		c.LogSampling = &samplingConfig{
+			Every: hp.LogSampling.Every,
+			First: hp.LogSampling.First,
+		}
+	}
+
+	for _, o := range hp.Overrides {
+		oc := overrideConfig{
+			Path:              o.Path,
+			Pattern:           o.Pattern,
+			Match:             o.Match != nil,
+			Exempt:            o.Exempt,
+			Audience:          o.Audience,
+			InvalidHandler:    o.InvalidHandler != nil,
+			MissingStatusCode: o.MissingStatusCode,
+			InvalidStatusCode: o.InvalidStatusCode,
+			CSRFHeader:        o.CSRFHeader,
+			CSRFCookie:        o.CSRFCookie,
+			TokenExtractors:   tokenSources(o.TokenExtractors),
+		}
+		if o.MaxAge != 0 {
+			oc.MaxAge = o.MaxAge.String()
+		}
+		c.Overrides = append(c.Overrides, oc)
+	}
+
+	return json.Marshal(c)
+}
+
+// tokenSources returns the sources of the given Extractors.
+func tokenSources(extractors []Extractor) []string {
+	var sources []string
+	for _, e := range extractors {
+		sources = append(sources, e.Source)
+	}
+	return sources
+}
+
+type httpConfig struct {
+	Params              Config           `json:"params"`
+	CSRFHeader          string           `json:"csrf_header,omitempty"`
+	CSRFCookie          string           `json:"csrf_cookie,omitempty"`
+	CSRFFormField       string           `json:"csrf_form_field,omitempty"`
+	CSRFJSONField       string           `json:"csrf_json_field,omitempty"`
+	TokenExtractors     []string         `json:"token_extractors,omitempty"`
+	SessionHeader       string           `json:"session_header,omitempty"`
+	SessionCookie       string           `json:"session_cookie,omitempty"`
+	SessionExtractors   int              `json:"session_extractors,omitempty"`
+	SessionFunc         bool             `json:"session_func"`
+	DoubleSubmit        bool             `json:"double_submit"`
+	DoubleSubmitCookie  string           `json:"double_submit_cookie,omitempty"`
+	MissingStatusCode   int              `json:"missing_status_code,omitempty"`
+	InvalidStatusCode   int              `json:"invalid_status_code,omitempty"`
+	InvalidContentTypes []string         `json:"invalid_content_types,omitempty"`
+	InvalidHandler      bool             `json:"invalid_handler"`
+	ErrorHandler        bool             `json:"error_handler"`
+	WebSocketQuery      string           `json:"web_socket_query,omitempty"`
+	LegacyValidator     bool             `json:"legacy_validator"`
+	OnValid             bool             `json:"on_valid"`
+	OnInvalid           bool             `json:"on_invalid"`
+	RotationGrace       string           `json:"rotation_grace,omitempty"`
+	ExemptPaths         []string         `json:"exempt_paths,omitempty"`
+	BindRequest         bool             `json:"bind_request"`
+	Overrides           []overrideConfig `json:"overrides,omitempty"`
+	ChainCookie         string           `json:"chain_cookie,omitempty"`
+	StaleHeader         string           `json:"stale_header,omitempty"`
+	CrossOrigin         bool             `json:"cross_origin_protection"`
+	RejectCrossSite     bool             `json:"reject_cross_site"`
+	TrustSameOrigin     bool             `json:"trust_same_origin"`
+	TrustedOrigins      []string         `json:"trusted_origins,omitempty"`
+	SafeMethods         []string         `json:"safe_methods"`
+	EnforceIf           bool             `json:"enforce_if"`
+	Policy              *policyConfig    `json:"policy,omitempty"`
+	ReportOnly          bool             `json:"report_only"`
+	IssueHeader         string           `json:"issue_header,omitempty"`
+	IssueCookie         string           `json:"issue_cookie,omitempty"`
+	InsecureCookies     bool             `json:"insecure_cookies,omitempty"`
+	InjectMeta          string           `json:"inject_meta,omitempty"`
+	InjectForms         bool             `json:"inject_forms"`
+	TokenWriters        int              `json:"token_writers,omitempty"`
+	IssueLimit          int              `json:"issue_limit_per_minute,omitempty"`
+	CacheControl        string           `json:"cache_control,omitempty"`
+	RequestIDHeader     string           `json:"request_id_header,omitempty"`
+	Logger              bool             `json:"logger"`
+	LogTokens           bool             `json:"log_tokens"`
+	LogSampling         *samplingConfig  `json:"log_sampling,omitempty"`
+	RecoverPanics       bool             `json:"recover_panics"`
+}
+
+type overrideConfig struct {
+	Path              string   `json:"path,omitempty"`
+	Pattern           string   `json:"pattern,omitempty"`
+	Match             bool     `json:"match"`
+	Exempt            bool     `json:"exempt"`
+	Audience          string   `json:"audience,omitempty"`
+	MaxAge            string   `json:"max_age,omitempty"`
+	InvalidHandler    bool     `json:"invalid_handler"`
+	MissingStatusCode int      `json:"missing_status_code,omitempty"`
+	InvalidStatusCode int      `json:"invalid_status_code,omitempty"`
+	CSRFHeader        string   `json:"csrf_header,omitempty"`
+	CSRFCookie        string   `json:"csrf_cookie,omitempty"`
+	TokenExtractors   []string `json:"token_extractors,omitempty"`
+}
+
+type policyConfig struct {
+	Rules   int    `json:"rules"`
+	Default string `json:"default"`
+}
+
+type samplingConfig struct {
+	Every int `json:"every"`
+	First int `json:"first"`
+}
@@ -0,0 +1,75 @@
+package charlie
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatJWT
+	p.SetKey([]byte("woo"), time.Minute)
+
+	c := p.Config()
+	if c.KeyID != New([]byte("woo")).KeyID() {
+		t.Errorf("KeyID was %q", c.KeyID)
+	}
+
+	if len(c.PreviousKeyIDs) != 1 || c.PreviousKeyIDs[0] != New([]byte("yay")).KeyID() {
+		t.Errorf("PreviousKeyIDs were %v", c.PreviousKeyIDs)
+	}
+
+	if c.Format != "jwt" || c.MaxAge != "10m0s" || c.BackendPolicy != "fail-closed" {
+		t.Errorf("Config was %+v", c)
+	}
+}
+
+func TestHTTPParamsMarshalJSON(t *testing.T) {
+	hp := &HTTPParams{
+		Key:           []byte("yay"),
+		CSRFHeader:    "X-CSRF-Token",
+		SessionCookie: "session",
+		Policy:        &Policy{Default: ReportOnly},
+		Overrides: []Override{
+			{Path: "/webhooks/", Exempt: true},
+		},
+		InvalidHandler: http.NotFoundHandler(),
+	}
+
+	b, err := json.Marshal(hp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(b), "yay") {
+		t.Errorf("Config included the key: %s", b)
+	}
+
+	var c httpConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Params.KeyID != New([]byte("yay")).KeyID() || c.Params.MaxAge != "3h0m0s" {
+		t.Errorf("Params were %+v", c.Params)
+	}
+
+	if c.CSRFHeader != "X-CSRF-Token" || c.SessionCookie != "session" || !c.InvalidHandler {
+		t.Errorf("Config was %s", b)
+	}
+
+	if c.Policy == nil || c.Policy.Default != "report-only" {
+		t.Errorf("Policy was %+v", c.Policy)
+	}
+
+	if len(c.Overrides) != 1 || !c.Overrides[0].Exempt || c.Overrides[0].Path != "/webhooks/" {
+		t.Errorf("Overrides were %+v", c.Overrides)
+	}
+
+	if c.CacheControl != "no-store" {
+		t.Errorf("CacheControl was %q", c.CacheControl)
+	}
+}
@@ -0,0 +1,130 @@
+package charlie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+)
+
+const (
+	coseMac0Tag = 17 // a tagged COSE_Mac0 message always begins with 0xD1
+
+	// COSE header labels.
+	coseKeyID = 4
+
+	// CWT claim keys.
+	cwtExpires  = 4
+	cwtIssuedAt = 6
+)
+
+// coseProtected is the protected header of every COSE_Mac0 message generated:
+// {1 (alg): 5 (HMAC 256/256)}.
+var coseProtected = []byte{0xa1, 0x01, 0x05}
+
+func (p *Params) generateCOSE(sk *signingKey, id string, now time.Time) string {
+	var claims []byte
+	claims = cborAppendHead(claims, cborMap, 2)
+	claims = cborAppendHead(claims, cborUint, cwtExpires)
+	claims = cborAppendHead(claims, cborUint, uint64(now.Add(p.MaxAge).Unix()))
+	claims = cborAppendHead(claims, cborUint, cwtIssuedAt)
+	claims = cborAppendHead(claims, cborUint, uint64(now.Unix()))
+
+	var msg []byte
+	msg = cborAppendHead(msg, cborTag, coseMac0Tag)
+	msg = cborAppendHead(msg, cborArray, 4)
+	msg = cborAppendBytes(msg, coseProtected)
+	msg = cborAppendHead(msg, cborMap, 1)
+	msg = cborAppendHead(msg, cborUint, coseKeyID)
+	msg = cborAppendBytes(msg, []byte(sk.kid))
+	msg = cborAppendBytes(msg, claims)
+	msg = cborAppendBytes(msg, coseMAC(p.keyFor(sk, id), claims, id))
+	return base64.RawURLEncoding.EncodeToString(msg)
+}
+
+func (p *Params) openCOSE(sk *signingKey, id, token string) (Claims, error) {
+	kid, claims, tag, err := splitCOSE(token)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if kid != nil && string(kid) != sk.kid {
+		return Claims{}, ErrUnknownKey
+	}
+
+	if !hmac.Equal(coseMAC(p.keyFor(sk, id), claims, id), tag) {
+		return Claims{}, ErrBadMAC
+	}
+
+	c, err := parseCWT(claims)
+	if err != nil {
+		return Claims{}, err
+	}
+	c.Subject, c.tag = id, string(tag)
+	return c, nil
+}
+
+// splitCOSE returns the key ID, claims, and tag of a COSE_Mac0 message.
+func splitCOSE(token string) (kid, claims, tag []byte, err error) {
+	msg, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, nil, nil, ErrBadEncoding
+	}
+
+	r := newCBORReader(msg)
+	if r.expect(cborTag) != coseMac0Tag || r.expect(cborArray) != 4 {
+		return nil, nil, nil, ErrBadEncoding
+	}
+
+	protected := r.bytes(cborBytes)
+	for n := r.expect(cborMap); n > 0 && r.ok; n-- {
+		if r.expect(cborUint) == coseKeyID {
+			kid = r.bytes(cborBytes)
+		} else {
+			r.skip()
+		}
+	}
+
+	claims = r.bytes(cborBytes)
+	tag = r.bytes(cborBytes)
+	if !r.ok || len(r.b) != 0 || !hmac.Equal(protected, coseProtected) {
+		return nil, nil, nil, ErrBadEncoding
+	}
+	return kid, claims, tag, nil
+}
+
+// parseCWT returns the timestamps of the given CWT claims.
+func parseCWT(claims []byte) (Claims, error) {
+	var iat, exp uint64
+	r := newCBORReader(claims)
+	for n := r.expect(cborMap); n > 0 && r.ok; n-- {
+		switch r.expect(cborUint) {
+		case cwtExpires:
+			exp = r.expect(cborUint)
+		case cwtIssuedAt:
+			iat = r.expect(cborUint)
+		default:
+			r.skip()
+		}
+	}
+
+	if !r.ok {
+		return Claims{}, ErrBadEncoding
+	}
+	return Claims{IssuedAt: time.Unix(int64(iat), 0), Expires: time.Unix(int64(exp), 0)}, nil
+}
+
+// coseMAC returns the HMAC-SHA256 tag of a COSE_Mac0 message with the given
+// payload and the given user's identity as its external AAD.
+func coseMAC(key, payload []byte, id string) []byte {
+	var structure []byte
+	structure = cborAppendHead(structure, cborArray, 4)
+	structure = cborAppendText(structure, "MAC0")
+	structure = cborAppendBytes(structure, coseProtected)
+	structure = cborAppendBytes(structure, []byte(id))
+	structure = cborAppendBytes(structure, payload)
+
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write(structure)
+	return h.Sum(nil)
+}
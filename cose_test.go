@@ -0,0 +1,84 @@
+package charlie
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCOSERoundTrip(t *testing.T) {
+	p := formatParams(FormatCOSE)
+	token := p.Generate("woo")
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCOSEVersionByte(t *testing.T) {
+	b, err := base64.RawURLEncoding.DecodeString(formatParams(FormatCOSE).Generate("woo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := b[0], byte(0xd1); v != want {
+		t.Errorf("First byte was %#x, but expected %#x", v, want)
+	}
+}
+
+func TestCOSEWrongID(t *testing.T) {
+	p := formatParams(FormatCOSE)
+	token := p.Generate("woo")
+
+	if err := p.Validate("yay", token); !errors.Is(err, ErrBadMAC) {
+		t.Fatalf("Error was %v, but expected ErrBadMAC", err)
+	}
+}
+
+func TestCOSEUndisclosedID(t *testing.T) {
+	b, err := base64.RawURLEncoding.DecodeString(formatParams(FormatCOSE).Generate("woo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(b, []byte("woo")) {
+		t.Errorf("Token disclosed the user's identity: %x", b)
+	}
+}
+
+func TestCOSEExpired(t *testing.T) {
+	p := formatParams(FormatCOSE)
+	token := p.Generate("woo")
+
+	p.timer = func() time.Time {
+		return time.Now().Add(20 * time.Minute)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestCOSETruncated(t *testing.T) {
+	p := formatParams(FormatCOSE)
+	b, _ := base64.RawURLEncoding.DecodeString(p.Generate("woo"))
+
+	for i := range b {
+		token := base64.RawURLEncoding.EncodeToString(b[:i])
+		if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Error was %v for %d bytes, but expected ErrInvalidToken", err, i)
+		}
+	}
+}
+
+func TestCOSEUnknownKey(t *testing.T) {
+	token := formatParams(FormatCOSE).Generate("woo")
+
+	other := New([]byte("adifferentsubmarine"))
+	other.Format = FormatCOSE
+	if err := other.Validate("woo", token); err != ErrUnknownKey {
+		t.Fatalf("Error was %v, but expected ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,98 @@
+package charlie
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DebugHandler returns an http.Handler which diagnoses tokens, so that support
+// engineers can find out why a user's token was rejected. It takes the session
+// ID and token from the "id" and "token" form values, and responds with the
+// result of Inspect as JSON.
+//
+// Requests for which authorize returns false are rejected with a 403, as are
+// all requests if authorize is nil.
+func (p *Params) DebugHandler(authorize func(r *http.Request) bool) http.Handler {
+	return debugHandler(authorize, func(*http.Request) *Params { return p })
+}
+
+// DebugHandler returns a Params.DebugHandler which diagnoses tokens as Wrap
+// validates them, with the Params it would use for a request with the method
+// and path in the "method" and "path" form values (POST / by default): those
+// of matching Overrides, bound to the request if BindRequest is set, and
+// chained to the link in the "chain" form value if ChainCookie is set. In
+// double-submit mode, the ID is that in the client's DoubleSubmitCookie.
+func (hp *HTTPParams) DebugHandler(authorize func(r *http.Request) bool) http.Handler {
+	csrf := hp.params()
+	mux := hp.patternMux()
+	return debugHandler(authorize, func(r *http.Request) *Params {
+		target := r.Clone(r.Context())
+		target.Method, target.URL = http.MethodPost, &url.URL{Path: "/"}
+		if m := r.FormValue("method"); m != "" {
+			target.Method = m
+		}
+		if p := r.FormValue("path"); p != "" {
+			target.URL.Path = p
+		}
+
+		c := hp.route(target, csrf, mux).csrf
+		if hp.ChainCookie != "" {
+			c = c.chained(r.FormValue("chain"))
+		}
+		return hp.bindRequest(target, c)
+	})
+}
+
+// debugHandler returns a DebugHandler which inspects tokens with the Params
+// returned by params for each request.
+func debugHandler(authorize func(r *http.Request) bool, params func(r *http.Request) *Params) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		p := params(r)
+		info := p.Inspect(r.FormValue("id"), r.FormValue("token"))
+
+		resp := debugResponse{
+			Format:    info.Format.String(),
+			KeyID:     info.KeyID,
+			Authentic: info.Authentic,
+			Valid:     info.Valid,
+			Stale:     info.Stale,
+			MaxAge:    p.MaxAge.String(),
+		}
+
+		if info.Authentic {
+			resp.IssuedAt = &info.IssuedAt
+			resp.Expires = &info.Expires
+			resp.Age = info.Age.String()
+			resp.Remaining = info.Remaining.String()
+		}
+
+		if info.Err != nil {
+			resp.Reason = info.Err.Error()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+type debugResponse struct {
+	Format    string     `json:"format"`
+	KeyID     string     `json:"key_id,omitempty"`
+	Authentic bool       `json:"authentic"`
+	Valid     bool       `json:"valid"`
+	Stale     bool       `json:"stale,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	MaxAge    string     `json:"max_age"`
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	Age       string     `json:"age,omitempty"`
+	Remaining string     `json:"remaining,omitempty"`
+}
@@ -0,0 +1,122 @@
+package charlie
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDebugHandler(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	handler := p.DebugHandler(func(r *http.Request) bool {
+		return r.Header.Get("X-Admin") == "yes"
+	})
+
+	q := url.Values{"id": {"woo"}, "token": {p.Generate("woo")}}
+	req := httptest.NewRequest("GET", "/debug?"+q.Encode(), nil)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("Expected to receive a 403 without authorization, got %d", res.Code)
+	}
+
+	req.Header.Set("X-Admin", "yes")
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected to receive a 200 with authorization, got %d", res.Code)
+	}
+
+	var resp debugResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !resp.Authentic || !resp.Valid || resp.IssuedAt == nil || resp.Format != "charlie" ||
+		resp.KeyID != p.Config().KeyID {
+		t.Errorf("Response was %+v, but expected a valid token", resp)
+	}
+
+	q.Set("id", "yay")
+	req = httptest.NewRequest("GET", "/debug?"+q.Encode(), nil)
+	req.Header.Set("X-Admin", "yes")
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	resp = debugResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Authentic || resp.Valid || resp.Reason != "invalid token: bad MAC" || resp.IssuedAt != nil {
+		t.Errorf("Response was %+v, but expected an inauthentic token", resp)
+	}
+}
+
+func TestDebugHandlerNilAuthorize(t *testing.T) {
+	res := httptest.NewRecorder()
+	New([]byte("ayellowsubmarine")).DebugHandler(nil).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("Expected to receive a 403 without authorization, got %d", res.Code)
+	}
+}
+
+func TestHTTPDebugHandler(t *testing.T) {
+	v := HTTPParams{
+		Key:         []byte(testKey),
+		BindRequest: true,
+		ChainCookie: "csrf-chain",
+		Overrides:   []Override{{Path: "/short", MaxAge: time.Nanosecond}},
+	}
+	handler := v.DebugHandler(func(r *http.Request) bool { return true })
+
+	p := New(v.Key)
+	prev := p.Generate("woo")
+	token := p.chained(prev).GenerateFor("woo", RequestAction("DELETE", "/items/1"))
+
+	for _, tc := range []struct {
+		q     url.Values
+		valid bool
+	}{
+		{q: url.Values{"method": {"DELETE"}, "path": {"/items/1"}, "chain": {prev}}, valid: true},
+		{q: url.Values{"method": {"DELETE"}, "path": {"/items/2"}, "chain": {prev}}},
+		{q: url.Values{"method": {"DELETE"}, "path": {"/items/1"}}},
+		{q: url.Values{"chain": {prev}}},
+	} {
+		tc.q.Set("id", "woo")
+		tc.q.Set("token", token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest("GET", "/debug?"+tc.q.Encode(), nil))
+
+		var resp debugResponse
+		if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Valid != tc.valid {
+			t.Errorf("%v: response was %+v, but expected valid=%v", tc.q, resp, tc.valid)
+		}
+	}
+
+	// Overrides apply to the path being diagnosed.
+	q := url.Values{"id": {"woo"}, "token": {p.Generate("woo")}, "path": {"/short"}}
+	res := httptest.NewRecorder()
+	v.ChainCookie, v.BindRequest = "", false
+	v.DebugHandler(func(r *http.Request) bool { return true }).ServeHTTP(res, httptest.NewRequest("GET", "/debug?"+q.Encode(), nil))
+
+	var resp debugResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if !resp.Authentic || resp.Valid || resp.MaxAge != "1ns" {
+		t.Errorf("Response was %+v, but expected an expired token", resp)
+	}
+}
@@ -0,0 +1,192 @@
+package charlie
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// An Extractor extracts values, such as session IDs or tokens, from a single
+// source in a request, such as a header or a form field.
+type Extractor struct {
+	// Source names the source of the values (e.g. "header"), as reported to
+	// HTTPParams.OnTokenSource.
+	Source string
+
+	// Extract returns the values in the request, if any.
+	Extract func(r *http.Request) ([]string, error)
+}
+
+// ExtractorFunc returns an Extractor of the value returned by f from the named
+// source. f returns an empty string if the request doesn't contain one.
+func ExtractorFunc(source string, f func(r *http.Request) (string, error)) Extractor {
+	return Extractor{
+		Source: source,
+		Extract: func(r *http.Request) ([]string, error) {
+			v, err := f(r)
+			return nonEmpty(v), err
+		},
+	}
+}
+
+// FromHeader returns an Extractor which returns the values of the given header.
+func FromHeader(name string) Extractor {
+	return Extractor{
+		Source: "header",
+		Extract: func(r *http.Request) ([]string, error) {
+			return r.Header.Values(name), nil
+		},
+	}
+}
+
+// FromCookie returns an Extractor which returns the values of the cookies with
+// the given name, of which the request may carry several.
+func FromCookie(name string) Extractor {
+	return Extractor{
+		Source: "cookie",
+		Extract: func(r *http.Request) ([]string, error) {
+			var values []string
+			for _, c := range r.Cookies() {
+				if c.Name == name {
+					values = append(values, c.Value)
+				}
+			}
+			return values, nil
+		},
+	}
+}
+
+// FromBasicAuth returns an Extractor which returns the username from the
+// request's HTTP Basic Authentication credentials.
+func FromBasicAuth() Extractor {
+	return ExtractorFunc("basic_auth", func(r *http.Request) (string, error) {
+		user, _, _ := r.BasicAuth()
+		return user, nil
+	})
+}
+
+// FromJWTClaim returns an Extractor which returns the given claim from a JWT
+// bearer token in the given header (e.g. Authorization). String and numeric
+// claims are supported.
+//
+// It does not verify the JWT, so must only be used behind middleware which
+// does.
+func FromJWTClaim(header, claim string) Extractor {
+	return ExtractorFunc("jwt", func(r *http.Request) (string, error) {
+		v := r.Header.Get(header)
+		if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+			v = v[7:]
+		}
+
+		parts := strings.Split(v, ".")
+		if len(parts) != 3 {
+			return "", nil
+		}
+
+		b, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", nil
+		}
+
+		var claims map[string]json.RawMessage
+		if err := json.Unmarshal(b, &claims); err != nil {
+			return "", nil
+		}
+
+		var s string
+		var n json.Number
+		if err := json.Unmarshal(claims[claim], &s); err == nil {
+			return s, nil
+		} else if err := json.Unmarshal(claims[claim], &n); err == nil {
+			return n.String(), nil
+		}
+		return "", nil
+	})
+}
+
+// FromForm returns an Extractor which returns the given field of
+// application/x-www-form-urlencoded and multipart/form-data request bodies of
+// at most maxSize bytes (1MiB, if zero). The body is buffered and restored, so
+// the wrapped handler can still read it.
+func FromForm(field string, maxSize int64) Extractor {
+	return ExtractorFunc("form", func(r *http.Request) (string, error) {
+		return formValue(r, field, maxSize), nil
+	})
+}
+
+// FromQuery returns an Extractor which returns the values of the given query
+// parameter, e.g. for file download links. Tokens in URLs are prone to leaking
+// via logs and Referer headers, so should be short-lived.
+func FromQuery(param string) Extractor {
+	return Extractor{
+		Source: "query",
+		Extract: func(r *http.Request) ([]string, error) {
+			if r.URL == nil {
+				return nil, nil
+			}
+			return r.URL.Query()[param], nil
+		},
+	}
+}
+
+// FromJSON returns an Extractor which returns the given top-level string field
+// of JSON request bodies of at most maxSize bytes (1MiB, if zero). The body is
+// buffered and restored, so the wrapped handler can still read it.
+func FromJSON(field string, maxSize int64) Extractor {
+	return ExtractorFunc("json", func(r *http.Request) (string, error) {
+		return jsonValue(r, field, maxSize), nil
+	})
+}
+
+// extract returns the first non-empty value returned by the given Extractors.
+func extract(r *http.Request, extractors []Extractor) (string, error) {
+	for _, e := range extractors {
+		values, err := e.Extract(r)
+		if err != nil {
+			return "", err
+		}
+
+		for _, v := range values {
+			if v != "" {
+				return v, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// jsonValue returns the value of the given top-level string field in the
+// request's body, if it's a JSON object of at most max bytes (or MaxFormSize's
+// default, if max isn't positive). The body is restored afterwards.
+func jsonValue(r *http.Request, field string, max int64) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return ""
+	}
+
+	body, ok := readBody(r, max)
+	if !ok {
+		return ""
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+
+	var v string
+	if err := json.Unmarshal(fields[field], &v); err != nil {
+		return ""
+	}
+	return v
+}
+
+// nonEmpty returns a slice of the given value, or nil if it's empty.
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
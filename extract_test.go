@@ -0,0 +1,131 @@
+package charlie
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"jwt-user","uid":12345}`))
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	jwt := "Bearer " + header + "." + claims + ".sig"
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Session", "header-user")
+	req.Header.Set("X-JWT", jwt)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "cookie-user"})
+	req.SetBasicAuth("basic-user", "password")
+
+	for _, v := range []struct {
+		name string
+		e    Extractor
+		want string
+	}{
+		{"header", FromHeader("X-Session"), "header-user"},
+		{"missing header", FromHeader("X-Nope"), ""},
+		{"cookie", FromCookie("session"), "cookie-user"},
+		{"missing cookie", FromCookie("nope"), ""},
+		{"basic auth", FromBasicAuth(), "basic-user"},
+		{"jwt string claim", FromJWTClaim("X-JWT", "sub"), "jwt-user"},
+		{"jwt numeric claim", FromJWTClaim("X-JWT", "uid"), "12345"},
+		{"jwt missing claim", FromJWTClaim("X-JWT", "nope"), ""},
+		{"jwt malformed", FromJWTClaim("Authorization", "sub"), ""},
+	} {
+		got, err := extract(req, []Extractor{v.e})
+		if err != nil {
+			t.Errorf("%s: %v", v.name, err)
+		} else if got != v.want {
+			t.Errorf("%s: Value was %q, but expected %q", v.name, got, v.want)
+		}
+	}
+}
+
+func TestExtractOrder(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Second", "second")
+	req.Header.Set("X-Third", "third")
+
+	v, err := extract(req, []Extractor{FromHeader("X-First"), FromHeader("X-Second"), FromHeader("X-Third")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != "second" {
+		t.Errorf("Value was %q, but expected %q", v, "second")
+	}
+}
+
+func TestHTTPSessionExtractors(t *testing.T) {
+	v := HTTPParams{
+		Key:        []byte(testKey),
+		CSRFHeader: testCSRFHeader,
+		SessionExtractors: []Extractor{
+			FromHeader(testSessionHeader),
+			FromBasicAuth(),
+		},
+	}
+
+	token := New(v.Key).Generate("basic-user")
+	handler := v.Wrap(noContentHandler)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(testCSRFHeader, token)
+	req.SetBasicAuth("basic-user", "password")
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 with the basic auth user, got %d", res.Code)
+	}
+
+	// Earlier sources take priority
+	req.Header.Set(testSessionHeader, testSessionID)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected to receive a 403 with the session header, got %d", res.Code)
+	}
+}
+
+func TestHTTPSessionFunc(t *testing.T) {
+	v := HTTPParams{
+		Key:               []byte(testKey),
+		CSRFHeader:        testCSRFHeader,
+		SessionCookie:     testSessionCookie,
+		SessionExtractors: []Extractor{FromHeader(testSessionHeader)},
+		SessionFunc: func(r *http.Request) (string, error) {
+			if r.Header.Get("Authorization") == "" {
+				return "", errors.New("no authorization")
+			}
+			return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), nil
+		},
+	}
+
+	token := New(v.Key).Generate("func-user")
+	handler := v.Wrap(noContentHandler)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(testCSRFHeader, token)
+	req.Header.Set("Authorization", "Bearer func-user")
+	req.Header.Set(testSessionHeader, testSessionID)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 with the SessionFunc's session, got %d", res.Code)
+	}
+
+	// Errors mean there's no session
+	req.Header.Del("Authorization")
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected to receive a 403 without a session, got %d", res.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package charlie
+
+// Format is a wire format for tokens. Whatever the format, a token carries the
+// same information: the time it was issued, bound to the user's identity.
+type Format int
+
+const (
+	// FormatCharlie is Charlie's own compact binary format. It is the default.
+	FormatCharlie Format = iota
+
+	// FormatJWT is a compact JWT signed with HS256, carrying the iat, exp, and
+	// sub claims.
+	FormatJWT
+
+	// FormatPASETOLocal is a PASETO v4.local token, carrying the iat, exp, and
+	// sub claims. Its key is HMAC-SHA256(key, "charlie/paseto/v4.local").
+	FormatPASETOLocal
+
+	// FormatPASETOPublic is a PASETO v4.public token, carrying the iat and exp
+	// claims. Its claims are signed but not encrypted, so rather than a sub
+	// claim, the user's identity is bound through its implicit assertion,
+	// PAE(Environment, identity), to which tokens scoped to an audience,
+	// action, or chain link append those. It's signed with an Ed25519 key derived from
+	// the key, the public half of which is returned by Params.PublicKey. A
+	// Verifier validates them with only the public half.
+	FormatPASETOPublic
+
+	// FormatBranca is a Branca token, encrypted with XChaCha20-Poly1305 and
+	// encoded in base62. Its payload is the user's identity, which Params.Open
+	// returns. If the key is 32 bytes long, it's the Branca key, so other
+	// Branca implementations can open tokens; otherwise, or if the Params bind
+	// anything else to tokens (an Environment, a generation, an action, or a
+	// chain), the Branca key is HMAC-SHA256(bound key, "charlie/branca"),
+	// where the bound key is derived as for the other formats.
+	FormatBranca
+
+	// FormatCOSE is a tagged COSE_Mac0 message using HMAC 256/256, carrying
+	// the iat and exp CWT claims, for clients which prefer CBOR to JSON. The
+	// user's identity is its external AAD, so it's bound to the token without
+	// being disclosed by it.
+	// Its first byte is always 0xD1 (CBOR tag 17), which distinguishes it from
+	// the other binary formats.
+	FormatCOSE
+
+	// FormatCharlieV2 is FormatCharlie, prefixed with a version byte (0x02)
+	// and the first byte of the key's ID, so that when several keys are
+	// accepted, each token is only validated with the key which generated it.
+	// Tokens are 32 bytes long. Codec is ignored. Params using FormatCharlie,
+	// FormatCharlieV2, or FormatCharlieV3 accept tokens in all three, so
+	// deployments can switch between them without rejecting outstanding
+	// tokens.
+	FormatCharlieV2
+
+	// FormatCharlieV3 is FormatCharlieV2 with a version byte of 0x03 and a
+	// 64-bit timestamp in nanoseconds, which won't overflow in 2038. Tokens
+	// are 36 bytes long. Codec is ignored.
+	FormatCharlieV3
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatCharlie:
+		return "charlie"
+	case FormatJWT:
+		return "jwt"
+	case FormatPASETOLocal:
+		return "paseto-v4-local"
+	case FormatPASETOPublic:
+		return "paseto-v4-public"
+	case FormatBranca:
+		return "branca"
+	case FormatCOSE:
+		return "cose"
+	case FormatCharlieV2:
+		return "charlie-v2"
+	case FormatCharlieV3:
+		return "charlie-v3"
+	}
+	return "unknown"
+}
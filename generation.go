@@ -0,0 +1,64 @@
+package charlie
+
+import "strconv"
+
+// generation returns the user's current generation, or zero if generations
+// aren't in use.
+func (p *Params) generation(id string) uint32 {
+	if p.GenerationFunc == nil {
+		return 0
+	}
+	return p.GenerationFunc(id)
+}
+
+// keyFor returns the key which authenticates the given user's tokens.
+func (p *Params) keyFor(sk *signingKey, id string) []byte {
+	key, _ := p.boundKey(sk, id)
+	return key
+}
+
+// boundKey returns the key which authenticates the given user's tokens, and
+// whether it was derived from the given key. Each generation after the first
+// has its own key, so bumping a user's generation invalidates all of their
+// outstanding tokens. Likewise, each environment, each audience, each action,
+// and each link of a chain has its own key.
+func (p *Params) boundKey(sk *signingKey, id string) ([]byte, bool) {
+	if b := p.bound; b != nil && b.sk == sk && b.id == id {
+		return b.key, b.derived
+	}
+
+	key, derived := sk.key, false
+	if p.Environment != "" {
+		key, derived = deriveKey(key, "charlie/environment/"+p.Environment), true
+	}
+
+	if p.audience != "" {
+		key, derived = deriveKey(key, "charlie/audience/"+p.audience), true
+	}
+
+	if gen := p.generation(id); gen != 0 {
+		key, derived = deriveKey(key, "charlie/generation/"+strconv.FormatUint(uint64(gen), 10)), true
+	}
+
+	if p.action != "" {
+		key, derived = deriveKey(key, "charlie/action/"+p.action), true
+	}
+
+	if p.chain != "" {
+		key, derived = deriveKey(key, "charlie/chain/"+p.chain), true
+	}
+
+	if p.bound != nil {
+		*p.bound = boundKeyCache{sk: sk, id: id, key: key, derived: derived}
+	}
+	return key, derived
+}
+
+// boundKeyCache holds the last key returned by boundKey, so that a single call
+// which both validates and generates tokens derives it only once.
+type boundKeyCache struct {
+	sk      *signingKey
+	id      string
+	key     []byte
+	derived bool
+}
@@ -0,0 +1,83 @@
+package charlie
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGeneration(t *testing.T) {
+	for _, format := range []Format{
+		FormatCharlie, FormatJWT, FormatPASETOLocal, FormatBranca, FormatCOSE,
+	} {
+		gens := map[string]uint32{}
+		p := New([]byte("yay"))
+		p.Format = format
+
+		old := p.Generate("woo")
+
+		p.GenerationFunc = func(id string) uint32 { return gens[id] }
+		if err := p.Validate("woo", old); err != nil {
+			t.Errorf("%v: token from before generations was invalid: %v", format, err)
+		}
+
+		gens["woo"]++
+		if err := p.Validate("woo", old); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: token from an old generation was valid", format)
+		}
+
+		token := p.Generate("woo")
+		if err := p.Validate("woo", token); err != nil {
+			t.Errorf("%v: token from the current generation was invalid: %v", format, err)
+		}
+
+		gens["woo"]++
+		if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: token from an old generation was valid", format)
+		}
+	}
+}
+
+func TestGenerationCodec(t *testing.T) {
+	gen := uint32(1)
+	p := New([]byte("yay"))
+	p.Codec = ProtoCodec{}
+	p.GenerationFunc = func(id string) uint32 { return gen }
+
+	token := p.Generate("woo")
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+
+	gen++
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Error("Token from an old generation was valid")
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	for _, format := range []Format{
+		FormatCharlie, FormatJWT, FormatPASETOLocal, FormatPASETOPublic, FormatBranca, FormatCOSE,
+	} {
+		staging := New([]byte("yay"))
+		staging.Format = format
+		staging.Environment = "staging"
+
+		production := New([]byte("yay"))
+		production.Format = format
+		production.Environment = "production"
+
+		token := staging.Generate("woo")
+		if err := staging.Validate("woo", token); err != nil {
+			t.Errorf("%v: token was invalid in its own environment: %v", format, err)
+		}
+
+		if err := production.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: token was valid in another environment", format)
+		}
+
+		production.Environment = ""
+		if err := production.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: token was valid without an environment", format)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package charlie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// A Hash is the hash function of the HMAC which authenticates FormatCharlieV2
+// and FormatCharlieV3 tokens. It's encoded in the high bits of their version
+// byte, but tokens are only valid if theirs is the Params' Hash or one of its
+// AcceptHashes, so that a token can't choose the Hash it's validated with.
+// Deployments switching between them should accept the old Hash until
+// outstanding tokens expire. Whatever the Hash, MACs are truncated to MACSize.
+type Hash uint8
+
+const (
+	// HashSHA256 is SHA-256. It is the default.
+	HashSHA256 Hash = iota
+
+	// HashSHA512_256 is SHA-512/256.
+	HashSHA512_256
+
+	// HashSHA3_256 is SHA3-256.
+	HashSHA3_256
+
+	// HashBLAKE2b256 is BLAKE2b-256.
+	HashBLAKE2b256
+)
+
+func (h Hash) String() string {
+	switch h {
+	case HashSHA256:
+		return "sha256"
+	case HashSHA512_256:
+		return "sha512/256"
+	case HashSHA3_256:
+		return "sha3-256"
+	case HashBLAKE2b256:
+		return "blake2b-256"
+	}
+	return "unknown"
+}
+
+// valid returns true if h is a known Hash.
+func (h Hash) valid() bool {
+	return h <= HashBLAKE2b256
+}
+
+// accepts returns true if the Params validate tokens generated with h.
+func (p *Params) accepts(h Hash) bool {
+	if h == p.Hash {
+		return true
+	}
+
+	for _, a := range p.AcceptHashes {
+		if h == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (h Hash) new() hash.Hash {
+	switch h {
+	case HashSHA256:
+		return sha256.New()
+	case HashSHA512_256:
+		return sha512.New512_256()
+	case HashSHA3_256:
+		return sha3.New256()
+	case HashBLAKE2b256:
+		b, _ := blake2b.New256(nil)
+		return b
+	}
+	panic("charlie: unknown hash " + strconv.Itoa(int(h)))
+}
+
+// mac returns the HMAC of the given data and user's identity.
+func (h Hash) mac(key, data []byte, id string) []byte {
+	m := hmac.New(h.new, key)
+	_, _ = m.Write(data)
+	_, _ = m.Write([]byte(id))
+	return m.Sum(nil)
+}
+
+// versionByte returns the version byte of tokens with the given version and
+// Hash.
+func versionByte(version byte, h Hash) byte {
+	return version | byte(h)<<4
+}
+
+// parseVersionByte returns the version and Hash of the given version byte.
+func parseVersionByte(b byte) (version byte, h Hash) {
+	return b & 0x0f, Hash(b >> 4)
+}
@@ -0,0 +1,107 @@
+package charlie
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestHashes(t *testing.T) {
+	hashes := []Hash{HashSHA256, HashSHA512_256, HashSHA3_256, HashBLAKE2b256}
+	for _, f := range []Format{FormatCharlieV2, FormatCharlieV3} {
+		macs := make(map[string]bool)
+		for _, h := range hashes {
+			p := New([]byte("yay"))
+			p.Format = f
+			p.Hash = h
+
+			token := p.Generate("woo")
+			data, _ := base64.URLEncoding.DecodeString(token)
+			if _, th := parseVersionByte(data[0]); th != h {
+				t.Errorf("%s/%s: version byte named %s", f, h, th)
+			}
+			macs[string(data[len(data)-macSize:])] = true
+
+			if err := p.Validate("woo", token); err != nil {
+				t.Errorf("%s/%s: %v", f, h, err)
+			}
+
+			// Tokens are only validated with the hashes the Params accept.
+			v := New([]byte("yay"))
+			if err := v.Validate("woo", token); h != HashSHA256 && !errors.Is(err, ErrBadMAC) {
+				t.Errorf("%s/%s: default Params accepted the token: %v", f, h, err)
+			}
+
+			v.AcceptHashes = []Hash{h}
+			if err := v.Validate("woo", token); err != nil {
+				t.Errorf("%s/%s: Params accepting the hash didn't accept the token: %v", f, h, err)
+			}
+
+			if err := v.Validate("boo", token); !errors.Is(err, ErrBadMAC) {
+				t.Errorf("%s/%s: error was %v, but expected ErrBadMAC", f, h, err)
+			}
+		}
+
+		if len(macs) != len(hashes) {
+			t.Errorf("%s: expected each hash to produce a distinct MAC", f)
+		}
+	}
+}
+
+func TestUnknownHash(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatCharlieV2
+	data, _ := base64.URLEncoding.DecodeString(p.Generate("woo"))
+	data[0] = versionByte(charlieV2Version, HashBLAKE2b256+1)
+
+	if err := p.Validate("woo", base64.URLEncoding.EncodeToString(data)); err == nil {
+		t.Error("Expected a token with an unknown hash to be invalid")
+	}
+
+	if _, err := NewWithOptions([]byte("a-key-of-at-least-16-bytes"), WithHash(HashBLAKE2b256+1)); err == nil {
+		t.Error("Expected an unknown hash to be rejected")
+	}
+
+	// Params with an unknown Hash neither generate nor validate tokens.
+	token := p.Generate("woo")
+	p.Hash = HashBLAKE2b256 + 1
+	if _, err := p.GenerateContext(context.Background(), "woo"); err != errUnknownHash {
+		t.Errorf("Error was %v, but expected errUnknownHash", err)
+	}
+
+	if err := p.Validate("woo", token); err != errUnknownHash {
+		t.Errorf("Error was %v, but expected errUnknownHash", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected Generate to panic")
+		}
+	}()
+	p.Generate("woo")
+}
+
+func TestHashesV1(t *testing.T) {
+	token := New([]byte("yay")).Generate("woo")
+
+	p := New([]byte("yay"))
+	p.Format = FormatCharlieV2
+	p.Hash = HashSHA512_256
+	if err := p.Validate("woo", token); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+
+	p.AcceptHashes = []Hash{HashSHA256}
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Params accepting SHA-256 didn't accept the token: %v", err)
+	}
+
+	p.Format = FormatCharlie
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected Generate to panic")
+		}
+	}()
+	p.Generate("woo")
+}
@@ -0,0 +1,18 @@
+package charlie
+
+import "net/http"
+
+// RequestAction returns the action to which tokens for requests with the given
+// method and path are scoped when HTTPParams.BindRequest is true, for use with
+// GenerateFor, e.g. RequestAction("POST", "/comments").
+func RequestAction(method, path string) string {
+	return method + " " + path
+}
+
+// bindRequest returns the Params which validate the request's tokens.
+func (hp *HTTPParams) bindRequest(r *http.Request, csrf *Params) *Params {
+	if !hp.BindRequest || r.URL == nil {
+		return csrf
+	}
+	return csrf.scoped(RequestAction(r.Method, r.URL.Path))
+}
@@ -0,0 +1,41 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPBindRequest(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		BindRequest:   true,
+	}
+	handler := v.Wrap(noContentHandler)
+	csrf := v.params()
+
+	send := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(testCSRFHeader, token)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	token := csrf.GenerateFor(testSessionID, RequestAction("POST", "/comments"))
+	if code := send("POST", "/comments", token); code != 204 {
+		t.Errorf("Expected a bound token to be accepted, got %d", code)
+	}
+
+	if code := send("DELETE", "/users/123", token); code != http.StatusForbidden {
+		t.Errorf("Expected a token bound to another request to be rejected, got %d", code)
+	}
+
+	if code := send("POST", "/comments", csrf.Generate(testSessionID)); code != http.StatusForbidden {
+		t.Errorf("Expected an unbound token to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,29 @@
+package charlie
+
+import "net/http"
+
+// crossOrigin returns whether the CrossOriginProtection can decide the
+// request, and its decision if so. It can decide requests with unsafe methods
+// from browsers which send Sec-Fetch-Site; it always allows safe methods, and
+// it can't distinguish requests from older browsers or non-browser clients.
+func (hp *HTTPParams) crossOrigin(r *http.Request) (decided bool, err error) {
+	if hp.CrossOriginProtection == nil || r.Header.Get("Sec-Fetch-Site") == "" {
+		return false, nil
+	}
+
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return false, nil
+	}
+	return true, hp.CrossOriginProtection.Check(r)
+}
+
+func (hp *HTTPParams) rejectCrossOrigin(w http.ResponseWriter, r *http.Request, rt route, id string, err error) {
+	if rt.invalidHandler != nil {
+		rt.invalidHandler.ServeHTTP(w, r)
+		return
+	}
+
+	hp.logRejection(r, "csrf_cross_origin", id, "", err, "Rejected a cross-origin request for session=%q: %v", id, err)
+	hp.writeRejection(w, r, rt.invalidStatusCode, "cross_origin")
+}
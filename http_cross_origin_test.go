@@ -0,0 +1,79 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPCrossOriginProtection(t *testing.T) {
+	v := HTTPParams{
+		Key:                   []byte(testKey),
+		CSRFHeader:            testCSRFHeader,
+		SessionCookie:         testSessionCookie,
+		CrossOriginProtection: http.NewCrossOriginProtection(),
+		SafeMethods:           []string{},
+		Overrides: []Override{
+			{Path: "/webhooks/", Exempt: true},
+		},
+	}
+	handler := v.Wrap(noContentHandler)
+	token := v.params().Generate(testSessionID)
+
+	send := func(method, path, site, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		if site != "" {
+			req.Header.Set("Sec-Fetch-Site", site)
+		}
+		if token != "" {
+			req.Header.Set(testCSRFHeader, token)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	tests := []struct {
+		name               string
+		method, path, site string
+		token              string
+		code               int
+	}{
+		{"same-origin without a token", "POST", "/", "same-origin", "", 204},
+		{"cross-site with a token", "POST", "/", "cross-site", token, 403},
+		{"cross-site exempt", "POST", "/webhooks/a", "cross-site", "", 204},
+		{"old browser without a token", "POST", "/", "", "", 403},
+		{"old browser with a token", "POST", "/", "", token, 204},
+		{"safe method without a token", "GET", "/", "same-origin", "", 403},
+		{"safe method with a token", "GET", "/", "cross-site", token, 204},
+	}
+
+	for _, tt := range tests {
+		if code := send(tt.method, tt.path, tt.site, tt.token); code != tt.code {
+			t.Errorf("%s: status was %d, but expected %d", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestHTTPCrossOriginProtectionReportOnly(t *testing.T) {
+	v := HTTPParams{
+		Key:                   []byte(testKey),
+		CSRFHeader:            testCSRFHeader,
+		SessionCookie:         testSessionCookie,
+		CrossOriginProtection: http.NewCrossOriginProtection(),
+		Policy:                &Policy{Default: ReportOnly},
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+
+	res := httptest.NewRecorder()
+	v.Wrap(noContentHandler).ServeHTTP(res, req)
+
+	if res.Code != 204 {
+		t.Errorf("Status was %d, but expected 204", res.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package charlie
+
+import (
+	"encoding/base64"
+	"net/http"
+)
+
+// defaultDoubleSubmitCookie is the default name of the cookie holding the
+// random ID which stands in for a session in double-submit mode.
+const defaultDoubleSubmitCookie = "charlie_id"
+
+// doubleSubmitCookie returns the name of the cookie which holds the client's
+// random ID in double-submit mode.
+func (hp *HTTPParams) doubleSubmitCookie() string {
+	if hp.DoubleSubmitCookie != "" {
+		return hp.DoubleSubmitCookie
+	}
+	return defaultDoubleSubmitCookie
+}
+
+// doubleSubmitID returns the client's random ID in double-submit mode, or an
+// empty string if it has none.
+func (hp *HTTPParams) doubleSubmitID(r *http.Request) string {
+	id, _ := extract(r, []Extractor{FromCookie(hp.doubleSubmitCookie())})
+	return id
+}
+
+// newDoubleSubmitID sets a cookie holding a new random ID for the client, which
+// its tokens are bound to from then on, and returns it.
+func (hp *HTTPParams) newDoubleSubmitID(w http.ResponseWriter, r *http.Request, csrf *Params) string {
+	b := make([]byte, 16)
+	csrf.random(b)
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	template := http.Cookie{HttpOnly: true}
+	if hp.DoubleSubmitCookieAttributes != nil {
+		template = *hp.DoubleSubmitCookieAttributes
+	}
+	template.Name = hp.doubleSubmitCookie()
+
+	http.SetCookie(w, newCookie(template, id, r, hp.InsecureCookies))
+	return id
+}
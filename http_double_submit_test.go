@@ -0,0 +1,62 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPDoubleSubmit(t *testing.T) {
+	v := HTTPParams{
+		Key:          []byte(testKey),
+		CSRFHeader:   testCSRFHeader,
+		IssueHeader:  testCSRFHeader,
+		DoubleSubmit: true,
+	}
+	handler := v.Wrap(noContentHandler)
+
+	// New clients are given a random ID and a token bound to it.
+	visit := func() (*http.Cookie, string) {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+		cookies := res.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != "charlie_id" || !cookies[0].HttpOnly {
+			t.Fatalf("Unexpected cookies: %v", cookies)
+		}
+		return cookies[0], res.Header().Get(testCSRFHeader)
+	}
+
+	c1, t1 := visit()
+	c2, t2 := visit()
+	if c1.Value == c2.Value || t1 == "" {
+		t.Fatalf("Expected distinct IDs and tokens, got %q/%q and %q/%q", c1.Value, t1, c2.Value, t2)
+	}
+
+	send := func(c *http.Cookie, token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		if c != nil {
+			req.AddCookie(c)
+		}
+		req.Header.Set(testCSRFHeader, token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if c != nil && len(res.Result().Cookies()) != 0 {
+			t.Errorf("Expected the existing ID to be kept, got %v", res.Result().Cookies())
+		}
+		return res.Code
+	}
+
+	if code := send(c1, t1); code != 204 {
+		t.Errorf("Expected a 204 with a matching cookie and token, got %d", code)
+	}
+
+	if code := send(c1, t2); code != http.StatusForbidden {
+		t.Errorf("Expected a 403 with another client's token, got %d", code)
+	}
+
+	if code := send(nil, t1); code != http.StatusForbidden {
+		t.Errorf("Expected a 403 without a cookie, got %d", code)
+	}
+}
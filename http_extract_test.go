@@ -0,0 +1,135 @@
+package charlie
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHTTPTokenExtractors(t *testing.T) {
+	var sources []string
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		TokenExtractors: []Extractor{
+			FromHeader("X-Token"),
+			FromCookie("token"),
+			FromForm("csrf_token", 0),
+			FromQuery("csrf_token"),
+			FromJSON("csrf_token", 0),
+		},
+		OnTokenSource: func(r *http.Request, source string) {
+			sources = append(sources, source)
+		},
+	}
+
+	var body string
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(204)
+	}))
+	token := v.params().Generate(testSessionID)
+
+	send := func(target, contentType, b string, setup func(r *http.Request)) int {
+		req := httptest.NewRequest("POST", target, strings.NewReader(b))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		if setup != nil {
+			setup(req)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	form := url.Values{"csrf_token": {token}}.Encode()
+	json := `{"name":"woo","csrf_token":"` + token + `"}`
+	for name, code := range map[string]int{
+		"header": send("/", "text/plain", "", func(r *http.Request) { r.Header.Set("X-Token", token) }),
+		"cookie": send("/", "text/plain", "", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: token}) }),
+		"form":   send("/", "application/x-www-form-urlencoded", form, nil),
+		"query":  send("/download?csrf_token="+url.QueryEscape(token), "text/plain", "", nil),
+		"json":   send("/", "application/json; charset=utf-8", json, nil),
+	} {
+		if code != 204 {
+			t.Errorf("Expected a token in the %s to be accepted, got %d", name, code)
+		}
+	}
+
+	if body != json {
+		t.Errorf("Handler read %q, but expected %q", body, json)
+	}
+
+	if len(sources) != 5 {
+		t.Errorf("Sources were %v, but expected five", sources)
+	}
+
+	// The CSRFHeader is replaced
+	if code := send("/", "text/plain", "", func(r *http.Request) { r.Header.Set(testCSRFHeader, token) }); code != http.StatusForbidden {
+		t.Errorf("Expected a token in the CSRFHeader to be ignored, got %d", code)
+	}
+
+	if code := send("/", "application/json", `{"csrf_token":1}`, nil); code != http.StatusForbidden {
+		t.Errorf("Expected a non-string JSON token to be rejected, got %d", code)
+	}
+}
+
+func TestHTTPJSONField(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		SessionCookie: testSessionCookie,
+		CSRFJSONField: "csrf_token",
+		MaxFormSize:   256,
+	}
+
+	var body string
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(204)
+	}))
+	token := v.params().Generate(testSessionID)
+
+	send := func(contentType, b string) int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(b))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+		body = ""
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	json := `{"csrf_token":"` + token + `","items":[1,2,3]}`
+	if code := send("application/json", json); code != 204 {
+		t.Errorf("Expected a token in a JSON body to be accepted, got %d", code)
+	}
+
+	if body != json {
+		t.Errorf("Handler read %q, but expected %q", body, json)
+	}
+
+	if code := send("application/vnd.api+json", json); code != 204 {
+		t.Errorf("Expected a token in a +json body to be accepted, got %d", code)
+	}
+
+	if code := send("text/plain", json); code != http.StatusForbidden {
+		t.Errorf("Expected a token in a non-JSON body to be rejected, got %d", code)
+	}
+
+	large := `{"csrf_token":"` + token + `","padding":"` + strings.Repeat("x", 256) + `"}`
+	if code := send("application/json", large); code != http.StatusForbidden {
+		t.Errorf("Expected a token in an oversized body to be rejected, got %d", code)
+	}
+
+	if body != "" {
+		t.Error("Handler was called for a rejected request")
+	}
+}
@@ -0,0 +1,26 @@
+package charlie
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrCrossSiteRequest is the reason a request which a browser reported as
+// cross-site is invalid when RejectCrossSite is set.
+var ErrCrossSiteRequest = errors.New("cross-site request")
+
+// fetchMetadata returns the decision for an enforced request, per its
+// Sec-Fetch-Site header, if RejectCrossSite or TrustSameOrigin apply to it:
+// ErrCrossSiteRequest if it's to be rejected, or skip if it's to be served
+// without checking its token.
+func (hp *HTTPParams) fetchMetadata(r *http.Request) (skip bool, err error) {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "cross-site":
+		if hp.RejectCrossSite {
+			return false, ErrCrossSiteRequest
+		}
+	case "same-origin":
+		return hp.TrustSameOrigin, nil
+	}
+	return false, nil
+}
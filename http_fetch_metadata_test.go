@@ -0,0 +1,57 @@
+package charlie
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPFetchMetadata(t *testing.T) {
+	var invalid error
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+		OnInvalid:     func(r *http.Request, err error) { invalid = err },
+	}
+	handler := v.Wrap(noContentHandler)
+	token := New(v.Key).Generate(testSessionID)
+
+	send := func(site, token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+		req.Header.Set("Sec-Fetch-Site", site)
+		if token != "" {
+			req.Header.Set(testCSRFHeader, token)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	// By default, Sec-Fetch-Site is ignored.
+	if code := send("cross-site", token); code != 204 {
+		t.Errorf("Expected a 204 for a cross-site request with a token, got %d", code)
+	}
+
+	if code := send("same-origin", ""); code != http.StatusForbidden {
+		t.Errorf("Expected a 403 for a same-origin request without a token, got %d", code)
+	}
+
+	v.RejectCrossSite = true
+	v.TrustSameOrigin = true
+
+	if code := send("cross-site", token); code != http.StatusForbidden || !errors.Is(invalid, ErrCrossSiteRequest) {
+		t.Errorf("Expected a 403 for a cross-site request, got %d (%v)", code, invalid)
+	}
+
+	if code := send("same-origin", ""); code != 204 {
+		t.Errorf("Expected a 204 for a same-origin request without a token, got %d", code)
+	}
+
+	if code := send("same-site", ""); code != http.StatusForbidden {
+		t.Errorf("Expected a 403 for a same-site request without a token, got %d", code)
+	}
+}
@@ -0,0 +1,78 @@
+package charlie
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// defaultMaxFormSize is the default value of HTTPParams.MaxFormSize.
+const defaultMaxFormSize = 1 << 20
+
+// formValue returns the value of the given field in the request's body, if
+// it's a form of at most max bytes (or MaxFormSize's default, if max isn't
+// positive). The body is restored afterwards.
+func formValue(r *http.Request, field string, max int64) string {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data") {
+		return ""
+	}
+
+	body, ok := readBody(r, max)
+	if !ok {
+		return ""
+	}
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return ""
+		}
+		return values.Get(field)
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return ""
+		}
+
+		if part.FormName() == field && part.FileName() == "" {
+			v, err := io.ReadAll(part)
+			if err != nil {
+				return ""
+			}
+			return string(v)
+		}
+	}
+}
+
+// readBody returns the request's body, if it's at most max bytes (or
+// MaxFormSize's default, if max isn't positive), and restores it so that it can
+// be read again.
+func readBody(r *http.Request, max int64) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+
+	if max <= 0 {
+		max = defaultMaxFormSize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || int64(len(body)) > max {
+		return nil, false
+	}
+	return body, true
+}
+
+// readCloser restores a partially read request body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
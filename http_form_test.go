@@ -0,0 +1,106 @@
+package charlie
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHTTPFormField(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		SessionCookie: testSessionCookie,
+		CSRFFormField: "csrf_token",
+	}
+
+	var body string
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(204)
+	}))
+	token := v.params().Generate(testSessionID)
+
+	send := func(contentType, form string) int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+		body = ""
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	form := url.Values{"csrf_token": {token}, "name": {"woo"}}.Encode()
+	if code := send("application/x-www-form-urlencoded", form); code != 204 {
+		t.Errorf("Expected a token in a form to be accepted, got %d", code)
+	}
+
+	if body != form {
+		t.Errorf("Handler read %q, but expected %q", body, form)
+	}
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	_ = mw.WriteField("name", "woo")
+	_ = mw.WriteField("csrf_token", token)
+	_ = mw.Close()
+
+	if code := send(mw.FormDataContentType(), buf.String()); code != 204 {
+		t.Errorf("Expected a token in a multipart form to be accepted, got %d", code)
+	}
+
+	if body != buf.String() {
+		t.Error("Handler didn't read the whole multipart body")
+	}
+
+	if code := send("application/json", `{"csrf_token":"`+token+`"}`); code != 403 {
+		t.Errorf("Expected a token in another content type to be rejected, got %d", code)
+	}
+
+	form = url.Values{"csrf_token": {"nope"}}.Encode()
+	if code := send("application/x-www-form-urlencoded", form); code != 403 {
+		t.Errorf("Expected an invalid token in a form to be rejected, got %d", code)
+	}
+}
+
+func TestHTTPFormFieldMaxSize(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		SessionCookie: testSessionCookie,
+		CSRFFormField: "csrf_token",
+		MaxFormSize:   64,
+	}
+
+	var body string
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(204)
+	}))
+
+	form := url.Values{
+		"csrf_token": {v.params().Generate(testSessionID)},
+		"padding":    {strings.Repeat("a", 100)},
+	}.Encode()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 403 {
+		t.Errorf("Expected an oversized form to be rejected, got %d", res.Code)
+	}
+
+	if body != "" {
+		t.Errorf("Handler read %q", body)
+	}
+}
@@ -1,7 +1,8 @@
 package charlie
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -13,66 +14,577 @@ type HTTPParams struct {
 
 	Key []byte
 
+	// OldKeys, if non-empty, are accepted in addition to Key. See New.
+	OldKeys [][]byte
+
+	// MaxAge is the maximum age of tokens. It defaults to three hours.
+	MaxAge time.Duration
+
+	// Params, if non-nil, generate and validate tokens in place of Params
+	// created from Key, so that they can be shared with the rest of the
+	// application or have their key replaced with SetKey. Key, OldKeys,
+	// MaxAge, and GenerationFunc are then ignored.
+	Params *Params
+
+	// GenerationFunc, if non-nil, returns the user's current generation. See
+	// Params.GenerationFunc.
+	GenerationFunc func(id string) uint32
+
 	CSRFCookie string
 	CSRFHeader string
 
+	// CSRFFormField, if set, names a form field (e.g. a hidden input) in which
+	// tokens are also accepted, in application/x-www-form-urlencoded and
+	// multipart/form-data request bodies. The body is buffered and restored,
+	// so the wrapped handler can still read it.
+	CSRFFormField string
+
+	// CSRFJSONField, if set, names a top-level string field in which tokens
+	// are also accepted, in JSON request bodies (e.g. {"csrf_token": "..."}).
+	// As with CSRFFormField, the body is buffered and restored.
+	CSRFJSONField string
+
+	// MaxFormSize is the largest request body which is searched for the
+	// CSRFFormField or CSRFJSONField. Larger bodies are left unread. It
+	// defaults to 1MiB.
+	MaxFormSize int64
+
+	// TokenExtractors, if non-empty, replace CSRFHeader, CSRFCookie,
+	// CSRFFormField, and CSRFJSONField (including those of Overrides) as the
+	// sources of tokens. Tokens from all of them are tried, in order. An
+	// Extractor which returns an error presents no tokens.
+	TokenExtractors []Extractor
+
 	SessionCookie string
 	SessionHeader string
+
+	// SessionExtractors, if non-empty, replace SessionCookie and SessionHeader
+	// as the sources of the user's session ID. They're tried in order, and
+	// the first non-empty value is used.
+	SessionExtractors []Extractor
+
+	// SessionFunc, if non-nil, returns the user's session ID, replacing
+	// SessionExtractors, SessionCookie, and SessionHeader, so that any session
+	// scheme (e.g. a claim of a JWT in the Authorization header) can be bound
+	// to tokens. If it returns an error, the request has no session.
+	SessionFunc func(r *http.Request) (string, error)
+
+	// DoubleSubmit, if true, protects clients without a server-side session
+	// with signed double-submit cookies. The middleware sets an HttpOnly
+	// cookie, named DoubleSubmitCookie, holding a random ID for each new
+	// client, which stands in for its session: tokens are bound to it by their
+	// MACs, and requests must present both it and a matching token (e.g. in
+	// the CSRFHeader or CSRFFormField), so that a token without its cookie,
+	// or a cookie without its token, is rejected. Tokens are issued as usual.
+	// It replaces SessionHeader, SessionCookie, SessionExtractors, and
+	// SessionFunc. Cookies set by a sibling subdomain can't be told apart from
+	// the middleware's own, so give DoubleSubmitCookie the "__Host-" prefix
+	// when serving over HTTPS.
+	DoubleSubmit bool
+
+	// DoubleSubmitCookie is the name of the cookie holding each client's
+	// random ID in DoubleSubmit mode. It defaults to "charlie_id".
+	DoubleSubmitCookie string
+
+	// DoubleSubmitCookieAttributes, if non-nil, sets the attributes of the
+	// DoubleSubmitCookie, whose name and value are ignored, as for
+	// ToCookieWith. Otherwise, it's HttpOnly, with ToCookieWith's defaults.
+	DoubleSubmitCookieAttributes *http.Cookie
+
+	// MissingStatusCode, if non-zero, is the status code of responses to
+	// requests which present no token or no session at all (e.g. 401), so
+	// that clients can tell them apart from requests whose token is invalid,
+	// which receive the InvalidStatusCode. It's ignored if an InvalidHandler
+	// applies.
+	MissingStatusCode int
+
+	// InvalidStatusCode, if non-zero, is the status code of responses to
+	// rejected requests. It defaults to 403 (Forbidden), and is ignored if an
+	// InvalidHandler applies.
+	InvalidStatusCode int
+
+	// InvalidContentTypes, if non-empty, are the media types of the bodies of
+	// responses to rejected requests, in order of preference, of which the
+	// request's Accept header chooses one: "text/plain", "application/json"
+	// (e.g. {"error":"invalid_csrf_token","reason":"expired"}), or
+	// "application/problem+json" (per RFC 9457, with a reason member).
+	// Otherwise, responses to requests whose Accept header names JSON have
+	// application/json bodies, so that clients can tell why they were
+	// rejected (e.g. to prompt for a refresh), and others are empty. Reasons
+	// are the ValidationError's Reason in snake case (e.g. "bad_mac" or
+	// "missing_token") or "cross_origin". They're ignored if an InvalidHandler
+	// applies.
+	InvalidContentTypes []string
+
+	// PreviousSession, if non-nil, returns the session ID which the request's
+	// session replaced and when it was rotated, or an empty ID if it hasn't
+	// been. Tokens bound to the previous session ID are accepted for
+	// RotationGrace after the rotation, so that forms rendered before it
+	// still work.
+	PreviousSession func(r *http.Request) (id string, rotatedAt time.Time)
+
+	// RotationGrace is how long after a session rotation tokens bound to the
+	// previous session ID are accepted. It defaults to 30 seconds.
+	RotationGrace time.Duration
+
+	// ExemptPaths are exempted from enforcement entirely, e.g. for webhooks,
+	// health checks, and OAuth callbacks. Each is either a path (e.g.
+	// "/webhooks/"), which exempts it and the paths beneath it as
+	// Override.Path matches them, or, if it contains any of "*?[", a
+	// path.Match pattern (e.g. "/hooks/*/events"). Either is matched against
+	// the cleaned request path. To exempt requests by other criteria, use
+	// EnforceIf or an exempt Override.
+	ExemptPaths []string
+
+	// BindRequest, if true, requires that tokens be scoped to the method and
+	// path of the requests they're presented with, so that a token for one
+	// endpoint can't be replayed against another. Such tokens are generated
+	// with Params.GenerateFor and RequestAction. Tokens issued by the
+	// middleware itself aren't scoped, so aren't accepted.
+	BindRequest bool
+
+	// Overrides replace parts of the configuration for matching requests. The
+	// first Override which matches a request applies.
+	Overrides []Override
+
+	// ChainCookie, if set, names an HttpOnly cookie which holds the last token
+	// a client presented. Tokens are then chained: each token issued is bound
+	// to the one before it, so that, as long as the client keeps the cookie,
+	// no token issued before the last one it used is valid. Clients without
+	// the cookie start a new chain, with which tokens which started earlier
+	// chains are valid again, so this doesn't stop replays by clients which
+	// drop it. See GenerateChained.
+	ChainCookie string
+
+	// WebSocketQuery names the query parameter in which ValidateWebSocket
+	// accepts tokens. It defaults to "csrf".
+	WebSocketQuery string
+
+	// LegacyValidator, if non-nil, is tried with the tokens of requests which
+	// present no valid token of Charlie's own, e.g. DjangoValidator while
+	// migrating from Django. Tokens it accepts are reported to OnTokenSource
+	// as from "legacy".
+	LegacyValidator LegacyValidator
+
+	// OnValid, if non-nil, is called with each checked request whose token
+	// is valid.
+	OnValid func(r *http.Request)
+
+	// OnInvalid, if non-nil, is called with each checked request which is
+	// invalid, whether or not it's rejected, and the reason: ErrMissingSession,
+	// ErrMissingToken, the error returned by validating its token (e.g.
+	// ErrTokenExpired), ErrCrossSiteRequest, ErrUntrustedOrigin, or the error
+	// returned by CrossOriginProtection.
+	OnInvalid func(r *http.Request, err error)
+
+	// OnTokenSource, if non-nil, is called with the source (e.g. "header" or
+	// "cookie") of the token which validated each enforced request. All tokens
+	// presented in the CSRFHeader and CSRFCookie are tried, so that requests
+	// carrying both a fresh and a stale token are accepted.
+	OnTokenSource func(r *http.Request, source string)
+
+	// StaleHeader, if set, names a response header which is set to "1" on
+	// responses to requests whose token was stale (see Params.SoftMaxAge), as
+	// a hint to clients to replace it. If the middleware issues tokens, the
+	// response carries its replacement.
+	StaleHeader string
+
+	// CrossOriginProtection, if non-nil, decides requests with unsafe methods
+	// from browsers which send Sec-Fetch-Site, which are then served without
+	// a token if it allows them and rejected as invalid if it doesn't. Tokens
+	// are required only of the requests it can't decide: those from older
+	// browsers and non-browser clients, and those with safe methods which
+	// SafeMethods doesn't exempt. Requests exempted by an Override are never
+	// checked by it, so it shouldn't also wrap the handler itself, and its
+	// deny handler is replaced by the InvalidHandler.
+	CrossOriginProtection *http.CrossOriginProtection
+
+	// RejectCrossSite, if true, rejects requests which would otherwise be
+	// enforced, and which browsers report as cross-site with Sec-Fetch-Site,
+	// before validating their tokens. It's a cheaper, narrower alternative to
+	// CrossOriginProtection, which tokens still back up.
+	RejectCrossSite bool
+
+	// TrustSameOrigin, if true, serves requests which browsers report as
+	// same-origin with Sec-Fetch-Site without checking for a token. Browsers
+	// which don't send Sec-Fetch-Site, and non-browser clients, still need
+	// tokens.
+	TrustSameOrigin bool
+
+	// TrustedOrigins, if non-nil, are the origins (e.g.
+	// "https://example.com") other than their own from which requests which
+	// would otherwise be enforced are accepted, in addition to checking their
+	// tokens. A "*." prefix to the host matches any subdomain (e.g.
+	// "https://*.example.com"). Requests whose Origin header, or failing that
+	// whose Referer, is another origin are rejected as cross-origin. Requests
+	// with neither, as from non-browser clients, are left to their tokens.
+	// An empty slice trusts only requests' own origins.
+	TrustedOrigins []string
+
+	// SafeMethods are the methods of requests which are served without
+	// checking for a token, as they mustn't change state. If nil, they're GET,
+	// HEAD, OPTIONS, and TRACE; if empty, requests with any method are
+	// checked.
+	SafeMethods []string
+
+	// EnforceIf, if non-nil, limits enforcement to requests for which it
+	// returns true. Other requests are served without checking for a token.
+	EnforceIf func(r *http.Request) bool
+
+	// Policy, if non-nil, decides how requests which EnforceIf doesn't skip
+	// are handled. Otherwise, all such requests are enforced.
+	Policy *Policy
+
+	// ReportOnly, if true, serves requests which would otherwise be enforced
+	// whether or not their tokens are valid, logging those which aren't, so
+	// that false positives can be measured before enforcement is enabled. It
+	// has the same effect as a Policy whose decisions are all ReportOnly.
+	ReportOnly bool
+
+	// OnReport, if non-nil, is called with each request which was served
+	// despite being invalid, because of ReportOnly or a Policy.
+	OnReport func(r *http.Request)
+
+	// IssueHeader, if set, names a response header in which each served
+	// request with a session is sent a fresh token.
+	IssueHeader string
+
+	// IssueCookie, if set, names a cookie in which each served request with a
+	// session is sent a fresh token. The cookie isn't HttpOnly, so that
+	// JavaScript can read it and send it back in a header. IssueHeader and
+	// IssueCookie may be used together.
+	IssueCookie string
+
+	// IssueCookieAttributes, if non-nil, sets the attributes (e.g. Domain,
+	// Path, MaxAge, SameSite, and HttpOnly) of the IssueCookie, whose name and
+	// value are ignored. Its Path defaults to "/" and its SameSite to Lax, and
+	// it's Secure unless InsecureCookies is set. An IssueCookie with the
+	// "__Host-" prefix has Path "/" and no Domain. See ToCookieWith.
+	IssueCookieAttributes *http.Cookie
+
+	// InsecureCookies, if true, makes the cookies the middleware sets (the
+	// IssueCookie, DoubleSubmitCookie, and ChainCookie) Secure only over TLS,
+	// for development over plain HTTP. Otherwise, they're always Secure. It's
+	// unsafe in production. See ToInsecureCookieWith.
+	InsecureCookies bool
+
+	// InjectMeta, if set, is the name of a meta tag (e.g. "csrf-token") in
+	// which each fresh token is injected into the head of HTML responses, for
+	// pages' scripts to read. See ScriptHandler.
+	InjectMeta string
+
+	// InjectForms, if true, injects each fresh token into HTML responses as a
+	// hidden input, named after the CSRFFormField, in each form with method
+	// post which submits to the request's own origin; forms with other
+	// actions are left alone, lest the token leak to other sites. Together
+	// with InjectMeta, this lets server-rendered apps adopt tokens without
+	// changing their templates. HTML responses are buffered to inject tokens
+	// into them until they're finished, flushed, or past 1MiB, and those with
+	// a Content-Encoding are left alone.
+	InjectForms bool
+
+	// TokenWriters send each fresh token with the response, in addition to
+	// IssueHeader and IssueCookie.
+	TokenWriters []TokenWriter
+
+	// IssueLimit, if non-nil, caps the number of tokens issued to each
+	// session per minute.
+	IssueLimit *IssueLimit
+
+	// CacheControl is the Cache-Control header set on responses which carry
+	// a token, so that shared caches never serve one user's token to another.
+	// It defaults to "no-store".
+	CacheControl string
+
+	// RequestIDHeader, if set, names a header carrying the request's ID (e.g.
+	// X-Request-ID), which is included in logs and made available to
+	// handlers via RequestIDFromContext.
+	RequestIDHeader string
+
+	// RequestID, if non-nil, returns the request's ID, replacing
+	// RequestIDHeader.
+	RequestID func(r *http.Request) string
+
+	// LogSampling, if non-nil, samples the logs of rejected requests.
+	LogSampling *LogSampling
+
+	// Logger, if non-nil, receives the middleware's logs, with their events,
+	// request IDs, request methods, and details such as sessions, (redacted)
+	// tokens, and reasons as attributes. Otherwise, they're written with the
+	// log package.
+	Logger *slog.Logger
+
+	// LogTokens, if true, includes the tokens of rejected requests in logs.
+	// Otherwise, they're redacted.
+	LogTokens bool
+
+	// ErrorHandler, if non-nil, responds to requests whose tokens can't be
+	// checked because of an unexpected error, rather than an invalid token.
+	// Otherwise, the error is logged and the response is an empty 500.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+	// RecoverPanics, if true, recovers panics from the wrapped handler,
+	// responding with a 500 if it hadn't yet written a response. Responses
+	// are finalized as usual either way.
+	RecoverPanics bool
+
+	// OnPanic, if non-nil, is called with the value of each panic recovered
+	// from the wrapped handler. Otherwise, panics are logged.
+	OnPanic func(r *http.Request, v interface{})
+}
+
+// Middleware returns Wrap as middleware, for use with chi's Use, alice, and
+// other chains of func(http.Handler) http.Handler.
+func (hp *HTTPParams) Middleware() func(http.Handler) http.Handler {
+	return hp.Wrap
 }
 
 // Wrap wraps an http.Handler to check the validity of a CSRF token.
-// It only serves requests where a valid ID/token pair can be found in
-// either the request headers or cookies. Otherwise, it calls the InvalidHandler
-// or returns an empty 403.
+// It only serves requests with unsafe methods where a valid ID/token pair can
+// be found in either the request headers or cookies. Otherwise, it calls the
+// InvalidHandler or returns an empty 403.
 func (hp *HTTPParams) Wrap(h http.Handler) http.Handler {
-	csrf := New(hp.Key)
-	csrf.MaxAge = 3 * time.Hour
+	csrf := hp.params()
+	mux := hp.patternMux()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := headerOrCookieValue(r, hp.CSRFHeader, hp.CSRFCookie)
-		id := headerOrCookieValue(r, hp.SessionHeader, hp.SessionCookie)
-
-		var valid bool
-
-		if token != "" && id != "" {
-			err := csrf.Validate(id, token)
-			if err == nil {
-				valid = true
-			} else if err != ErrInvalidToken {
-				// This should never occur
-				panic(err)
+		rw := &responseWriter{ResponseWriter: w, hp: hp}
+		r = hp.withRequestID(r)
+		defer rw.finish()
+		if hp.RecoverPanics {
+			defer hp.recoverPanic(rw, r)
+		}
+		hp.serve(rw, r, h, csrf, mux)
+	})
+}
+
+// params returns the Params used to validate tokens.
+func (hp *HTTPParams) params() *Params {
+	if hp.Params != nil {
+		return hp.Params
+	}
+
+	csrf := New(hp.Key, hp.OldKeys...)
+	csrf.MaxAge = 3 * time.Hour
+	if hp.MaxAge != 0 {
+		csrf.MaxAge = hp.MaxAge
+	}
+	csrf.GenerationFunc = hp.GenerationFunc
+	csrf.Logger = hp.Logger
+	return csrf
+}
+
+func (hp *HTTPParams) serve(w http.ResponseWriter, r *http.Request, h http.Handler, csrf *Params, mux *http.ServeMux) {
+	rt := hp.route(r, csrf, mux)
+	decision := hp.decide(r)
+	if rt.exempt {
+		decision = Skip
+	}
+
+	id, err := hp.sessionID(r)
+	if err != nil {
+		hp.logf(r, "csrf_session_error", logFields{reason: err}, "Unable to extract the session: %v", err)
+		id = ""
+	}
+
+	csrf = hp.chain(r, rt.csrf)
+	if decided, err := hp.crossOrigin(r); decided && decision != Skip {
+		if err != nil && hp.OnInvalid != nil {
+			hp.OnInvalid(r, err)
+		}
+
+		if err != nil && decision != ReportOnly {
+			hp.rejectCrossOrigin(w, r, rt, id, err)
+			return
+		} else if err != nil {
+			hp.logRejection(r, "csrf_report_only", id, "", err, "Served a cross-origin request for session=%q: %v", id, err)
+			hp.report(r)
+		}
+		decision = Skip
+	}
+
+	if decision != Skip {
+		skip, err := hp.fetchMetadata(r)
+		if err != nil {
+			if hp.OnInvalid != nil {
+				hp.OnInvalid(r, err)
+			}
+
+			if decision != ReportOnly {
+				hp.rejectCrossOrigin(w, r, rt, id, err)
+				return
+			}
+			hp.logRejection(r, "csrf_report_only", id, "", err, "Served a cross-site request for session=%q.", id)
+			hp.report(r)
+		} else if skip {
+			decision = Skip
+		}
+	}
+
+	if decision != Skip {
+		if err := hp.checkOrigin(r); err != nil {
+			if hp.OnInvalid != nil {
+				hp.OnInvalid(r, err)
+			}
+
+			if decision != ReportOnly {
+				hp.rejectCrossOrigin(w, r, rt, id, err)
+				return
+			}
+			hp.logRejection(r, "csrf_report_only", id, "", err, "Served a request from an untrusted origin for session=%q.", id)
+			hp.report(r)
+		}
+
+		cs := hp.candidates(r, rt)
+		bound := hp.bindRequest(r, csrf)
+		c, ok, err := hp.validateAny(r, bound, id, cs)
+		if !ok && err == nil {
+			var prev candidate
+			if prev, ok, err = hp.validatePrevious(r, bound, cs); ok {
+				c = prev
+			}
+		}
+
+		if !ok && err == nil {
+			var legacy candidate
+			if legacy, ok, err = hp.validateLegacy(r, cs); ok {
+				c = legacy
 			}
 		}
 
-		if valid {
-			h.ServeHTTP(w, r)
-		} else if hp.InvalidHandler != nil {
-			hp.InvalidHandler.ServeHTTP(w, r)
+		if err != nil {
+			hp.handleError(w, r, err)
+			return
+		}
+
+		if ok {
+			if hp.OnValid != nil {
+				hp.OnValid(r)
+			}
+
+			if hp.OnTokenSource != nil {
+				hp.OnTokenSource(r, c.source)
+			}
+
+			if c.stale && hp.StaleHeader != "" {
+				w.Header().Set(hp.StaleHeader, "1")
+			}
+			csrf = hp.advanceChain(w, r, rt.csrf, c.token)
 		} else {
-			log.Printf("Rejected request with an invalid CSRF token=%q for session=%q. (event=csrf_invalid)",
-				token, id)
-			w.WriteHeader(http.StatusForbidden)
+			var token string
+			if len(cs) > 0 {
+				token = cs[0].token
+			}
+
+			if hp.OnInvalid != nil {
+				hp.OnInvalid(r, c.err)
+			}
+
+			if decision != ReportOnly {
+				hp.reject(w, r, rt, token, id, c.err)
+				return
+			}
+			hp.logRejection(r, "csrf_report_only", id, token, c.err, "Served request with an invalid CSRF token=%q for session=%q.", hp.redact(token), id)
+			hp.report(r)
 		}
-	})
+	}
+
+	if hp.DoubleSubmit && id == "" {
+		id = hp.newDoubleSubmitID(w, r, csrf)
+	}
+
+	r = hp.issue(w, r, rt, csrf, id)
+	if iw := hp.inject(w, r); iw != nil {
+		h.ServeHTTP(iw, r)
+		iw.finish()
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// report records that a request which would have been rejected was served.
+func (hp *HTTPParams) report(r *http.Request) {
+	if hp.OnReport != nil {
+		hp.OnReport(r)
+	}
+}
+
+// candidates returns the tokens presented with the request.
+func (hp *HTTPParams) candidates(r *http.Request, rt route) []candidate {
+	if len(rt.tokenExtractors) > 0 {
+		return extractCandidates(r, rt.tokenExtractors)
+	}
+
+	cs := candidates(r, rt.csrfHeader, rt.csrfCookie)
+	if hp.CSRFFormField != "" {
+		cs = addCandidate(cs, "form", formValue(r, hp.CSRFFormField, hp.MaxFormSize))
+	}
+
+	if hp.CSRFJSONField != "" {
+		cs = addCandidate(cs, "json", jsonValue(r, hp.CSRFJSONField, hp.MaxFormSize))
+	}
+	return cs
+}
+
+func (hp *HTTPParams) reject(w http.ResponseWriter, r *http.Request, rt route, token, id string, err error) {
+	if rt.invalidHandler != nil {
+		rt.invalidHandler.ServeHTTP(w, r)
+		return
+	}
+
+	missing := errors.Is(err, ErrMissingToken) || errors.Is(err, ErrMissingSession)
+	if missing && rt.missingStatusCode != 0 {
+		hp.logRejection(r, "csrf_missing", id, token, err, "Rejected request without a CSRF token=%q or session=%q.", hp.redact(token), id)
+		hp.writeRejection(w, r, rt.missingStatusCode, rejectionReason(err))
+		return
+	}
+
+	hp.logRejection(r, "csrf_invalid", id, token, err, "Rejected request with an invalid CSRF token=%q for session=%q.", hp.redact(token), id)
+	hp.writeRejection(w, r, rt.invalidStatusCode, rejectionReason(err))
+}
+
+// handleError responds to a request which failed unexpectedly.
+func (hp *HTTPParams) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if hp.ErrorHandler != nil {
+		hp.ErrorHandler(w, r, err)
+		return
+	}
+
+	hp.logf(r, "csrf_error", logFields{reason: err}, "Unable to check the CSRF token: %v", err)
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func (hp *HTTPParams) sessionID(r *http.Request) (string, error) {
+	if hp.DoubleSubmit {
+		return hp.doubleSubmitID(r), nil
+	}
+
+	if hp.SessionFunc != nil {
+		return hp.SessionFunc(r)
+	}
+
+	if len(hp.SessionExtractors) > 0 {
+		return extract(r, hp.SessionExtractors)
+	}
+	return headerOrCookieValue(r, hp.SessionHeader, hp.SessionCookie)
 }
 
-func headerOrCookieValue(r *http.Request, headerName, cookieName string) string {
+func headerOrCookieValue(r *http.Request, headerName, cookieName string) (string, error) {
 	if headerName != "" {
 		token := r.Header.Get(headerName)
 		if token != "" {
-			return token
+			return token, nil
 		}
 	}
 
 	if cookieName != "" {
 		cookie, err := r.Cookie(cookieName)
 		if err == nil {
-			return cookie.Value
+			return cookie.Value, nil
 		} else if err != http.ErrNoCookie {
-			// This should never occur
-			panic(err)
+			return "", err
 		}
 	}
 
-	return ""
+	return "", nil
 }
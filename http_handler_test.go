@@ -1,6 +1,7 @@
 package charlie
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -94,6 +95,42 @@ func TestHTTPWrapping(t *testing.T) {
 	}
 }
 
+func TestHTTPMiddleware(t *testing.T) {
+	hp := &HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+	}
+
+	// Middleware composes with other middleware, in the order given.
+	var chain []string
+	logging := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chain = append(chain, "logging")
+			h.ServeHTTP(w, r)
+		})
+	}
+	var handler http.Handler = noContentHandler
+	for _, m := range []func(http.Handler) http.Handler{hp.Middleware(), logging} {
+		handler = m(handler)
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(testSessionHeader, testSessionID)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden || len(chain) != 1 {
+		t.Errorf("Expected a 403 after logging, got %d after %v", res.Code, chain)
+	}
+
+	req.Header.Set(testCSRFHeader, New(hp.Key).Generate(testSessionID))
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected a 204 with a valid token, got %d", res.Code)
+	}
+}
+
 func TestHTTPWrappingMisconfiguration(t *testing.T) {
 	v := HTTPParams{}
 
@@ -114,3 +151,165 @@ func TestHTTPWrappingMisconfiguration(t *testing.T) {
 	}
 
 }
+
+func TestHTTPEnforceIf(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		EnforceIf: func(r *http.Request) bool {
+			_, err := r.Cookie(testSessionCookie)
+			return err == nil
+		},
+	}
+
+	handler := v.Wrap(noContentHandler)
+
+	// Unauthenticated requests aren't checked
+	res := httptest.ResponseRecorder{}
+	handler.ServeHTTP(&res, &http.Request{Header: http.Header{}})
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 for an unauthenticated request, got %d", res.Code)
+	}
+
+	// Authenticated requests are
+	req := http.Request{Header: http.Header{}}
+	req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+	res = httptest.ResponseRecorder{}
+	handler.ServeHTTP(&res, &req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected to receive a 403 for an authenticated request, got %d", res.Code)
+	}
+}
+
+func TestHTTPStaleHeader(t *testing.T) {
+	now := time.Now()
+	csrf := New([]byte(testKey))
+	csrf.SoftMaxAge = 5 * time.Minute
+	csrf.timer = func() time.Time { return now }
+
+	v := HTTPParams{
+		Params:        csrf,
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		StaleHeader:   "csrf-stale",
+		IssueHeader:   testCSRFHeader,
+	}
+	handler := v.Wrap(noContentHandler)
+	token := csrf.Generate(testSessionID)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		req.Header.Set(testCSRFHeader, token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := send(); res.Code != 204 || res.Header().Get("csrf-stale") != "" {
+		t.Errorf("Fresh token got %d, stale=%q", res.Code, res.Header().Get("csrf-stale"))
+	}
+
+	now = now.Add(6 * time.Minute)
+	res := send()
+	if res.Code != 204 || res.Header().Get("csrf-stale") != "1" {
+		t.Errorf("Stale token got %d, stale=%q", res.Code, res.Header().Get("csrf-stale"))
+	}
+
+	if fresh := res.Header().Get(testCSRFHeader); fresh == "" || fresh == token {
+		t.Errorf("Stale token wasn't replaced: %q", fresh)
+	}
+}
+
+func TestHTTPMaxAge(t *testing.T) {
+	v := HTTPParams{Key: []byte(testKey)}
+	if v.params().MaxAge != 3*time.Hour {
+		t.Errorf("Default MaxAge was %v", v.params().MaxAge)
+	}
+
+	v.MaxAge = time.Minute
+	if v.params().MaxAge != time.Minute {
+		t.Errorf("MaxAge was %v, but expected 1m", v.params().MaxAge)
+	}
+
+	csrf := New([]byte(testKey))
+	v.Params = csrf
+	if v.params() != csrf {
+		t.Error("Expected the given Params to be used")
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	v := HTTPParams{Key: []byte(testKey)}
+	err := errors.New("unexpected")
+
+	req := httptest.NewRequest("POST", "/", nil)
+	res := httptest.NewRecorder()
+	v.handleError(res, req, err)
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("Expected to receive a 500 by default, got %d", res.Code)
+	}
+
+	var handled error
+	v.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	res = httptest.NewRecorder()
+	v.handleError(res, req, err)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected to receive a 503 from the ErrorHandler, got %d", res.Code)
+	}
+
+	if handled != err {
+		t.Errorf("ErrorHandler was called with %v, but expected %v", handled, err)
+	}
+}
+
+func TestHTTPOnValidAndOnInvalid(t *testing.T) {
+	var valid int
+	var invalid []error
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+		OnValid:       func(r *http.Request) { valid++ },
+		OnInvalid:     func(r *http.Request, err error) { invalid = append(invalid, err) },
+	}
+	handler := v.Wrap(noContentHandler)
+	token := New(v.Key).Generate(testSessionID)
+
+	send := func(id, token string) {
+		req := httptest.NewRequest("POST", "/", nil)
+		if id != "" {
+			req.Header.Set(testSessionHeader, id)
+		}
+		if token != "" {
+			req.Header.Set(testCSRFHeader, token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send(testSessionID, token)
+	send("", token)
+	send(testSessionID, "")
+	send("notasession", token)
+
+	if valid != 1 {
+		t.Errorf("OnValid was called %d times, but expected 1", valid)
+	}
+
+	if len(invalid) != 3 {
+		t.Fatalf("OnInvalid was called %d times, but expected 3", len(invalid))
+	}
+
+	for i, want := range []error{ErrMissingSession, ErrMissingToken, ErrBadMAC} {
+		if !errors.Is(invalid[i], want) {
+			t.Errorf("OnInvalid was called with %v, but expected %v", invalid[i], want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package charlie
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	headTag    = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+	formTag    = regexp.MustCompile(`(?i)<form\b[^>]*>`)
+	postMethod = regexp.MustCompile(`(?i)\bmethod\s*=\s*["']?post\b`)
+	formAction = regexp.MustCompile(`(?i)\saction\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// maxInjectBuffer is the most of an HTML response which is buffered to inject
+// a token into it. Beyond it, the response is written as if it were flushed.
+const maxInjectBuffer = 1 << 20
+
+// injects returns true if the middleware injects tokens into HTML responses.
+func (hp *HTTPParams) injects() bool {
+	return hp.InjectMeta != "" || (hp.InjectForms && hp.CSRFFormField != "")
+}
+
+// inject returns a writer which injects the token issued with the response to
+// the given request into its body, if it's HTML, or nil if there's nothing to
+// inject.
+func (hp *HTTPParams) inject(w http.ResponseWriter, r *http.Request) *injector {
+	if !hp.injects() || r.Context().Value(tokenKey{}) == nil {
+		return nil
+	}
+	return &injector{ResponseWriter: w, hp: hp, r: r}
+}
+
+// injectHTML returns the given HTML, in response to the given request, with the
+// given token in a meta tag in its head and in a hidden input in each of its
+// forms with method post which submit to the request's own origin.
+func (hp *HTTPParams) injectHTML(r *http.Request, body []byte, token string) []byte {
+	if hp.InjectMeta != "" {
+		meta := `<meta name="` + template.HTMLEscapeString(hp.InjectMeta) +
+			`" content="` + template.HTMLEscapeString(token) + `">`
+		if loc := headTag.FindIndex(body); loc != nil {
+			body = bytes.Join([][]byte{body[:loc[1]], []byte(meta), body[loc[1]:]}, nil)
+		}
+	}
+
+	if hp.InjectForms && hp.CSRFFormField != "" {
+		input := `<input type="hidden" name="` + template.HTMLEscapeString(hp.CSRFFormField) +
+			`" value="` + template.HTMLEscapeString(token) + `">`
+		body = formTag.ReplaceAllFunc(body, func(tag []byte) []byte {
+			if !postMethod.Match(tag) || !sameOriginAction(r, tag) {
+				return tag
+			}
+			return append(tag[:len(tag):len(tag)], input...)
+		})
+	}
+	return body
+}
+
+// sameOriginAction returns true if the given form tag submits to the origin of
+// the given request: if its action is missing, empty, or relative, or if it's
+// an absolute URL with the request's host and a scheme no less secure.
+func sameOriginAction(r *http.Request, tag []byte) bool {
+	m := formAction.FindSubmatch(tag)
+	if m == nil {
+		return true
+	}
+
+	u, err := url.Parse(strings.TrimSpace(html.UnescapeString(string(m[1]) + string(m[2]) + string(m[3]))))
+	if err != nil {
+		return false
+	} else if u.Scheme == "" && u.Host == "" {
+		return true
+	}
+
+	switch {
+	case strings.EqualFold(u.Scheme, "https"):
+	case strings.EqualFold(u.Scheme, "http") && r.TLS == nil:
+	default:
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// injector buffers an HTML response to inject a token into it before it's
+// written. Other responses are written as they are. Like responseWriter, it
+// forwards http.Flusher, http.Hijacker, http.Pusher, and io.ReaderFrom.
+type injector struct {
+	http.ResponseWriter
+	hp          *HTTPParams
+	r           *http.Request
+	code        int
+	wroteHeader bool
+	buf         *bytes.Buffer // buf holds an HTML response until it's finished.
+}
+
+func (w *injector) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if w.html(code) {
+		w.code, w.buf = code, new(bytes.Buffer)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *injector) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.buf != nil {
+		n, err := w.buf.Write(b)
+		if w.buf.Len() > maxInjectBuffer {
+			w.finish()
+		}
+		return n, err
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush writes whatever HTML has been buffered, with the token injected, then
+// flushes the response. Anything written afterwards is written as it is.
+func (w *injector) Flush() {
+	w.finish()
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack hijacks the underlying connection, discarding any buffered HTML.
+func (w *injector) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.wroteHeader, w.buf = true, nil
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *injector) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		// Leave the content type unsniffed rather than read ahead.
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.buf != nil {
+		n, err := w.buf.ReadFrom(io.LimitReader(src, int64(maxInjectBuffer+1-w.buf.Len())))
+		if err != nil || w.buf.Len() <= maxInjectBuffer {
+			return n, err
+		}
+
+		w.finish()
+		m, err := readFrom(w.ResponseWriter, src)
+		return n + m, err
+	}
+	return readFrom(w.ResponseWriter, src)
+}
+
+func (w *injector) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use by
+// http.ResponseController.
+func (w *injector) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// html returns true if the response is uncompressed HTML with a body.
+func (w *injector) html(code int) bool {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	} else if w.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mt, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	return mt == "text/html"
+}
+
+// finish writes the buffered HTML, if any, with the token injected.
+func (w *injector) finish() {
+	if w.buf == nil {
+		return
+	}
+
+	t := issuedTokenFromContext(w.r.Context())
+	body := w.hp.injectHTML(w.r, w.buf.Bytes(), t.token)
+	w.buf = nil
+
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.code)
+	_, _ = w.ResponseWriter.Write(body)
+}
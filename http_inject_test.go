@@ -0,0 +1,134 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPInject(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFFormField: "csrf",
+		SessionHeader: testSessionHeader,
+		InjectMeta:    "csrf-token",
+		InjectForms:   true,
+	}
+
+	page := `<html><head><title>woo</title></head><body>` +
+		`<form method="POST" action="/a"></form><form action="/b"></form>` +
+		`<form method="post" action="https://evil.example/c"></form><form method="post" action='//evil.example/d'></form>` +
+		`<form method=post action=http://example.com/e></form></body></html>`
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1")
+		_, _ = w.Write([]byte(page))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(testSessionHeader, testSessionID)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	body := res.Body.String()
+	i := strings.Index(body, `<meta name="csrf-token" content="`)
+	if i < 0 || !strings.HasPrefix(body, `<html><head><meta`) {
+		t.Fatalf("Meta tag wasn't injected: %s", body)
+	}
+	token := strings.SplitN(body[i+33:], `"`, 2)[0]
+
+	if err := New(v.Key).Validate(testSessionID, token); err != nil {
+		t.Errorf("Injected token was invalid: %v", err)
+	}
+
+	input := `<input type="hidden" name="csrf" value="` + token + `">`
+	if !strings.Contains(body, `action="/a">`+input+`</form>`) {
+		t.Errorf("Hidden input wasn't injected into the post form: %s", body)
+	}
+
+	if !strings.Contains(body, `action=http://example.com/e>`+input+`</form>`) {
+		t.Errorf("Hidden input wasn't injected into the same-origin form: %s", body)
+	}
+
+	if !strings.Contains(body, `action="/b"></form>`) {
+		t.Errorf("Hidden input was injected into the get form: %s", body)
+	}
+
+	if strings.Contains(body, `evil.example/c">`+input) || strings.Contains(body, `evil.example/d'>`+input) {
+		t.Errorf("Hidden input was injected into a cross-origin form: %s", body)
+	}
+
+	if res.Header().Get("Content-Length") != "" || res.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Unexpected headers: %v", res.Header())
+	}
+}
+
+func TestHTTPInjectNonHTML(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		SessionHeader: testSessionHeader,
+		InjectMeta:    "csrf-token",
+	}
+
+	for _, tc := range []struct {
+		contentType, encoding string
+	}{
+		{contentType: "application/json"},
+		{contentType: "text/html", encoding: "gzip"},
+	} {
+		body := `<head></head>`
+		handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.contentType)
+			if tc.encoding != "" {
+				w.Header().Set("Content-Encoding", tc.encoding)
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if res.Body.String() != body {
+			t.Errorf("%s/%s: body was rewritten to %s", tc.contentType, tc.encoding, res.Body.String())
+		}
+	}
+}
+
+func TestHTTPInjectLargeResponse(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		SessionHeader: testSessionHeader,
+		InjectMeta:    "csrf-token",
+	}
+
+	var buffered int
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head></head><body>`))
+		for i := 0; i < 2*maxInjectBuffer/1024; i++ {
+			_, _ = w.Write(make([]byte, 1024))
+			if w.(*injector).buf != nil {
+				buffered++
+			}
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(testSessionHeader, testSessionID)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if buffered > maxInjectBuffer/1024 {
+		t.Errorf("%d KiB were buffered, but expected at most %d", buffered, maxInjectBuffer/1024)
+	}
+
+	if !strings.HasPrefix(res.Body.String(), `<html><head><meta name="csrf-token"`) {
+		t.Errorf("Meta tag wasn't injected: %.64s", res.Body.String())
+	}
+
+	if want := 25 + 2*maxInjectBuffer; res.Body.Len() <= want {
+		t.Errorf("Body was %d bytes, but expected more than %d", res.Body.Len(), want)
+	}
+}
@@ -0,0 +1,58 @@
+package charlie
+
+import "net/http"
+
+// tokenWriters returns the TokenWriters to which fresh tokens are issued.
+func (hp *HTTPParams) tokenWriters() []TokenWriter {
+	writers := append([]TokenWriter(nil), hp.TokenWriters...)
+	if hp.IssueHeader != "" {
+		writers = append(writers, ToHeader(hp.IssueHeader))
+	}
+
+	if hp.IssueCookie != "" {
+		c := http.Cookie{Name: hp.IssueCookie}
+		if hp.IssueCookieAttributes != nil {
+			c = *hp.IssueCookieAttributes
+			c.Name = hp.IssueCookie
+		}
+		writers = append(writers, cookieWriter(c, hp.InsecureCookies))
+	}
+	return writers
+}
+
+// issues returns true if the middleware issues tokens.
+func (hp *HTTPParams) issues() bool {
+	return len(hp.TokenWriters) > 0 || hp.IssueHeader != "" || hp.IssueCookie != ""
+}
+
+// issue generates a fresh token for the given session, sends it with the
+// response, and returns the request with the token in its context for
+// TokenFromContext. If the IssueLimit stops it, the context has the valid token
+// the request presented, if any, instead.
+func (hp *HTTPParams) issue(w http.ResponseWriter, r *http.Request, rt route, csrf *Params, id string) *http.Request {
+	if id == "" {
+		return r
+	}
+
+	rw, _ := w.(*responseWriter)
+	if hp.limitIssue(r, csrf, id) {
+		if token := hp.presentedToken(r, rt, csrf, id); token != "" {
+			return hp.withToken(r, rw, token)
+		}
+		return r
+	}
+
+	token, err := csrf.GenerateContext(r.Context(), id)
+	if err != nil {
+		return r
+	}
+
+	for _, tw := range hp.tokenWriters() {
+		tw.WriteToken(w, r, token)
+	}
+
+	if rw != nil && hp.issues() {
+		rw.issued = true
+	}
+	return hp.withToken(r, rw, token)
+}
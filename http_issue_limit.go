@@ -0,0 +1,75 @@
+package charlie
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxLimitedSessions bounds the number of sessions IssueLimit tracks each
+// minute. Once reached, further sessions aren't tracked, and so aren't limited,
+// until the next minute, so that a flood of new session IDs can't reset the
+// counts of those already tracked.
+const maxLimitedSessions = 10000
+
+// IssueLimit caps the number of tokens the middleware issues to each session
+// per minute, so that misbehaving clients can't make it generate tokens for
+// every request. Requests beyond the cap are served without a fresh token:
+// clients continue to use the last one issued, and TokenFromContext and
+// TemplateField return the valid token the request presented, if any. Only
+// the first such request per session per minute is logged.
+//
+// An IssueLimit must not be copied after first use.
+type IssueLimit struct {
+	PerMinute int // PerMinute is the number of tokens issued per session.
+
+	mu     sync.Mutex
+	minute int64
+	counts map[string]int
+}
+
+// take counts a token issued to the given session, returning the number issued
+// to it in the current minute, including this one.
+func (l *IssueLimit) take(id string, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	minute := now.Unix() / 60
+	if l.counts == nil || l.minute != minute {
+		l.minute = minute
+		l.counts = make(map[string]int)
+	}
+
+	n, ok := l.counts[id]
+	if !ok && len(l.counts) >= maxLimitedSessions {
+		return 1
+	}
+
+	l.counts[id] = n + 1
+	return n + 1
+}
+
+// limitIssue returns true if issuing a token to the given session would exceed
+// the IssueLimit.
+func (hp *HTTPParams) limitIssue(r *http.Request, csrf *Params, id string) bool {
+	if hp.IssueLimit == nil || hp.IssueLimit.PerMinute <= 0 {
+		return false
+	}
+
+	n := hp.IssueLimit.take(id, csrf.timer())
+	if n == hp.IssueLimit.PerMinute+1 {
+		hp.logf(r, "csrf_issue_limited", logFields{session: id}, "Stopped issuing CSRF tokens to session=%q for the rest of the minute.", id)
+	}
+	return n > hp.IssueLimit.PerMinute
+}
+
+// presentedToken returns the first token presented with the request which is
+// valid for the given session, if any.
+func (hp *HTTPParams) presentedToken(r *http.Request, rt route, csrf *Params, id string) string {
+	for _, c := range hp.candidates(r, rt) {
+		if csrf.Inspect(id, c.token).Valid {
+			return c.token
+		}
+	}
+	return ""
+}
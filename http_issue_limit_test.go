@@ -0,0 +1,107 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIssueLimit(t *testing.T) {
+	l := &IssueLimit{PerMinute: 2}
+	now := time.Unix(600, 0)
+
+	for i, expected := range []int{1, 2, 3} {
+		if n := l.take("a", now); n != expected {
+			t.Errorf("Take %d returned %d, but expected %d", i, n, expected)
+		}
+	}
+
+	if n := l.take("b", now); n != 1 {
+		t.Errorf("Take for another session returned %d, but expected 1", n)
+	}
+
+	if n := l.take("a", now.Add(time.Minute)); n != 1 {
+		t.Errorf("Take in the next minute returned %d, but expected 1", n)
+	}
+}
+
+func TestIssueLimitSessionFlood(t *testing.T) {
+	l := &IssueLimit{PerMinute: 2}
+	now := time.Unix(600, 0)
+
+	l.take("a", now)
+	l.take("a", now)
+	for i := 0; i < maxLimitedSessions; i++ {
+		l.take(strconv.Itoa(i), now)
+	}
+
+	if n := l.take("a", now); n != 3 {
+		t.Errorf("Take after a flood returned %d, but expected 3", n)
+	}
+}
+
+func TestHTTPIssueLimit(t *testing.T) {
+	csrf := New([]byte(testKey))
+	csrf.timer = func() time.Time { return time.Unix(600, 0) }
+
+	v := HTTPParams{
+		Params:        csrf,
+		SessionCookie: testSessionCookie,
+		IssueHeader:   "X-Next-Token",
+		IssueLimit:    &IssueLimit{PerMinute: 2},
+		Policy:        &Policy{Default: Skip},
+	}
+	handler := v.Wrap(noContentHandler)
+
+	var issued int
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if res.Code != 204 {
+			t.Errorf("Status was %d, but expected 204", res.Code)
+		}
+
+		if res.Header().Get("X-Next-Token") != "" {
+			issued++
+		}
+	}
+
+	if issued != 2 {
+		t.Errorf("Issued %d tokens, but expected 2", issued)
+	}
+}
+
+func TestHTTPIssueLimitPresentedToken(t *testing.T) {
+	csrf := New([]byte(testKey))
+	csrf.timer = func() time.Time { return time.Unix(600, 0) }
+	token := csrf.Generate(testSessionID)
+
+	v := HTTPParams{
+		Params:        csrf,
+		SessionCookie: testSessionCookie,
+		CSRFHeader:    testCSRFHeader,
+		IssueLimit:    &IssueLimit{PerMinute: 1},
+	}
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(TokenFromContext(r.Context())))
+	}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		req.Header.Set(testCSRFHeader, token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if res.Body.String() == "" {
+			t.Errorf("Request %d had no token in its context", i)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPIssueHeaderAndCookie(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		IssueHeader:   "X-Next-Token",
+		IssueCookie:   "XSRF-TOKEN",
+		Policy: &Policy{
+			Rules: []Rule{{If: MethodIs("GET"), Then: Skip}},
+		},
+	}
+	handler := v.Wrap(noContentHandler)
+
+	// Safe requests are issued a token
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	token := res.Header().Get("X-Next-Token")
+	if token == "" {
+		t.Fatal("Expected a token in the response header")
+	}
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "XSRF-TOKEN" || cookies[0].Value != token {
+		t.Fatalf("Expected the same token in a cookie, but got %v", cookies)
+	}
+
+	if cookies[0].HttpOnly || cookies[0].Path != "/" || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Errorf("Unexpected cookie attributes: %v", cookies[0])
+	}
+
+	if v := res.Header().Get("Cache-Control"); v != "no-store" {
+		t.Errorf("Cache-Control was %q, but expected no-store", v)
+	}
+
+	// The issued token is valid for the session
+	req = httptest.NewRequest("POST", "/", nil)
+	req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+	req.Header.Set(testCSRFHeader, token)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Fatalf("Expected to receive a 204 with the issued token, got %d", res.Code)
+	}
+
+	if res.Header().Get("X-Next-Token") == "" {
+		t.Error("Expected a fresh token in the response header")
+	}
+
+	// Rejected requests and those without sessions aren't issued tokens
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/", nil),
+		httptest.NewRequest("GET", "/", nil),
+	} {
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if v := res.Header().Get("X-Next-Token"); v != "" {
+			t.Errorf("Expected no token for %s, but got %q", req.Method, v)
+		}
+	}
+}
+
+func TestHTTPIssueCookieAttributes(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		SessionCookie: testSessionCookie,
+		IssueCookie:   "XSRF-TOKEN",
+		IssueCookieAttributes: &http.Cookie{
+			Name:     "ignored",
+			Domain:   "example.com",
+			Path:     "/app",
+			MaxAge:   3600,
+			SameSite: http.SameSiteStrictMode,
+		},
+		Policy: &Policy{Default: Skip},
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+	res := httptest.NewRecorder()
+	v.Wrap(noContentHandler).ServeHTTP(res, req)
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a cookie, but got %v", cookies)
+	}
+
+	c := cookies[0]
+	if c.Name != "XSRF-TOKEN" || c.Value == "" || c.Domain != "example.com" || c.Path != "/app" ||
+		c.MaxAge != 3600 || c.SameSite != http.SameSiteStrictMode || !c.Secure {
+		t.Errorf("Unexpected cookie: %v", c)
+	}
+
+	// Over plain HTTP, cookies are only left insecure on request.
+	v.InsecureCookies = true
+	res = httptest.NewRecorder()
+	v.Wrap(noContentHandler).ServeHTTP(res, req)
+
+	if cookies := res.Result().Cookies(); len(cookies) != 1 || cookies[0].Secure {
+		t.Errorf("Unexpected cookies: %v", cookies)
+	}
+}
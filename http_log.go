@@ -0,0 +1,104 @@
+package charlie
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+)
+
+// logFields are the details of a log entry. With a Logger, they're its
+// attributes, rather than part of its message.
+type logFields struct {
+	session string
+	token   string // token is the token, as redact returns it.
+	source  string // source is where the token was found.
+	reason  error
+}
+
+// logf logs a message about a request, tagged with an event and the request's
+// ID, if any, to the Logger or the log package. With a Logger, the message is
+// the event's, and its details are attributes, along with the request's
+// method; otherwise, they're formatted into the message.
+func (hp *HTTPParams) logf(r *http.Request, event string, f logFields, format string, args ...interface{}) {
+	id := RequestIDFromContext(r.Context())
+	if hp.Logger != nil {
+		attrs := []slog.Attr{slog.String("event", event), slog.String("method", r.Method)}
+		if id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+
+		if f.session != "" {
+			attrs = append(attrs, slog.String("session", f.session))
+		}
+
+		if f.token != "" {
+			attrs = append(attrs, slog.String("token", f.token))
+		}
+
+		if f.source != "" {
+			attrs = append(attrs, slog.String("source", f.source))
+		}
+
+		if f.reason != nil {
+			attrs = append(attrs, slog.String("reason", f.reason.Error()))
+		}
+		hp.Logger.LogAttrs(r.Context(), eventLevel(event), eventMessage(event), attrs...)
+		return
+	}
+
+	if id != "" {
+		log.Printf(format+" (event=%s request_id=%q)", append(args, event, id)...)
+		return
+	}
+	log.Printf(format+" (event=%s)", append(args, event)...)
+}
+
+// eventMessage returns the message with which the given event is logged to a
+// Logger.
+func eventMessage(event string) string {
+	switch event {
+	case "csrf_invalid":
+		return "Rejected a request with an invalid CSRF token"
+	case "csrf_missing":
+		return "Rejected a request without a CSRF token or session"
+	case "csrf_cross_origin":
+		return "Rejected a cross-origin request"
+	case "csrf_report_only":
+		return "Served a request which would have been rejected"
+	case "csrf_unknown_key":
+		return "Received a CSRF token generated with an unknown key"
+	case "csrf_previous_session":
+		return "Accepted a CSRF token for the previous session"
+	case "csrf_legacy":
+		return "Accepted a legacy CSRF token"
+	case "csrf_issue_limited":
+		return "Stopped issuing CSRF tokens to a session for the rest of the minute"
+	case "csrf_session_error":
+		return "Unable to extract the session"
+	case "csrf_error":
+		return "Unable to check the CSRF token"
+	case "csrf_handler_panic":
+		return "Recovered from a panic in the wrapped handler"
+	}
+	return event
+}
+
+// eventLevel returns the level at which the given event is logged.
+func eventLevel(event string) slog.Level {
+	switch event {
+	case "csrf_error", "csrf_handler_panic":
+		return slog.LevelError
+	case "csrf_session_error":
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// redact returns the given token as it should be logged: as-is if LogTokens is
+// true, and otherwise redacted, unless it's empty.
+func (hp *HTTPParams) redact(token string) string {
+	if hp.LogTokens || token == "" {
+		return token
+	}
+	return "[redacted]"
+}
@@ -0,0 +1,85 @@
+package charlie
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHTTPLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	v := HTTPParams{
+		Key:             []byte(testKey),
+		CSRFHeader:      testCSRFHeader,
+		SessionHeader:   testSessionHeader,
+		RequestIDHeader: "X-Request-ID",
+		Logger:          slog.New(slog.NewJSONHandler(buf, nil)),
+	}
+	handler := v.Wrap(noContentHandler)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	req.Header.Set(testSessionHeader, testSessionID)
+	req.Header.Set(testCSRFHeader, "not-a-real-token")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log entry, but got %q", buf.String())
+	}
+
+	if entry["event"] != "csrf_invalid" || entry["request_id"] != "abc123" || entry["level"] != "INFO" {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+
+	// Details are attributes, not part of the message.
+	if entry["msg"] != "Rejected a request with an invalid CSRF token" || entry["session"] != testSessionID ||
+		entry["method"] != "POST" || entry["reason"] != "invalid token: wrong length" {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+
+	if entry["token"] != "[redacted]" || strings.Contains(buf.String(), "not-a-real-token") {
+		t.Errorf("Expected the token to be redacted, but got %q", buf.String())
+	}
+
+	// Tokens can be logged on request
+	v.LogTokens = true
+	buf.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(buf.String(), "not-a-real-token") {
+		t.Errorf("Expected the token to be logged, but got %q", buf.String())
+	}
+}
+
+func TestHTTPLogRedaction(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(testSessionHeader, testSessionID)
+	req.Header.Set(testCSRFHeader, "not-a-real-token")
+
+	res := httptest.NewRecorder()
+	v.Wrap(noContentHandler).ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("Expected to receive a 403, got %d", res.Code)
+	}
+
+	if strings.Contains(buf.String(), "not-a-real-token") {
+		t.Errorf("Expected the token to be redacted, but got %q", buf.String())
+	}
+}
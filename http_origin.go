@@ -0,0 +1,66 @@
+package charlie
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrUntrustedOrigin is the reason a request whose Origin or Referer is
+// neither the request's own origin nor one of the TrustedOrigins is invalid.
+var ErrUntrustedOrigin = errors.New("untrusted origin")
+
+// checkOrigin returns ErrUntrustedOrigin if the request comes from an origin
+// which isn't trusted, per its Origin header or, failing that, its Referer.
+// Requests with neither are left to their tokens.
+func (hp *HTTPParams) checkOrigin(r *http.Request) error {
+	if hp.TrustedOrigins == nil {
+		return nil
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = r.Referer()
+	}
+
+	if origin == "" {
+		return nil
+	}
+	return hp.trustOrigin(r, origin)
+}
+
+// trustOrigin returns ErrUntrustedOrigin if the given origin is neither the
+// request's own origin nor one of the TrustedOrigins.
+func (hp *HTTPParams) trustOrigin(r *http.Request, origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return ErrUntrustedOrigin
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+
+	for _, pattern := range hp.TrustedOrigins {
+		if originMatches(pattern, u.Scheme, u.Host) {
+			return nil
+		}
+	}
+	return ErrUntrustedOrigin
+}
+
+// originMatches returns true if an origin with the given scheme and host
+// matches the given pattern, e.g. "https://example.com" or
+// "https://*.example.com", which matches subdomains of any depth.
+func originMatches(pattern, scheme, host string) bool {
+	ps, ph, ok := strings.Cut(pattern, "://")
+	if !ok || !strings.EqualFold(ps, scheme) {
+		return false
+	}
+
+	if suffix, ok := strings.CutPrefix(ph, "*."); ok {
+		return len(host) > len(suffix)+1 && strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(suffix))
+	}
+	return strings.EqualFold(ph, host)
+}
@@ -0,0 +1,74 @@
+package charlie
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPTrustedOrigins(t *testing.T) {
+	var invalid error
+	v := HTTPParams{
+		Key:            []byte(testKey),
+		CSRFHeader:     testCSRFHeader,
+		SessionHeader:  testSessionHeader,
+		TrustedOrigins: []string{"https://*.example.com", "https://partner.test"},
+		OnInvalid:      func(r *http.Request, err error) { invalid = err },
+	}
+	handler := v.Wrap(noContentHandler)
+	token := New(v.Key).Generate(testSessionID)
+
+	for _, tc := range []struct {
+		origin, referer string
+		code            int
+	}{
+		{code: 204},
+		{origin: "https://app.test", code: 204},
+		{origin: "https://a.b.example.com", code: 204},
+		{origin: "https://partner.test", code: 204},
+		{referer: "https://partner.test/form", code: 204},
+		{origin: "https://example.com", code: http.StatusForbidden},
+		{origin: "http://a.example.com", code: http.StatusForbidden},
+		{origin: "https://evil.test", code: http.StatusForbidden},
+		{origin: "https://evilexample.com", code: http.StatusForbidden},
+		{referer: "https://evil.test/form", code: http.StatusForbidden},
+		{origin: "null", referer: "https://evil.test/", code: http.StatusForbidden},
+	} {
+		invalid = nil
+		req := httptest.NewRequest("POST", "https://app.test/", nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+		req.Header.Set(testCSRFHeader, token)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.referer != "" {
+			req.Header.Set("Referer", tc.referer)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != tc.code {
+			t.Errorf("Origin %q, Referer %q: expected a %d, got %d", tc.origin, tc.referer, tc.code, res.Code)
+		}
+
+		if tc.code != 204 && !errors.Is(invalid, ErrUntrustedOrigin) {
+			t.Errorf("Origin %q, Referer %q: OnInvalid was called with %v", tc.origin, tc.referer, invalid)
+		}
+	}
+}
+
+func TestHTTPTrustedOriginsUnset(t *testing.T) {
+	v := HTTPParams{Key: []byte(testKey), CSRFHeader: testCSRFHeader, SessionHeader: testSessionHeader}
+
+	req := httptest.NewRequest("POST", "https://app.test/", nil)
+	req.Header.Set(testSessionHeader, testSessionID)
+	req.Header.Set(testCSRFHeader, New(v.Key).Generate(testSessionID))
+	req.Header.Set("Origin", "https://evil.test")
+
+	res := httptest.NewRecorder()
+	v.Wrap(noContentHandler).ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected origins to be unchecked by default, got %d", res.Code)
+	}
+}
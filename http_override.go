@@ -0,0 +1,184 @@
+package charlie
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// An Override replaces parts of an HTTPParams' configuration for the requests
+// it matches, allowing a single wrapped handler to serve route groups with
+// different requirements. Zero-valued fields are left as configured.
+type Override struct {
+	// Path, if non-empty, restricts the Override to requests whose cleaned URL
+	// path is it or is beneath it, e.g. "/admin" matches "/admin" and
+	// "/admin/users" but not "/administrator".
+	Path string
+
+	// Pattern, if non-empty, restricts the Override to requests matching the
+	// given http.ServeMux pattern (e.g. "POST /api/items/{id}"). If Wrap is
+	// used inside a ServeMux, the Pattern must be identical to the one the
+	// request was routed by; otherwise, Wrap matches requests against it
+	// itself. Patterns are read when Wrap is called.
+	Pattern string
+
+	// Match, if non-nil, restricts the Override to requests for which it
+	// returns true.
+	Match func(r *http.Request) bool
+
+	// Exempt, if true, exempts matching requests from enforcement entirely.
+	Exempt bool
+
+	// Audience, if non-empty, scopes the tokens of matching requests to it:
+	// the middleware issues them tokens which are valid only for requests the
+	// Override also matches, and accepts no others, so that tokens leaked from
+	// one route group (e.g. "/public/") can't be used against a more sensitive
+	// one (e.g. "/admin/"). TokenHandler and RefreshHandler issue tokens for
+	// the Audience of the Override matching their own requests.
+	Audience string
+
+	MaxAge            time.Duration // MaxAge replaces the maximum age of tokens.
+	InvalidHandler    http.Handler  // InvalidHandler replaces the InvalidHandler.
+	MissingStatusCode int           // MissingStatusCode replaces the MissingStatusCode.
+	InvalidStatusCode int           // InvalidStatusCode replaces the InvalidStatusCode.
+	CSRFHeader        string        // CSRFHeader replaces the CSRFHeader.
+	CSRFCookie        string        // CSRFCookie replaces the CSRFCookie.
+	TokenExtractors   []Extractor   // TokenExtractors replace the TokenExtractors.
+}
+
+func (o *Override) matches(r *http.Request, pattern string) bool {
+	if o.Path != "" && (r.URL == nil || !underPath(r.URL.Path, o.Path)) {
+		return false
+	}
+
+	if o.Pattern != "" && o.Pattern != pattern {
+		return false
+	}
+	return o.Match == nil || o.Match(r)
+}
+
+// underPath returns true if the cleaned path p is dir or is beneath it.
+func underPath(p, dir string) bool {
+	p, dir = path.Clean("/"+p), path.Clean("/"+dir)
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// patternMux returns a ServeMux which resolves requests to the Overrides'
+// patterns, or nil if none of them have one.
+func (hp *HTTPParams) patternMux() *http.ServeMux {
+	var mux *http.ServeMux
+	for _, o := range hp.Overrides {
+		if o.Pattern == "" {
+			continue
+		}
+
+		if mux == nil {
+			mux = http.NewServeMux()
+		}
+		mux.Handle(o.Pattern, http.NotFoundHandler())
+	}
+	return mux
+}
+
+// pattern returns the ServeMux pattern which matches the request, if any.
+func pattern(r *http.Request, mux *http.ServeMux) string {
+	if r.Pattern != "" || mux == nil {
+		return r.Pattern
+	}
+
+	_, p := mux.Handler(r)
+	return p
+}
+
+// route is the effective configuration for a single request.
+type route struct {
+	exempt            bool
+	csrf              *Params
+	invalidHandler    http.Handler
+	missingStatusCode int
+	invalidStatusCode int
+	csrfHeader        string
+	csrfCookie        string
+	tokenExtractors   []Extractor
+}
+
+// route returns the configuration for the given request, after applying the
+// first matching Override, if any.
+func (hp *HTTPParams) route(r *http.Request, csrf *Params, mux *http.ServeMux) route {
+	rt := route{
+		csrf:              csrf,
+		invalidHandler:    hp.InvalidHandler,
+		missingStatusCode: hp.MissingStatusCode,
+		invalidStatusCode: hp.InvalidStatusCode,
+		csrfHeader:        hp.CSRFHeader,
+		csrfCookie:        hp.CSRFCookie,
+		tokenExtractors:   hp.TokenExtractors,
+	}
+
+	p := pattern(r, mux)
+	for i := range hp.Overrides {
+		o := &hp.Overrides[i]
+		if !o.matches(r, p) {
+			continue
+		}
+
+		rt.exempt = o.Exempt
+
+		if o.MaxAge != 0 || o.Audience != "" {
+			c := *csrf
+			if o.MaxAge != 0 {
+				c.MaxAge = o.MaxAge
+			}
+
+			if o.Audience != "" {
+				c.audience = o.Audience
+			}
+			rt.csrf = &c
+		}
+
+		if o.InvalidHandler != nil {
+			rt.invalidHandler = o.InvalidHandler
+		}
+
+		if o.MissingStatusCode != 0 {
+			rt.missingStatusCode = o.MissingStatusCode
+		}
+
+		if o.InvalidStatusCode != 0 {
+			rt.invalidStatusCode = o.InvalidStatusCode
+		}
+
+		if o.CSRFHeader != "" {
+			rt.csrfHeader = o.CSRFHeader
+		}
+
+		if o.CSRFCookie != "" {
+			rt.csrfCookie = o.CSRFCookie
+		}
+
+		if len(o.TokenExtractors) > 0 {
+			rt.tokenExtractors = o.TokenExtractors
+		}
+		break
+	}
+
+	rt.exempt = rt.exempt || (r.URL != nil && hp.exemptPath(r.URL.Path))
+	return rt
+}
+
+// exemptPath returns true if the given path, once cleaned, matches any of the
+// ExemptPaths.
+func (hp *HTTPParams) exemptPath(p string) bool {
+	p = path.Clean("/" + p)
+	for _, e := range hp.ExemptPaths {
+		if strings.ContainsAny(e, "*?[") {
+			if ok, _ := path.Match(e, p); ok {
+				return true
+			}
+		} else if underPath(p, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package charlie
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPOverrides(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+		Overrides: []Override{
+			{
+				Path:   "/short/",
+				MaxAge: time.Minute,
+			},
+			{
+				Match: func(r *http.Request) bool {
+					return r.Header.Get("X-API") != ""
+				},
+				CSRFHeader: "X-API-CSRF",
+				InvalidHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(444)
+				}),
+			},
+		},
+	}
+
+	csrf := New(v.Key)
+	csrf.timer = func() time.Time {
+		return time.Now().Add(-10 * time.Minute)
+	}
+	token := csrf.Generate(testSessionID)
+
+	handler := v.Wrap(noContentHandler)
+
+	// Default route accepts a ten minute old token
+	req := httptest.NewRequest("POST", "/long/", nil)
+	req.Header.Set(testCSRFHeader, token)
+	req.Header.Set(testSessionHeader, testSessionID)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 on the default route, got %d", res.Code)
+	}
+
+	// Overridden route with a shorter MaxAge rejects it
+	req.URL.Path = "/short/form"
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected to receive a 403 on the short route, got %d", res.Code)
+	}
+
+	// Overridden route with a different header and handler
+	req = httptest.NewRequest("POST", "/api/", nil)
+	req.Header.Set("X-API", "1")
+	req.Header.Set(testCSRFHeader, token)
+	req.Header.Set(testSessionHeader, testSessionID)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 444 {
+		t.Errorf("Expected to receive a 444 on the API route, got %d", res.Code)
+	}
+
+	req.Header.Set("X-API-CSRF", token)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 on the API route, got %d", res.Code)
+	}
+}
+
+func TestHTTPOverridePatterns(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+		Overrides: []Override{
+			{Pattern: "POST /webhooks/{provider}", Exempt: true},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /webhooks/{provider}", noContentHandler)
+	mux.Handle("POST /items/{id}", noContentHandler)
+
+	// Wrapping the whole mux
+	handler := v.Wrap(mux)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/webhooks/github", nil))
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 for an exempt pattern, got %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/items/1", nil))
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected to receive a 403 for a non-exempt pattern, got %d", res.Code)
+	}
+
+	// Wrapping inside the mux
+	mux = http.NewServeMux()
+	mux.Handle("POST /webhooks/{provider}", v.Wrap(noContentHandler))
+	mux.Handle("POST /items/{id}", v.Wrap(noContentHandler))
+
+	res = httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest("POST", "/webhooks/github", nil))
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 for an exempt pattern, got %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest("POST", "/items/1", nil))
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected to receive a 403 for a non-exempt pattern, got %d", res.Code)
+	}
+}
+
+func TestHTTPExemptPaths(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		ExemptPaths:   []string{"/webhooks/", "/oauth/*/callback"},
+	}
+	handler := v.Wrap(noContentHandler)
+
+	for path, code := range map[string]int{
+		"/webhooks/stripe":         204,
+		"/oauth/github/callback":   204,
+		"/oauth/github/authorize":  403,
+		"/oauth/a/b/callback":      403,
+		"/webhook":                 403,
+		"/webhooksadmin":           403,
+		"/webhooks/../admin":       403,
+		"//webhooks/stripe":        204,
+		"/oauth/./github/callback": 204,
+		"/":                        403,
+	} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != code {
+			t.Errorf("%s: status was %d, but expected %d", path, res.Code, code)
+		}
+	}
+}
+
+func TestHTTPOverrideAudience(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+		Overrides: []Override{
+			{Path: "/admin", Audience: "admin", InvalidStatusCode: 418},
+		},
+	}
+	handler := v.Wrap(noContentHandler)
+	tokens := v.TokenHandler()
+
+	token := func(path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+
+		res := httptest.NewRecorder()
+		tokens.ServeHTTP(res, req)
+
+		var body struct{ Token string }
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Token
+	}
+	public, admin := token("/csrf-token"), token("/admin/csrf-token")
+
+	for _, v := range []struct {
+		path, token string
+		code        int
+	}{
+		{"/comments", public, 204},
+		{"/comments", admin, 403},
+		{"/admin/users", admin, 204},
+		{"/admin/users", public, 418},
+		{"/admin/../comments", public, 204},
+		{"/administrator", public, 204},
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.URL.Path = v.path
+		req.Header.Set(testCSRFHeader, v.token)
+		req.Header.Set(testSessionHeader, testSessionID)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != v.code {
+			t.Errorf("%s: status was %d, but expected %d", v.path, res.Code, v.code)
+		}
+	}
+}
+
+func TestHTTPOverrideStatusCodes(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+		Overrides: []Override{
+			{
+				Path:              "/api/",
+				MissingStatusCode: 401,
+				InvalidStatusCode: 400,
+				TokenExtractors:   []Extractor{FromQuery("csrf")},
+			},
+		},
+	}
+	handler := v.Wrap(noContentHandler)
+	token := New(v.Key).Generate(testSessionID)
+
+	for _, v := range []struct {
+		target string
+		code   int
+	}{
+		{"/api/items", 401},
+		{"/api/items?csrf=bad", 400},
+		{"/api/items?csrf=" + token, 204},
+		{"/items?csrf=" + token, 403},
+	} {
+		req := httptest.NewRequest("POST", v.target, nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != v.code {
+			t.Errorf("%s: status was %d, but expected %d", v.target, res.Code, v.code)
+		}
+	}
+}
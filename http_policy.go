@@ -0,0 +1,164 @@
+package charlie
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// A Decision is how the middleware handles a request.
+type Decision int
+
+const (
+	// Enforce serves the request only if it has a valid token.
+	Enforce Decision = iota
+
+	// ReportOnly checks the request's token, logging it if invalid, but
+	// serves the request regardless.
+	ReportOnly
+
+	// Skip serves the request without checking for a token.
+	Skip
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Enforce:
+		return "enforce"
+	case ReportOnly:
+		return "report-only"
+	case Skip:
+		return "skip"
+	}
+	return "unknown"
+}
+
+// A Predicate reports whether a request has some property.
+type Predicate func(r *http.Request) bool
+
+// And returns a Predicate which matches requests matched by all of the given
+// predicates.
+func And(predicates ...Predicate) Predicate {
+	return func(r *http.Request) bool {
+		for _, p := range predicates {
+			if !p(r) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a Predicate which matches requests matched by any of the given
+// predicates.
+func Or(predicates ...Predicate) Predicate {
+	return func(r *http.Request) bool {
+		for _, p := range predicates {
+			if p(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a Predicate which matches requests not matched by the given
+// predicate.
+func Not(p Predicate) Predicate {
+	return func(r *http.Request) bool {
+		return !p(r)
+	}
+}
+
+// MethodIs returns a Predicate which matches requests with any of the given
+// methods.
+func MethodIs(methods ...string) Predicate {
+	return func(r *http.Request) bool {
+		for _, m := range methods {
+			if r.Method == m {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PathHasPrefix returns a Predicate which matches requests whose URL path
+// begins with the given prefix.
+func PathHasPrefix(prefix string) Predicate {
+	return func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+}
+
+// ContentTypeIs returns a Predicate which matches requests whose body has any
+// of the given media types (e.g. "application/json"), ignoring parameters.
+func ContentTypeIs(types ...string) Predicate {
+	return func(r *http.Request) bool {
+		mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return false
+		}
+
+		for _, t := range types {
+			if strings.EqualFold(mt, t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// A Rule applies a Decision to the requests matching a Predicate.
+type Rule struct {
+	If   Predicate
+	Then Decision
+}
+
+// A Policy decides how the middleware handles each request: with the Decision
+// of the first Rule which matches it, or with the Default. The zero Policy
+// enforces every request.
+type Policy struct {
+	Rules   []Rule
+	Default Decision
+}
+
+// Decide returns the Decision for the given request.
+func (p *Policy) Decide(r *http.Request) Decision {
+	for _, rule := range p.Rules {
+		if rule.If(r) {
+			return rule.Then
+		}
+	}
+	return p.Default
+}
+
+// defaultSafeMethods is the default value of HTTPParams.SafeMethods.
+var defaultSafeMethods = []string{"GET", "HEAD", "OPTIONS", "TRACE"}
+
+// decide returns the Decision for the given request, per SafeMethods,
+// EnforceIf, and Policy.
+func (hp *HTTPParams) decide(r *http.Request) Decision {
+	safe := hp.SafeMethods
+	if safe == nil {
+		safe = defaultSafeMethods
+	}
+
+	if MethodIs(safe...)(r) {
+		return Skip
+	}
+
+	if hp.EnforceIf != nil && !hp.EnforceIf(r) {
+		return Skip
+	}
+
+	d := Enforce
+	if hp.Policy != nil {
+		d = hp.Policy.Decide(r)
+	}
+
+	if d == Enforce && hp.ReportOnly {
+		return ReportOnly
+	}
+	return d
+}
@@ -0,0 +1,175 @@
+package charlie
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPredicates(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/items", nil)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	yes := func(r *http.Request) bool { return true }
+	no := func(r *http.Request) bool { return false }
+
+	for _, v := range []struct {
+		name string
+		p    Predicate
+		want bool
+	}{
+		{"and", And(yes, yes), true},
+		{"and false", And(yes, no), false},
+		{"or", Or(no, yes), true},
+		{"or false", Or(no, no), false},
+		{"not", Not(no), true},
+		{"method", MethodIs("PUT", "POST"), true},
+		{"method false", MethodIs("GET"), false},
+		{"path", PathHasPrefix("/api/"), true},
+		{"path false", PathHasPrefix("/admin/"), false},
+		{"content type", ContentTypeIs("application/json"), true},
+		{"content type false", ContentTypeIs("text/plain"), false},
+	} {
+		if got := v.p(req); got != v.want {
+			t.Errorf("%s: Predicate returned %v, but expected %v", v.name, got, v.want)
+		}
+	}
+}
+
+func TestPolicyDecide(t *testing.T) {
+	p := Policy{
+		Rules: []Rule{
+			{If: PathHasPrefix("/health"), Then: Skip},
+			{If: PathHasPrefix("/legacy/"), Then: ReportOnly},
+		},
+	}
+
+	for path, want := range map[string]Decision{
+		"/health":      Skip,
+		"/legacy/form": ReportOnly,
+		"/form":        Enforce,
+	} {
+		if got := p.Decide(httptest.NewRequest("POST", path, nil)); got != want {
+			t.Errorf("Decision for %s was %v, but expected %v", path, got, want)
+		}
+	}
+}
+
+func TestHTTPPolicy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	v := HTTPParams{
+		Key:        []byte(testKey),
+		CSRFHeader: testCSRFHeader,
+		Policy: &Policy{
+			Rules: []Rule{
+				{If: PathHasPrefix("/health"), Then: Skip},
+			},
+			Default: ReportOnly,
+		},
+	}
+	handler := v.Wrap(noContentHandler)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/health", nil))
+	if res.Code != 204 || buf.Len() != 0 {
+		t.Errorf("Expected to receive a 204 without logging, got %d and %q", res.Code, buf.String())
+	}
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/form", nil))
+	if res.Code != 204 {
+		t.Errorf("Expected to receive a 204 in report-only mode, got %d", res.Code)
+	}
+
+	if !strings.Contains(buf.String(), "event=csrf_report_only") {
+		t.Errorf("Expected a report-only log entry, but got %q", buf.String())
+	}
+}
+
+func TestHTTPReportOnly(t *testing.T) {
+	var reported []string
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		ReportOnly:    true,
+		EnforceIf:     PathHasPrefix("/form"),
+		OnReport: func(r *http.Request) {
+			reported = append(reported, r.URL.Path)
+		},
+	}
+	handler := v.Wrap(noContentHandler)
+
+	send := func(path, token string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set(testCSRFHeader, token)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	if code := send("/form", "woo"); code != 204 {
+		t.Errorf("Expected to receive a 204 in report-only mode, got %d", code)
+	}
+
+	if code := send("/form", v.params().Generate(testSessionID)); code != 204 {
+		t.Errorf("Expected to receive a 204 with a valid token, got %d", code)
+	}
+
+	if code := send("/other", "woo"); code != 204 {
+		t.Errorf("Expected to receive a 204 for a skipped request, got %d", code)
+	}
+
+	if len(reported) != 1 || reported[0] != "/form" {
+		t.Errorf("Reported %v, but expected only the invalid request", reported)
+	}
+
+	if d := v.decide(httptest.NewRequest("POST", "/form", nil)); d != ReportOnly {
+		t.Errorf("Decision was %v, but expected %v", d, ReportOnly)
+	}
+}
+
+func TestHTTPSafeMethods(t *testing.T) {
+	send := func(v *HTTPParams, method string) int {
+		req := httptest.NewRequest(method, "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+		res := httptest.NewRecorder()
+		v.Wrap(noContentHandler).ServeHTTP(res, req)
+		return res.Code
+	}
+
+	v := &HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+	}
+
+	for method, code := range map[string]int{
+		"GET": 204, "HEAD": 204, "OPTIONS": 204, "TRACE": 204,
+		"POST": 403, "PUT": 403, "PATCH": 403, "DELETE": 403,
+	} {
+		if v := send(v, method); v != code {
+			t.Errorf("%s: status was %d, but expected %d", method, v, code)
+		}
+	}
+
+	v.SafeMethods = []string{"GET"}
+	if code := send(v, "OPTIONS"); code != 403 {
+		t.Errorf("OPTIONS: status was %d, but expected 403", code)
+	}
+
+	v.SafeMethods = []string{}
+	if code := send(v, "GET"); code != 403 {
+		t.Errorf("GET: status was %d, but expected 403", code)
+	}
+}
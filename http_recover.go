@@ -0,0 +1,29 @@
+package charlie
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// recoverPanic recovers a panic from the wrapped handler, if any, responding
+// with a 500 if the handler hadn't yet written a response.
+func (hp *HTTPParams) recoverPanic(rw *responseWriter, r *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+
+	if hp.OnPanic != nil {
+		hp.OnPanic(r, v)
+	} else {
+		hp.logf(r, "csrf_handler_panic", logFields{reason: fmt.Errorf("%v", v)}, "Recovered from a panic in the wrapped handler: %v", v)
+	}
+
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
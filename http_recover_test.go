@@ -0,0 +1,86 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPRecoverPanics(t *testing.T) {
+	var recovered interface{}
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		RecoverPanics: true,
+		EnforceIf: func(r *http.Request) bool {
+			return false
+		},
+		OnPanic: func(r *http.Request, v interface{}) {
+			recovered = v
+		},
+	}
+
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(testCSRFHeader, "token")
+		panic("oh no")
+	}))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/", nil))
+
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("Expected to receive a 500, got %d", res.Code)
+	}
+
+	if recovered != "oh no" {
+		t.Errorf("Recovered %v, but expected %q", recovered, "oh no")
+	}
+
+	// The response is still finalized
+	if v, want := res.Header().Get("Cache-Control"), "no-store"; v != want {
+		t.Errorf("Cache-Control was %q, but expected %q", v, want)
+	}
+}
+
+func TestHTTPRecoverPanicsAfterWrite(t *testing.T) {
+	v := HTTPParams{
+		RecoverPanics: true,
+		EnforceIf: func(r *http.Request) bool {
+			return false
+		},
+		OnPanic: func(r *http.Request, v interface{}) {},
+	}
+
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("oh no")
+	}))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/", nil))
+
+	if res.Code != http.StatusAccepted {
+		t.Errorf("Expected to receive a 202, got %d", res.Code)
+	}
+}
+
+func TestHTTPAbortHandler(t *testing.T) {
+	v := HTTPParams{
+		RecoverPanics: true,
+		EnforceIf: func(r *http.Request) bool {
+			return false
+		},
+	}
+
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Recovered %v, but expected http.ErrAbortHandler", v)
+		}
+	}()
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+}
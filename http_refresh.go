@@ -0,0 +1,145 @@
+package charlie
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// minRefreshInterval limits how often RefreshHandler pushes tokens, since
+// token timestamps have a resolution of a second.
+const minRefreshInterval = time.Second
+
+// issuedTokenJSON is the JSON representation of an issued token.
+type issuedTokenJSON struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RefreshHandler returns a handler which sends fresh tokens for the request's
+// session before the client's tokens expire, for pages which stay open longer
+// than tokens last (e.g. those following Server-Sent Events) and would
+// otherwise submit expired tokens. Fresh tokens are sent as
+// {"token":"...","expires_at":"..."}, and are due to be refreshed once
+// they're stale (see Params.SoftMaxAge) or four fifths of the way to
+// expiring.
+//
+// Requests which accept text/event-stream (e.g. from an EventSource) get a
+// stream of "csrf-token" events, the first immediately and the others as
+// each token is due. Other requests are long polls: if they present a valid
+// token in the CSRFHeader, the response is held until it's due, and
+// otherwise it's sent immediately. Requests without a session are rejected.
+func (hp *HTTPParams) RefreshHandler() http.Handler {
+	base := hp.params()
+	mux := hp.patternMux()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csrf := hp.route(r, base, mux).csrf
+		id, err := hp.sessionID(r)
+		if err != nil || id == "" {
+			hp.writeRejection(w, r, 0, rejectionReason(ErrMissingSession))
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if acceptsEventStream(r.Header.Get("Accept")) {
+			hp.streamTokens(w, r, csrf, id)
+			return
+		}
+
+		for _, c := range candidates(r, hp.CSRFHeader, "") {
+			if info := csrf.Inspect(id, c.token); info.Valid {
+				if d := refreshAt(csrf, info).Sub(csrf.timer()); d > 0 && !sleep(r.Context(), d) {
+					return
+				}
+				break
+			}
+		}
+
+		t, _, err := freshToken(r.Context(), csrf, id)
+		if err != nil {
+			return
+		}
+
+		body, _ := json.Marshal(t)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+}
+
+// streamTokens sends fresh tokens as Server-Sent Events until the request is
+// done.
+func (hp *HTTPParams) streamTokens(w http.ResponseWriter, r *http.Request, csrf *Params, id string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	rc := http.NewResponseController(w)
+
+	for {
+		t, info, err := freshToken(r.Context(), csrf, id)
+		if err != nil {
+			return
+		}
+
+		data, _ := json.Marshal(t)
+		if _, err := w.Write([]byte("event: csrf-token\ndata: " + string(data) + "\n\n")); err != nil {
+			return
+		}
+		_ = rc.Flush()
+
+		d := refreshAt(csrf, info).Sub(csrf.timer())
+		if d < minRefreshInterval {
+			d = minRefreshInterval
+		}
+
+		if !sleep(r.Context(), d) {
+			return
+		}
+	}
+}
+
+// freshToken generates a token for the given session.
+func freshToken(ctx context.Context, csrf *Params, id string) (issuedTokenJSON, TokenInfo, error) {
+	token, err := csrf.GenerateContext(ctx, id)
+	if err != nil {
+		return issuedTokenJSON{}, TokenInfo{}, err
+	}
+
+	info := csrf.Inspect(id, token)
+	return issuedTokenJSON{Token: token, ExpiresAt: info.Expires.UTC()}, info, nil
+}
+
+// refreshAt returns when the given valid token is due to be refreshed.
+func refreshAt(csrf *Params, info TokenInfo) time.Time {
+	at := info.IssuedAt.Add(info.Expires.Sub(info.IssuedAt) * 4 / 5)
+	if soft := info.IssuedAt.Add(csrf.SoftMaxAge); csrf.SoftMaxAge > 0 && soft.Before(at) {
+		at = soft
+	}
+	return at
+}
+
+// sleep waits for the given duration, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// acceptsEventStream returns true if the given Accept header names
+// text/event-stream.
+func acceptsEventStream(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mr, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mr == "text/event-stream" && acceptQuality(accept, mr) > 0 {
+			return true
+		}
+	}
+	return false
+}
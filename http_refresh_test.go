@@ -0,0 +1,104 @@
+package charlie
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefreshHandler(t *testing.T) {
+	p := New([]byte(testKey))
+	p.MaxAge = time.Hour
+	hp := &HTTPParams{
+		Params:        p,
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+	}
+	handler := hp.RefreshHandler()
+
+	serve := func(ctx context.Context, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/csrf/refresh", nil).WithContext(ctx)
+		req.Header.Set(testSessionHeader, testSessionID)
+		if token != "" {
+			req.Header.Set(testCSRFHeader, token)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	// Without a session, the request is rejected.
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/csrf/refresh", nil))
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected a 403 without a session, got %d", res.Code)
+	}
+
+	// Without a token, or with one which is due, a fresh one is sent at once.
+	for _, token := range []string{"", p.GenerateAt(testSessionID, time.Now().Add(-55*time.Minute))} {
+		var body issuedTokenJSON
+		res := serve(context.Background(), token)
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.Validate(testSessionID, body.Token); err != nil {
+			t.Errorf("Refreshed token was invalid: %v", err)
+		}
+
+		if d := time.Until(body.ExpiresAt); d < 59*time.Minute || d > time.Hour {
+			t.Errorf("Refreshed token expires at %v", body.ExpiresAt)
+		}
+
+		if cc := res.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("Cache-Control was %q", cc)
+		}
+	}
+
+	// With a fresh token, the response is held until it's due.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if res := serve(ctx, p.Generate(testSessionID)); res.Body.Len() != 0 {
+		t.Errorf("Expected no refresh before the token is due, got %s", res.Body)
+	}
+}
+
+func TestRefreshHandlerEventStream(t *testing.T) {
+	p := New([]byte(testKey))
+	p.MaxAge = time.Second
+	hp := &HTTPParams{
+		Params:        p,
+		SessionHeader: testSessionHeader,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest("GET", "/csrf/refresh", nil).WithContext(ctx)
+	req.Header.Set(testSessionHeader, testSessionID)
+	req.Header.Set("Accept", "text/event-stream")
+	res := httptest.NewRecorder()
+	hp.RefreshHandler().ServeHTTP(res, req)
+
+	if ct := res.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type was %q", ct)
+	}
+
+	events := strings.Split(strings.TrimSuffix(res.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %q", events)
+	}
+
+	for _, e := range events {
+		data, ok := strings.CutPrefix(e, "event: csrf-token\ndata: ")
+		var body issuedTokenJSON
+		if !ok || json.Unmarshal([]byte(data), &body) != nil || body.Token == "" {
+			t.Errorf("Unexpected event: %q", e)
+		}
+	}
+}
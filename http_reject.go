@@ -0,0 +1,145 @@
+package charlie
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// writeRejection responds to a request rejected for the given reason with the
+// given status code and, if InvalidContentTypes is set or the request accepts
+// JSON, a body describing the rejection.
+func (hp *HTTPParams) writeRejection(w http.ResponseWriter, r *http.Request, code int, reason string) {
+	if code == 0 {
+		code = hp.InvalidStatusCode
+	}
+
+	if code == 0 {
+		code = http.StatusForbidden
+	}
+
+	var contentType string
+	if len(hp.InvalidContentTypes) > 0 {
+		contentType = negotiate(r.Header.Get("Accept"), hp.InvalidContentTypes)
+	} else if acceptsJSON(r.Header.Get("Accept")) {
+		contentType = "application/json"
+	} else {
+		w.WriteHeader(code)
+		return
+	}
+
+	body := rejectionBody(contentType, code, reason)
+	if contentType == "text/plain" {
+		contentType += "; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
+
+// rejectionBody returns the body of a rejection with the given content type,
+// status code, and reason: text/plain, application/json, or an RFC 9457
+// application/problem+json with the reason as an extension member.
+func rejectionBody(contentType string, code int, reason string) []byte {
+	const title = "Invalid CSRF token"
+
+	var v interface{}
+	switch contentType {
+	case "application/json":
+		v = struct {
+			Error  string `json:"error"`
+			Reason string `json:"reason"`
+		}{"invalid_csrf_token", reason}
+	case "application/problem+json":
+		v = struct {
+			Type   string `json:"type"`
+			Title  string `json:"title"`
+			Status int    `json:"status"`
+			Reason string `json:"reason"`
+		}{"about:blank", title, code, reason}
+	default:
+		return []byte(title + "\n")
+	}
+
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// rejectionReason returns the reason, for clients, that a request was rejected
+// because of the given error, e.g. "expired" or "missing_token".
+func rejectionReason(err error) string {
+	var e *ValidationError
+	switch {
+	case errors.As(err, &e):
+		return strings.ReplaceAll(strings.ToLower(e.Reason.String()), " ", "_")
+	case errors.Is(err, ErrBackendUnavailable):
+		return "backend_unavailable"
+	}
+	return "invalid"
+}
+
+// acceptsJSON returns true if the given Accept header names JSON, as API
+// clients' do, rather than accepting it only through a wildcard, as browsers'
+// do.
+func acceptsJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mr, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && (mr == "application/json" || strings.HasSuffix(mr, "+json")) &&
+			acceptQuality(accept, mr) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the offered media type which the given Accept header
+// prefers, or the first offered media type if it accepts none of them.
+func negotiate(accept string, offers []string) string {
+	best, bestQ := offers[0], 0.0
+	if accept == "" {
+		return best
+	}
+
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality with which the given Accept header accepts
+// the given media type, per its most specific matching media range.
+func acceptQuality(accept, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mr, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		s := -1
+		switch {
+		case mr == mediaType:
+			s = 2
+		case strings.HasSuffix(mr, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mr, "*")):
+			s = 1
+		case mr == "*/*":
+			s = 0
+		}
+
+		if s > specificity {
+			specificity, q = s, 1
+			if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return q
+}
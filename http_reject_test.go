@@ -0,0 +1,92 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPRejectionBodies(t *testing.T) {
+	v := HTTPParams{
+		Key:                 []byte(testKey),
+		CSRFHeader:          testCSRFHeader,
+		SessionHeader:       testSessionHeader,
+		InvalidStatusCode:   http.StatusUnprocessableEntity,
+		InvalidContentTypes: []string{"text/plain", "application/json", "application/problem+json"},
+	}
+	handler := v.Wrap(noContentHandler)
+
+	for _, tc := range []struct {
+		accept, contentType, body string
+	}{
+		{"", "text/plain; charset=utf-8", "Invalid CSRF token\n"},
+		{"application/json", "application/json", `{"error":"invalid_csrf_token","reason":"bad_encoding"}`},
+		{"application/problem+json, application/json;q=0.5", "application/problem+json",
+			`{"type":"about:blank","title":"Invalid CSRF token","status":422,"reason":"bad_encoding"}`},
+		{"text/*;q=0.1, application/*;q=0.9", "application/json", `{"error":"invalid_csrf_token","reason":"bad_encoding"}`},
+		{"image/png", "text/plain; charset=utf-8", "Invalid CSRF token\n"},
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+		req.Header.Set(testCSRFHeader, "woo")
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if res.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Accept %q: expected a 422, got %d", tc.accept, res.Code)
+		}
+
+		if ct := res.Header().Get("Content-Type"); ct != tc.contentType || res.Body.String() != tc.body {
+			t.Errorf("Accept %q: got %s %q, but expected %s %q", tc.accept, ct, res.Body.String(), tc.contentType, tc.body)
+		}
+	}
+}
+
+func TestHTTPRejectionWithoutBodies(t *testing.T) {
+	v := HTTPParams{Key: []byte(testKey), CSRFHeader: testCSRFHeader, SessionHeader: testSessionHeader}
+
+	res := httptest.NewRecorder()
+	v.Wrap(noContentHandler).ServeHTTP(res, httptest.NewRequest("POST", "/", nil))
+	if res.Code != http.StatusForbidden || res.Body.Len() != 0 {
+		t.Errorf("Expected an empty 403 by default, got %d %q", res.Code, res.Body.String())
+	}
+}
+
+func TestHTTPRejectionJSONByDefault(t *testing.T) {
+	now := time.Now()
+	csrf := New([]byte(testKey))
+	csrf.MaxAge = time.Hour
+	csrf.timer = func() time.Time { return now }
+
+	v := HTTPParams{Params: csrf, CSRFHeader: testCSRFHeader, SessionHeader: testSessionHeader}
+	handler := v.Wrap(noContentHandler)
+	token := csrf.Generate(testSessionID)
+	now = now.Add(2 * time.Hour)
+
+	for _, tc := range []struct {
+		accept, token, body string
+	}{
+		{"application/json", token, `{"error":"invalid_csrf_token","reason":"expired"}`},
+		{"application/vnd.api+json", "", `{"error":"invalid_csrf_token","reason":"missing_token"}`},
+		{"text/html,*/*;q=0.8", token, ""},
+		{"application/json;q=0", token, ""},
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Accept", tc.accept)
+		req.Header.Set(testSessionHeader, testSessionID)
+		if tc.token != "" {
+			req.Header.Set(testCSRFHeader, tc.token)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != http.StatusForbidden || res.Body.String() != tc.body {
+			t.Errorf("Accept %q: got %d %q, but expected 403 %q", tc.accept, res.Code, res.Body.String(), tc.body)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package charlie
+
+import (
+	"context"
+	"net/http"
+)
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request whose context is ctx, as
+// configured by HTTPParams.RequestIDHeader or HTTPParams.RequestID, or an
+// empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID returns the request with its ID, if any, in its context.
+func (hp *HTTPParams) withRequestID(r *http.Request) *http.Request {
+	var id string
+	if hp.RequestID != nil {
+		id = hp.RequestID(r)
+	} else if hp.RequestIDHeader != "" {
+		id = r.Header.Get(hp.RequestIDHeader)
+	}
+
+	if id == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
@@ -0,0 +1,65 @@
+package charlie
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHTTPRequestID(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	var seen string
+	v := HTTPParams{
+		Key:             []byte(testKey),
+		CSRFHeader:      testCSRFHeader,
+		SessionHeader:   testSessionHeader,
+		RequestIDHeader: "X-Request-ID",
+	}
+	handler := v.Wrap(noContentHandler)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("Expected to receive a 403, got %d", res.Code)
+	}
+
+	if !strings.Contains(buf.String(), `(event=csrf_invalid request_id="abc123")`) {
+		t.Errorf("Expected the log to include the request ID, but got %q", buf.String())
+	}
+
+	// Handlers can find the request ID in the context
+	v.RequestID = func(r *http.Request) string {
+		return "from-func"
+	}
+	v.InvalidHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen != "from-func" {
+		t.Errorf("Request ID was %q, but expected %q", seen, "from-func")
+	}
+}
+
+func TestHTTPNoRequestID(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	v := HTTPParams{Key: []byte(testKey), RequestIDHeader: "X-Request-ID"}
+	v.Wrap(noContentHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+	if !strings.HasSuffix(buf.String(), "(event=csrf_invalid)\n") {
+		t.Errorf("Expected the log to omit the request ID, but got %q", buf.String())
+	}
+}
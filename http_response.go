@@ -0,0 +1,118 @@
+package charlie
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// responseWriter wraps a handler's http.ResponseWriter to finalize its headers
+// just before they're written. It forwards http.Flusher, http.Hijacker,
+// http.Pusher, and io.ReaderFrom to the underlying writer, so that streamed
+// responses, WebSocket upgrades, and sendfile keep working.
+type responseWriter struct {
+	http.ResponseWriter
+	hp          *HTTPParams
+	wroteHeader bool
+	issued      bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.finish()
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack hijacks the underlying connection. The response's headers are never
+// written, so they aren't finalized.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.wroteHeader = true
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return readFrom(rw.ResponseWriter, src)
+}
+
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	return push(rw.ResponseWriter, target, opts)
+}
+
+// finish finalizes the headers if the handler returned without writing them.
+func (rw *responseWriter) finish() {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		rw.hp.secureCaching(rw.Header(), rw.issued)
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use by
+// http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// readFrom copies src to w, using w's io.ReaderFrom if it has one (e.g. to use
+// sendfile).
+func readFrom(w http.ResponseWriter, src io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+// push pushes the given target with w, if it's an http.Pusher.
+func push(w http.ResponseWriter, target string, opts *http.PushOptions) error {
+	if p, ok := w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// secureCaching prevents shared caches from storing responses which carry a
+// token, lest they serve one user's token to another.
+func (hp *HTTPParams) secureCaching(h http.Header, issued bool) {
+	if !issued && !hp.carriesToken(h) {
+		return
+	}
+
+	cc := hp.CacheControl
+	if cc == "" {
+		cc = "no-store"
+	}
+	h.Set("Cache-Control", cc)
+	h.Add("Vary", "Cookie")
+}
+
+func (hp *HTTPParams) carriesToken(h http.Header) bool {
+	if hp.CSRFHeader != "" && h.Get(hp.CSRFHeader) != "" {
+		return true
+	}
+
+	if hp.CSRFCookie != "" {
+		for _, c := range h.Values("Set-Cookie") {
+			if strings.HasPrefix(c, hp.CSRFCookie+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
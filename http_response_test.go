@@ -0,0 +1,120 @@
+package charlie
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPCacheHeaders(t *testing.T) {
+	v := HTTPParams{
+		Key:        []byte(testKey),
+		CSRFHeader: testCSRFHeader,
+		CSRFCookie: testCSRFCookie,
+		EnforceIf: func(r *http.Request) bool {
+			return false
+		},
+	}
+
+	for _, h := range []http.HandlerFunc{
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(testCSRFHeader, "token")
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+			_, _ = w.Write([]byte("ok"))
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: testCSRFCookie, Value: "token"})
+			w.WriteHeader(204)
+		},
+	} {
+		res := httptest.NewRecorder()
+		v.Wrap(h).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+		if v, want := res.Header().Get("Cache-Control"), "no-store"; v != want {
+			t.Errorf("Cache-Control was %q, but expected %q", v, want)
+		}
+
+		if v, want := res.Header().Get("Vary"), "Cookie"; v != want {
+			t.Errorf("Vary was %q, but expected %q", v, want)
+		}
+	}
+
+	// Responses without tokens are left alone
+	res := httptest.NewRecorder()
+	v.Wrap(noContentHandler).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+	if v := res.Header().Get("Cache-Control"); v != "" {
+		t.Errorf("Cache-Control was %q, but expected none", v)
+	}
+
+	// The header is configurable
+	v.CacheControl = "private, no-cache"
+	res = httptest.NewRecorder()
+	v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(testCSRFHeader, "token")
+	})).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+	if v, want := res.Header().Get("Cache-Control"), "private, no-cache"; v != want {
+		t.Errorf("Cache-Control was %q, but expected %q", v, want)
+	}
+}
+
+// fullWriter is an http.ResponseWriter which records which of the optional
+// interfaces are used.
+type fullWriter struct {
+	*httptest.ResponseRecorder
+	used []string
+}
+
+func (w *fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.used = append(w.used, "hijack")
+	return nil, nil, nil
+}
+
+func (w *fullWriter) Push(target string, opts *http.PushOptions) error {
+	w.used = append(w.used, "push")
+	return nil
+}
+
+func (w *fullWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.used = append(w.used, "readfrom")
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func (w *fullWriter) Flush() {
+	w.used = append(w.used, "flush")
+}
+
+func TestHTTPResponseWriterInterfaces(t *testing.T) {
+	for _, inject := range []bool{false, true} {
+		v := HTTPParams{Key: []byte(testKey), SessionHeader: testSessionHeader}
+		if inject {
+			v.InjectMeta = "csrf-token"
+		}
+
+		handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			_ = w.(http.Pusher).Push("/app.js", nil)
+			_, _ = w.(io.ReaderFrom).ReadFrom(strings.NewReader("woo"))
+			w.(http.Flusher).Flush()
+			_, _, _ = w.(http.Hijacker).Hijack()
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+		w := &fullWriter{ResponseRecorder: httptest.NewRecorder()}
+		handler.ServeHTTP(w, req)
+
+		if got, want := strings.Join(w.used, ","), "push,readfrom,flush,hijack"; got != want {
+			t.Errorf("inject=%v: used %s, but expected %s", inject, got, want)
+		}
+
+		if w.Body.String() != "woo" {
+			t.Errorf("inject=%v: body was %q", inject, w.Body.String())
+		}
+	}
+}
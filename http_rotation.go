@@ -0,0 +1,38 @@
+package charlie
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultRotationGrace is the default value of HTTPParams.RotationGrace.
+const defaultRotationGrace = 30 * time.Second
+
+// validatePrevious returns the first candidate which is valid for the request's
+// previous session, if it was rotated within the grace period. It returns an
+// error only if validation fails unexpectedly.
+func (hp *HTTPParams) validatePrevious(r *http.Request, csrf *Params, cs []candidate) (candidate, bool, error) {
+	if hp.PreviousSession == nil {
+		return candidate{}, false, nil
+	}
+
+	id, rotatedAt := hp.PreviousSession(r)
+	if id == "" {
+		return candidate{}, false, nil
+	}
+
+	grace := hp.RotationGrace
+	if grace == 0 {
+		grace = defaultRotationGrace
+	}
+
+	if csrf.timer().Sub(rotatedAt) > grace {
+		return candidate{}, false, nil
+	}
+
+	c, ok, err := hp.validateAny(r, csrf, id, cs)
+	if ok {
+		hp.logf(r, "csrf_previous_session", logFields{session: id, source: c.source}, "Accepted a CSRF token for the previous session=%q.", id)
+	}
+	return c, ok, err
+}
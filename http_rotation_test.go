@@ -0,0 +1,50 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPSessionRotation(t *testing.T) {
+	rotatedAt := time.Now()
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		PreviousSession: func(r *http.Request) (string, time.Time) {
+			return "old-session", rotatedAt
+		},
+		RotationGrace: time.Minute,
+	}
+	handler := v.Wrap(noContentHandler)
+
+	send := func(token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		req.Header.Set(testCSRFHeader, token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	csrf := v.params()
+	if code := send(csrf.Generate(testSessionID)); code != 204 {
+		t.Errorf("Expected a token for the current session to be accepted, got %d", code)
+	}
+
+	if code := send(csrf.Generate("old-session")); code != 204 {
+		t.Errorf("Expected a token for the previous session to be accepted, got %d", code)
+	}
+
+	if code := send(csrf.Generate("older-session")); code != 403 {
+		t.Errorf("Expected a token for another session to be rejected, got %d", code)
+	}
+
+	rotatedAt = rotatedAt.Add(-2 * time.Minute)
+	if code := send(csrf.Generate("old-session")); code != 403 {
+		t.Errorf("Expected a token for the previous session to be rejected after the grace period, got %d", code)
+	}
+}
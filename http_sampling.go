@@ -0,0 +1,77 @@
+package charlie
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSampledSessions bounds the number of sessions LogSampling tracks.
+	// Once reached, rejections for other sessions are sampled by reason
+	// alone until the counts are next reset.
+	maxSampledSessions = 10000
+
+	// sampledSessionWindow is how often LogSampling resets its per-session
+	// counts, so that each session's first rejections are logged again.
+	sampledSessionWindow = time.Hour
+)
+
+// LogSampling samples the middleware's rejection logs, which are otherwise
+// written for every rejected request. A rejection is logged if it's one of the
+// first First rejections for its session in the past hour, or one of every
+// Every rejections for its reason (e.g. an expired token or a cross-origin
+// request). Only the first 10000 sessions rejected in an hour are counted, so
+// that clients can't flood the logs by rotating session IDs. Only logs are
+// sampled; hooks are still called for every request.
+//
+// A LogSampling must not be copied after first use.
+type LogSampling struct {
+	Every int // Every is the sampling rate per reason, e.g. 100 for 1 in 100.
+	First int // First is the number of rejections always logged per session.
+
+	mu       sync.Mutex
+	reasons  map[string]int
+	sessions map[string]int
+	reset    time.Time
+}
+
+// sample returns true if a rejection with the given reason and session should
+// be logged.
+func (s *LogSampling) sample(reason, id string, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reasons == nil {
+		s.reasons = make(map[string]int)
+	}
+	s.reasons[reason]++
+
+	if s.First > 0 && id != "" {
+		if s.sessions == nil || !now.Before(s.reset) {
+			s.sessions, s.reset = make(map[string]int), now.Add(sampledSessionWindow)
+		}
+
+		if n, ok := s.sessions[id]; ok || len(s.sessions) < maxSampledSessions {
+			s.sessions[id] = n + 1
+			if n < s.First {
+				return true
+			}
+		}
+	}
+
+	return s.Every <= 1 || (s.reasons[reason]-1)%s.Every == 0
+}
+
+// logRejection logs a rejection of a request for the given session, which
+// presented the given token, because of the given error, subject to
+// LogSampling.
+func (hp *HTTPParams) logRejection(r *http.Request, event, id, token string, err error, format string, args ...interface{}) {
+	if hp.LogSampling.sample(event+" "+rejectionReason(err), id, time.Now()) {
+		hp.logf(r, event, logFields{session: id, token: hp.redact(token), reason: err}, format, args...)
+	}
+}
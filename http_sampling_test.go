@@ -0,0 +1,118 @@
+package charlie
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogSampling(t *testing.T) {
+	s := &LogSampling{Every: 10, First: 2}
+	now := time.Now()
+
+	var logged int
+	for i := 0; i < 100; i++ {
+		if s.sample("csrf_invalid bad_mac", "a", now) {
+			logged++
+		}
+	}
+
+	// The first two for the session, plus 1 in 10 of the rest (the 11th, 21st,
+	// etc.), which includes none of the first two.
+	if logged != 11 {
+		t.Errorf("Logged %d rejections, but expected 11", logged)
+	}
+
+	if !s.sample("csrf_invalid bad_mac", "b", now) || !s.sample("csrf_invalid bad_mac", "b", now) {
+		t.Error("Expected the first rejections of a new session to be logged")
+	}
+
+	if !s.sample("csrf_invalid expired", "a", now) {
+		t.Error("Expected the first rejection for a new reason to be logged")
+	}
+
+	if !s.sample("csrf_invalid bad_mac", "a", now.Add(time.Hour)) {
+		t.Error("Expected the first rejection of a session to be logged again after an hour")
+	}
+}
+
+func TestLogSamplingSessionFlood(t *testing.T) {
+	s := &LogSampling{Every: 100, First: 1}
+	now := time.Now()
+
+	var logged int
+	for i := 0; i < 2*maxSampledSessions; i++ {
+		if s.sample("csrf_invalid bad_mac", strconv.Itoa(i), now) {
+			logged++
+		}
+	}
+
+	// The first rejection of each of the counted sessions, plus 1 in 100 of
+	// the rest.
+	if want := maxSampledSessions + maxSampledSessions/100; logged != want {
+		t.Errorf("Logged %d rejections, but expected %d", logged, want)
+	}
+
+	// The flood didn't reset the counts of sessions already seen. (The first
+	// rejection after it is 1 in 100, so is logged regardless.)
+	s.sample("csrf_invalid bad_mac", "0", now)
+	if s.sample("csrf_invalid bad_mac", "0", now) {
+		t.Error("Expected a session's counts to survive a flood of others")
+	}
+}
+
+func TestNilLogSampling(t *testing.T) {
+	var s *LogSampling
+	if !s.sample("csrf_invalid bad_mac", "a", time.Now()) {
+		t.Error("Expected a nil LogSampling to log everything")
+	}
+}
+
+func TestHTTPLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	var rejected int
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionCookie: testSessionCookie,
+		LogSampling:   &LogSampling{Every: 5},
+		InvalidHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rejected++
+			w.WriteHeader(403)
+		}),
+	}
+	handler := v.Wrap(noContentHandler)
+
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		req.Header.Set(testCSRFHeader, "bad")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if rejected != 10 {
+		t.Errorf("InvalidHandler was called %d times, but expected 10", rejected)
+	}
+
+	v.InvalidHandler = nil
+	handler = v.Wrap(noContentHandler)
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		req.Header.Set(testCSRFHeader, "bad")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if n := strings.Count(buf.String(), "event=csrf_invalid"); n != 2 {
+		t.Errorf("Logged %d rejections, but expected 2", n)
+	}
+}
@@ -0,0 +1,55 @@
+package charlie
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// TokenHandler returns a handler which responds to GET requests with a fresh
+// token for the request's session, as {"token":"...","expires_at":"..."}, so
+// that single-page apps can fetch a token after loading rather than having it
+// rendered into the page. If the middleware issues tokens (e.g. in an
+// IssueCookie), the token is also issued as usual. With DoubleSubmit, clients
+// without an ID are given one; otherwise, requests without a session are
+// rejected.
+func (hp *HTTPParams) TokenHandler() http.Handler {
+	base := hp.params()
+	mux := hp.patternMux()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csrf := hp.route(r, base, mux).csrf
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := hp.sessionID(r)
+		if err != nil {
+			hp.logf(r, "csrf_session_error", logFields{reason: err}, "Unable to extract the session: %v", err)
+			id = ""
+		}
+
+		if hp.DoubleSubmit && id == "" {
+			id = hp.newDoubleSubmitID(w, r, csrf)
+		} else if id == "" {
+			hp.writeRejection(w, r, 0, rejectionReason(ErrMissingSession))
+			return
+		}
+
+		t, _, err := freshToken(r.Context(), csrf, id)
+		if err != nil {
+			hp.handleError(w, r, err)
+			return
+		}
+
+		for _, tw := range hp.tokenWriters() {
+			tw.WriteToken(w, r, t.Token)
+		}
+
+		body, _ := json.Marshal(t)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+}
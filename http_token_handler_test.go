@@ -0,0 +1,80 @@
+package charlie
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenHandler(t *testing.T) {
+	hp := &HTTPParams{
+		Key:           []byte(testKey),
+		SessionHeader: testSessionHeader,
+		IssueCookie:   testCSRFCookie,
+	}
+	handler := hp.TokenHandler()
+
+	req := httptest.NewRequest("GET", "/csrf/token", nil)
+	req.Header.Set(testSessionHeader, testSessionID)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	var body issuedTokenJSON
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := New(hp.Key).Validate(testSessionID, body.Token); err != nil {
+		t.Errorf("Token was invalid: %v", err)
+	}
+
+	if d := time.Until(body.ExpiresAt); d < 2*time.Hour || d > 3*time.Hour {
+		t.Errorf("Token expires at %v", body.ExpiresAt)
+	}
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != testCSRFCookie || cookies[0].Value != body.Token {
+		t.Errorf("Unexpected cookies: %v", cookies)
+	}
+
+	if cc := res.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control was %q", cc)
+	}
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/csrf/token", nil))
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected a 403 without a session, got %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/csrf/token", nil))
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected a 405 for a POST, got %d", res.Code)
+	}
+}
+
+func TestTokenHandlerDoubleSubmit(t *testing.T) {
+	hp := &HTTPParams{Key: []byte(testKey), DoubleSubmit: true}
+
+	res := httptest.NewRecorder()
+	hp.TokenHandler().ServeHTTP(res, httptest.NewRequest("GET", "/csrf/token", nil))
+
+	var body issuedTokenJSON
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+	for _, c := range res.Result().Cookies() {
+		if c.Name == "charlie_id" {
+			id = c.Value
+		}
+	}
+
+	if err := New(hp.Key).Validate(id, body.Token); id == "" || err != nil {
+		t.Errorf("Expected a token for the new ID %q, got %v", id, err)
+	}
+}
@@ -0,0 +1,97 @@
+package charlie
+
+import (
+	"errors"
+	"net/http"
+)
+
+// maxCandidates limits the number of tokens validated per request.
+const maxCandidates = 8
+
+// A candidate is a token presented with a request, along with its source.
+type candidate struct {
+	source, token string
+	stale         bool
+	err           error // err is why the request's tokens were invalid.
+}
+
+// candidates returns the distinct tokens presented in the given header and
+// cookie, in that order. During a rotation, a client may present both a fresh
+// token and a stale one.
+func candidates(r *http.Request, header, cookie string) []candidate {
+	var cs []candidate
+	if header != "" {
+		for _, v := range r.Header.Values(header) {
+			cs = addCandidate(cs, "header", v)
+		}
+	}
+
+	if cookie != "" {
+		for _, c := range r.Cookies() {
+			if c.Name == cookie {
+				cs = addCandidate(cs, "cookie", c.Value)
+			}
+		}
+	}
+	return cs
+}
+
+// extractCandidates returns the distinct tokens extracted by the given
+// Extractors, in order.
+func extractCandidates(r *http.Request, extractors []Extractor) []candidate {
+	var cs []candidate
+	for _, e := range extractors {
+		tokens, _ := e.Extract(r)
+		for _, token := range tokens {
+			cs = addCandidate(cs, e.Source, token)
+		}
+	}
+	return cs
+}
+
+// addCandidate adds the given token to the candidates, unless it's empty, a
+// duplicate, or there are already maxCandidates.
+func addCandidate(cs []candidate, source, token string) []candidate {
+	if token == "" || len(cs) == maxCandidates {
+		return cs
+	}
+
+	for _, c := range cs {
+		if c.token == token {
+			return cs
+		}
+	}
+	return append(cs, candidate{source: source, token: token})
+}
+
+// validateAny returns the first candidate which is valid for the given session.
+// If none are, the returned candidate's err is the reason. It returns an error
+// only if validation fails unexpectedly.
+func (hp *HTTPParams) validateAny(r *http.Request, csrf *Params, id string, cs []candidate) (candidate, bool, error) {
+	if id == "" {
+		return candidate{err: ErrMissingSession}, false, nil
+	} else if len(cs) == 0 {
+		return candidate{err: ErrMissingToken}, false, nil
+	}
+
+	var reason error
+	for _, c := range cs {
+		stale, err := csrf.ValidateStale(r.Context(), id, c.token)
+		switch {
+		case err == nil:
+			c.stale = stale
+			return c, true, nil
+		case err == r.Context().Err(), errors.Is(err, ErrBackendUnavailable):
+			return candidate{err: err}, false, nil
+		case errors.Is(err, ErrUnknownKey):
+			hp.logf(r, "csrf_unknown_key", logFields{session: id, token: hp.redact(c.token), source: c.source, reason: err}, "Received a CSRF token=%q generated with an unknown key.", hp.redact(c.token))
+		case !errors.Is(err, ErrInvalidToken):
+			return candidate{}, false, err
+		}
+
+		if reason == nil {
+			reason = err
+		}
+	}
+	return candidate{err: reason}, false, nil
+}
@@ -0,0 +1,104 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPMultipleTokens(t *testing.T) {
+	var sources []string
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		CSRFCookie:    testCSRFCookie,
+		SessionCookie: testSessionCookie,
+		OnTokenSource: func(r *http.Request, source string) {
+			sources = append(sources, source)
+		},
+	}
+	handler := v.Wrap(noContentHandler)
+	token := v.params().Generate(testSessionID)
+
+	for _, test := range []struct {
+		header, cookie []string
+		code           int
+		source         string
+	}{
+		{header: []string{token}, code: 204, source: "header"},
+		{cookie: []string{"stale", token}, code: 204, source: "cookie"},
+		{header: []string{"stale"}, cookie: []string{token}, code: 204, source: "cookie"},
+		{header: []string{"stale", token}, code: 204, source: "header"},
+		{header: []string{"stale"}, cookie: []string{"stale"}, code: 403},
+	} {
+		sources = nil
+
+		req := httptest.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+		for _, v := range test.header {
+			req.Header.Add(testCSRFHeader, v)
+		}
+		for _, v := range test.cookie {
+			req.AddCookie(&http.Cookie{Name: testCSRFCookie, Value: v})
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if res.Code != test.code {
+			t.Errorf("%+v: expected %d, got %d", test, test.code, res.Code)
+		}
+
+		if test.source != "" && (len(sources) != 1 || sources[0] != test.source) {
+			t.Errorf("%+v: expected source %q, got %v", test, test.source, sources)
+		}
+	}
+}
+
+func TestCandidatesAreLimited(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	for i := 0; i < maxCandidates*2; i++ {
+		req.Header.Add("X-Token", string(rune('a'+i)))
+		req.Header.Add("X-Token", "a")
+	}
+
+	cs := candidates(req, "X-Token", "")
+	if len(cs) != maxCandidates {
+		t.Errorf("Expected %d candidates, got %d", maxCandidates, len(cs))
+	}
+}
+
+func TestHTTPMissingStatusCode(t *testing.T) {
+	v := HTTPParams{
+		Key:               []byte(testKey),
+		CSRFHeader:        testCSRFHeader,
+		SessionCookie:     testSessionCookie,
+		MissingStatusCode: http.StatusUnauthorized,
+	}
+	handler := v.Wrap(noContentHandler)
+
+	for _, test := range []struct {
+		session, token string
+		code           int
+	}{
+		{session: testSessionID, token: "", code: 401},
+		{session: "", token: "token", code: 401},
+		{session: testSessionID, token: "token", code: 403},
+		{session: testSessionID, token: v.params().Generate(testSessionID), code: 204},
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		if test.session != "" {
+			req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: test.session})
+		}
+		if test.token != "" {
+			req.Header.Set(testCSRFHeader, test.token)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if res.Code != test.code {
+			t.Errorf("%+v: expected %d, got %d", test, test.code, res.Code)
+		}
+	}
+}
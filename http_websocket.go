@@ -0,0 +1,99 @@
+package charlie
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WebSocketProtocolPrefix prefixes the Sec-WebSocket-Protocol value in which
+// browsers may present tokens with WebSocket handshakes, e.g.
+// new WebSocket(url, ["csrf." + token, "chat"]). Since "=" isn't allowed in
+// protocols, padding may be stripped from tokens; it's restored.
+const WebSocketProtocolPrefix = "csrf."
+
+// ValidateWebSocket validates a WebSocket handshake, which browsers send with
+// the user's cookies regardless of the page which opened it, so that
+// handlers which upgrade connections outside of the middleware aren't open to
+// cross-site WebSocket hijacking. The handshake's Origin, if any, must be the
+// request's own origin or one of the TrustedOrigins, and it must present a
+// valid token for the request's session in the CSRFHeader (for non-browser
+// clients), the WebSocketQuery parameter, or a Sec-WebSocket-Protocol value
+// prefixed with WebSocketProtocolPrefix. Tokens in cookies aren't accepted.
+//
+// If the client offered protocols, the one the server must select in its
+// response is returned: the first which doesn't hold a token, or else the
+// one which does. Errors are as given to OnInvalid, which is called along
+// with OnValid.
+func (hp *HTTPParams) ValidateWebSocket(r *http.Request) (protocol string, err error) {
+	protocol, err = hp.validateWebSocket(r)
+	if err == nil && hp.OnValid != nil {
+		hp.OnValid(r)
+	} else if err != nil && hp.OnInvalid != nil {
+		hp.OnInvalid(r, err)
+	}
+	return protocol, err
+}
+
+func (hp *HTTPParams) validateWebSocket(r *http.Request) (string, error) {
+	if err := hp.checkWebSocketOrigin(r); err != nil {
+		return "", err
+	}
+
+	id, err := hp.sessionID(r)
+	if err != nil {
+		return "", err
+	}
+
+	cs := candidates(r, hp.CSRFHeader, "")
+	query := hp.WebSocketQuery
+	if query == "" {
+		query = "csrf"
+	}
+	if r.URL != nil {
+		cs = addCandidate(cs, "query", r.URL.Query().Get(query))
+	}
+
+	var protocol, tokenProtocol string
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			if token, ok := strings.CutPrefix(p, WebSocketProtocolPrefix); ok {
+				if tokenProtocol == "" {
+					tokenProtocol = p
+				}
+				cs = addCandidate(cs, "protocol", token)
+				if n := len(token) % 4; n != 0 && !strings.Contains(token, ".") {
+					cs = addCandidate(cs, "protocol", token+strings.Repeat("=", 4-n))
+				}
+			} else if protocol == "" && p != "" {
+				protocol = p
+			}
+		}
+	}
+	if protocol == "" {
+		protocol = tokenProtocol
+	}
+
+	c, ok, err := hp.validateAny(r, hp.bindRequest(r, hp.params()), id, cs)
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", c.err
+	}
+
+	if hp.OnTokenSource != nil {
+		hp.OnTokenSource(r, c.source)
+	}
+	return protocol, nil
+}
+
+// checkWebSocketOrigin returns ErrUntrustedOrigin if the handshake's Origin is
+// neither the request's own origin nor one of the TrustedOrigins. Handshakes
+// without one aren't from browsers.
+func (hp *HTTPParams) checkWebSocketOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	return hp.trustOrigin(r, origin)
+}
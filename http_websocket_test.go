@@ -0,0 +1,53 @@
+package charlie
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateWebSocket(t *testing.T) {
+	hp := &HTTPParams{
+		Key:            []byte(testKey),
+		CSRFHeader:     testCSRFHeader,
+		CSRFCookie:     testCSRFCookie,
+		SessionHeader:  testSessionHeader,
+		TrustedOrigins: []string{"https://*.example.com"},
+	}
+	token := New(hp.Key).Generate(testSessionID)
+	unpadded := strings.TrimRight(token, "=")
+
+	for _, tc := range []struct {
+		name, origin, query, protocols, protocol string
+		err                                      error
+	}{
+		{name: "query", query: "csrf=" + token},
+		{name: "protocol", protocols: "csrf." + unpadded + ", chat", protocol: "chat"},
+		{name: "protocol only", protocols: "csrf." + token, protocol: "csrf." + token},
+		{name: "same origin", origin: "http://example.com", query: "csrf=" + token},
+		{name: "trusted origin", origin: "https://app.example.com", query: "csrf=" + token},
+		{name: "untrusted origin", origin: "https://evil.com", query: "csrf=" + token, err: ErrUntrustedOrigin},
+		{name: "no token", protocols: "chat", err: ErrMissingToken},
+		{name: "invalid token", query: "csrf=" + token[1:], err: ErrInvalidToken},
+	} {
+		req := httptest.NewRequest("GET", "/ws?"+tc.query, nil)
+		req.Header.Set(testSessionHeader, testSessionID)
+		req.Header.Set("Cookie", testCSRFCookie+"="+token)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.protocols != "" {
+			req.Header.Set("Sec-WebSocket-Protocol", tc.protocols)
+		}
+
+		protocol, err := hp.ValidateWebSocket(req)
+		if tc.err == nil && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("%s: error was %v, but expected %v", tc.name, err, tc.err)
+		} else if protocol != tc.protocol {
+			t.Errorf("%s: protocol was %q, but expected %q", tc.name, protocol, tc.protocol)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package charlie
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// errUndecodable is returned by Decode for FormatPASETOLocal and FormatBranca
+// tokens, whose claims are encrypted.
+var errUndecodable = errors.New("format can't be decoded")
+
+// TokenInfo is a diagnosis of a token, for debugging.
+type TokenInfo struct {
+	Format    Format        // Format is the format the token was parsed as.
+	KeyID     string        // KeyID is the ID of the key which authenticated it.
+	Authentic bool          // Authentic is true if the token's MAC verified.
+	Valid     bool          // Valid is true if the token would be accepted.
+	Stale     bool          // Stale is true if the token is valid but stale.
+	IssuedAt  time.Time     // IssuedAt is when the token was issued.
+	Expires   time.Time     // Expires is when the token expires.
+	Age       time.Duration // Age is how long ago the token was issued.
+	Remaining time.Duration // Remaining is how long the token remains valid.
+	Err       error         // Err is the error Validate would return, if any.
+}
+
+// Inspect returns a diagnosis of the given token for the given user, for use in
+// debugging. Its timestamps are only meaningful if the token is authentic.
+func (p *Params) Inspect(id, token string) TokenInfo {
+	now := p.timer()
+	info := TokenInfo{Format: p.Format}
+
+	c, sk, err := p.open(id, token)
+	if err != nil {
+		info.Err = err
+		return info
+	}
+
+	info.KeyID, info.Authentic = sk.kid, true
+	p.setTimes(&info, c, now)
+
+	info.Err = p.checkExpiry(c, now)
+	info.Valid = info.Err == nil
+	info.Stale = info.Valid && p.stale(c, now)
+	return info
+}
+
+// Decode returns a diagnosis of the given token for the given user, like
+// Inspect, but with its timestamps even if it isn't authentic, e.g. to tell
+// whether a token rejected for another user had expired. Those of inauthentic
+// tokens are only as trustworthy as the token, which Authentic reports.
+// Inauthentic FormatPASETOLocal and FormatBranca tokens, whose claims are
+// encrypted, can't be decoded; those of every other format can.
+func (p *Params) Decode(id, token string) (TokenInfo, error) {
+	info := p.Inspect(id, token)
+	if info.Authentic {
+		return info, nil
+	}
+
+	c, err := p.decode(token)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	p.setTimes(&info, c, p.timer())
+	return info, nil
+}
+
+// setTimes sets the timestamps of the given TokenInfo from the given claims.
+func (p *Params) setTimes(info *TokenInfo, c Claims, now time.Time) {
+	info.IssuedAt = c.IssuedAt
+	info.Expires = c.IssuedAt.Add(p.MaxAge)
+	if !c.Expires.IsZero() && c.Expires.Before(info.Expires) {
+		info.Expires = c.Expires
+	}
+	info.Age = now.Sub(c.IssuedAt)
+	info.Remaining = info.Expires.Sub(now)
+}
+
+// decode returns the claims of the given token without authenticating it.
+func (p *Params) decode(token string) (Claims, error) {
+	if err := p.check(); err != nil {
+		return Claims{}, err
+	}
+
+	switch p.Format {
+	case FormatJWT:
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return Claims{}, ErrBadEncoding
+		}
+
+		var claims jwtClaims
+		b, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil || json.Unmarshal(b, &claims) != nil {
+			return Claims{}, ErrBadEncoding
+		}
+
+		return Claims{
+			IssuedAt: time.Unix(claims.IssuedAt, 0),
+			Expires:  time.Unix(claims.Expires, 0),
+			Subject:  claims.Subject,
+		}, nil
+	case FormatCharlie, FormatCharlieV2, FormatCharlieV3:
+		if p.Codec != nil && p.Format == FormatCharlie {
+			data, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil || len(data) < p.macSize() {
+				return Claims{}, ErrBadEncoding
+			}
+
+			c, err := p.Codec.UnmarshalClaims(data[:len(data)-p.macSize()])
+			if err != nil {
+				return Claims{}, ErrBadEncoding
+			}
+			return c, nil
+		}
+
+		data, err := base64.URLEncoding.DecodeString(token)
+		if err == nil && p.isCharlieV3(data) {
+			return Claims{IssuedAt: charlieV3Time(data)}, nil
+		} else if err == nil && p.isCharlieV2(data) {
+			data = data[charlieV2HeaderSize:]
+		} else if err != nil || len(data) != dataSize+p.macSize() {
+			return Claims{}, ErrBadEncoding
+		}
+		return Claims{IssuedAt: time.Unix(int64(binary.BigEndian.Uint32(data)), 0)}, nil
+	case FormatCOSE:
+		_, claims, _, err := splitCOSE(token)
+		if err != nil {
+			return Claims{}, err
+		}
+		return parseCWT(claims)
+	case FormatPASETOPublic:
+		data, _, err := splitPASETO(pasetoPublic, token)
+		if err != nil {
+			return Claims{}, err
+		} else if len(data) < ed25519.SignatureSize {
+			return Claims{}, ErrBadEncoding
+		}
+		return parsePASETOClaims("", data[:len(data)-ed25519.SignatureSize], nil)
+	}
+	return Claims{}, errUndecodable
+}
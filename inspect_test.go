@@ -0,0 +1,111 @@
+package charlie
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInspectValid(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	issued := time.Unix(1400000000, 0)
+	p.timer = func() time.Time {
+		return issued
+	}
+	token := p.Generate("woo")
+
+	p.timer = func() time.Time {
+		return issued.Add(time.Minute)
+	}
+
+	info := p.Inspect("woo", token)
+	if !info.Authentic || !info.Valid || info.Err != nil {
+		t.Fatalf("Info was %+v, but expected a valid token", info)
+	}
+
+	if !info.IssuedAt.Equal(issued) {
+		t.Errorf("IssuedAt was %v, but expected %v", info.IssuedAt, issued)
+	}
+
+	if v, want := info.Age, time.Minute; v != want {
+		t.Errorf("Age was %v, but expected %v", v, want)
+	}
+
+	if v, want := info.Remaining, 9*time.Minute; v != want {
+		t.Errorf("Remaining was %v, but expected %v", v, want)
+	}
+}
+
+func TestInspectExpired(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	token := p.Generate("woo")
+
+	p.timer = func() time.Time {
+		return time.Now().Add(20 * time.Minute)
+	}
+
+	info := p.Inspect("woo", token)
+	if !info.Authentic || info.Valid || !errors.Is(info.Err, ErrInvalidToken) {
+		t.Fatalf("Info was %+v, but expected an authentic but expired token", info)
+	}
+
+	if info.Remaining >= 0 {
+		t.Errorf("Remaining was %v, but expected a negative duration", info.Remaining)
+	}
+}
+
+func TestInspectForged(t *testing.T) {
+	p := New([]byte("ayellowsubmarine"))
+	token := p.Generate("woo")
+
+	info := p.Inspect("yay", token)
+	if info.Authentic || info.Valid || !errors.Is(info.Err, ErrInvalidToken) {
+		t.Fatalf("Info was %+v, but expected an inauthentic token", info)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	issued := time.Unix(1400000000, 0)
+	for _, f := range []Format{FormatCharlie, FormatCharlieV2, FormatJWT, FormatCOSE, FormatPASETOPublic} {
+		p := New([]byte("ayellowsubmarine"))
+		p.Format = f
+		p.timer = func() time.Time { return issued }
+		token := p.Generate("woo")
+
+		p.timer = func() time.Time { return issued.Add(time.Hour) }
+		info, err := p.Decode("yay", token)
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+
+		if !info.IssuedAt.Equal(issued) || info.Age != time.Hour || info.Remaining != -50*time.Minute {
+			t.Errorf("%s: unexpected info: %+v", f, info)
+		}
+
+		if info.Authentic || info.Valid || !errors.Is(info.Err, ErrBadMAC) {
+			t.Errorf("%s: token for another user was reported as authentic: %+v", f, info)
+		}
+
+		info, err = p.Decode("woo", token)
+		if err != nil || !info.Authentic || info.Valid || !errors.Is(info.Err, ErrTokenExpired) ||
+			!info.IssuedAt.Equal(issued) {
+			t.Errorf("%s: expected an authentic, expired token, but got %+v (%v)", f, info, err)
+		}
+
+		if _, err := p.Decode("woo", "%%%"); !errors.Is(err, ErrBadEncoding) {
+			t.Errorf("%s: error was %v, but expected ErrBadEncoding", f, err)
+		}
+	}
+
+	p := New([]byte("ayellowsubmarine"))
+	p.Format = FormatBranca
+	token := p.Generate("woo")
+	if _, err := p.Decode("yay", token); err == nil {
+		t.Error("Expected an inauthentic Branca token not to be decodable")
+	}
+
+	if info, err := p.Decode("woo", token); err != nil || !info.Authentic {
+		t.Errorf("Expected an authentic Branca token to be decodable, but got %+v (%v)", info, err)
+	}
+}
@@ -0,0 +1,87 @@
+package charlie
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type jwtClaims struct {
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+	Subject  string `json:"sub"`
+}
+
+func (p *Params) generateJWT(sk *signingKey, id string, now time.Time) string {
+	claims, _ := json.Marshal(jwtClaims{
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(p.MaxAge).Unix(),
+		Subject:  id,
+	})
+
+	header, _ := json.Marshal(jwtHeader{Alg: "HS256", Kid: sk.kid, Typ: "JWT"})
+
+	token := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	return token + "." + base64.RawURLEncoding.EncodeToString(jwtSign(p.keyFor(sk, id), token))
+}
+
+func (p *Params) openJWT(sk *signingKey, id, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrBadEncoding
+	}
+
+	// Only ever accept HS256, whatever else the header claims.
+	var header jwtHeader
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(b, &header) != nil {
+		return Claims{}, ErrBadEncoding
+	} else if header.Alg != "HS256" {
+		return Claims{}, ErrBadMAC
+	}
+
+	if header.Kid != "" && header.Kid != sk.kid {
+		return Claims{}, ErrUnknownKey
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrBadEncoding
+	} else if !hmac.Equal(jwtSign(p.keyFor(sk, id), parts[0]+"."+parts[1]), sig) {
+		return Claims{}, ErrBadMAC
+	}
+
+	var claims jwtClaims
+	b, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(b, &claims) != nil {
+		return Claims{}, ErrBadEncoding
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Subject), []byte(id)) != 1 {
+		return Claims{}, ErrBadMAC
+	}
+
+	return Claims{
+		IssuedAt: time.Unix(claims.IssuedAt, 0),
+		Expires:  time.Unix(claims.Expires, 0),
+		Subject:  claims.Subject,
+		tag:      string(sig),
+	}, nil
+}
+
+func jwtSign(key []byte, signingInput string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(signingInput))
+	return h.Sum(nil)
+}
@@ -0,0 +1,105 @@
+package charlie
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWTRoundTrip(t *testing.T) {
+	p := formatParams(FormatJWT)
+	token := p.Generate("woo")
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTClaims(t *testing.T) {
+	p := formatParams(FormatJWT)
+	p.timer = func() time.Time {
+		return time.Unix(1400000000, 0)
+	}
+
+	parts := strings.Split(p.Generate("woo"), ".")
+	if len(parts) != 3 {
+		t.Fatalf("Token had %d parts, but expected 3", len(parts))
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims jwtClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	want := jwtClaims{IssuedAt: 1400000000, Expires: 1400000600, Subject: "woo"}
+	if claims != want {
+		t.Errorf("Claims were %+v, but expected %+v", claims, want)
+	}
+}
+
+func TestJWTWrongID(t *testing.T) {
+	p := formatParams(FormatJWT)
+	token := p.Generate("woo")
+
+	if err := p.Validate("yay", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestJWTExpired(t *testing.T) {
+	p := formatParams(FormatJWT)
+	token := p.Generate("woo")
+
+	p.timer = func() time.Time {
+		return time.Now().Add(20 * time.Minute)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestJWTAlgNone(t *testing.T) {
+	p := formatParams(FormatJWT)
+	parts := strings.Split(p.Generate("woo"), ".")
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	token := header + "." + parts[1] + "."
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestJWTBadSignature(t *testing.T) {
+	p := formatParams(FormatJWT)
+	token := p.Generate("woo")
+
+	parts := strings.Split(token, ".")
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	sig[0] ^= 1
+	token = parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Error was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestJWTUnknownKey(t *testing.T) {
+	p := formatParams(FormatJWT)
+	token := p.Generate("woo")
+
+	other := New([]byte("adifferentsubmarine"))
+	other.Format = FormatJWT
+	if err := other.Validate("woo", token); err != ErrUnknownKey {
+		t.Fatalf("Error was %v, but expected ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,21 @@
+package charlie
+
+// ErrUnknownKey is returned when the provided token names a key other than the
+// one it's being validated with. This is the classic symptom of two
+// deployments generating tokens with different keys. As the token is invalid,
+// errors.Is(ErrUnknownKey, ErrInvalidToken) is true.
+//
+// Only formats with headers (JWT, PASETO, and COSE) carry a key ID, along with
+// FormatCharlieV2 and FormatCharlieV3, which carry its first byte.
+var ErrUnknownKey error = &ValidationError{Reason: ReasonUnknownKey}
+
+// KeyID returns the ID of the key, which is included in tokens whose formats
+// have headers. It's derived from the key, but reveals nothing about it.
+func (p *Params) KeyID() string {
+	return p.keys.current().kid
+}
+
+// keyIDBytes returns the ID of the given key, before encoding.
+func keyIDBytes(key []byte) []byte {
+	return deriveKey(key, "charlie/kid")[:6]
+}
@@ -0,0 +1,32 @@
+package charlie
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyID(t *testing.T) {
+	a, b := New([]byte("yay")), New([]byte("woo"))
+
+	if a.KeyID() == b.KeyID() {
+		t.Error("Different keys had the same ID")
+	}
+
+	if a.KeyID() != New([]byte("yay")).KeyID() {
+		t.Error("The same key had different IDs")
+	}
+
+	if len(a.KeyID()) != 8 {
+		t.Errorf("Key ID was %q, but expected 8 characters", a.KeyID())
+	}
+}
+
+func TestErrUnknownKey(t *testing.T) {
+	if !errors.Is(ErrUnknownKey, ErrInvalidToken) {
+		t.Error("ErrUnknownKey is not an ErrInvalidToken")
+	}
+
+	if errors.Is(ErrInvalidToken, ErrUnknownKey) {
+		t.Error("ErrInvalidToken is an ErrUnknownKey")
+	}
+}
@@ -0,0 +1,216 @@
+package charlie
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A signingKey is one of a Params' keys, along with the keys derived from it.
+type signingKey struct {
+	key     []byte
+	kid     string
+	kidByte byte // kidByte is the first byte of the key ID.
+	paseto  pasetoKeys
+	usage   *keyUsage
+	since   time.Time // since is when a previous key stopped being current.
+	retires time.Time // retires is when a previous key stops being accepted.
+}
+
+// retired returns true if the key, a previous key, is no longer accepted. Keys
+// without a retirement time are accepted until they're removed.
+func (sk *signingKey) retired(now time.Time) bool {
+	return !sk.retires.IsZero() && !now.Before(sk.retires)
+}
+
+func newSigningKey(key []byte) *signingKey {
+	k := make([]byte, len(key))
+	copy(k, key)
+	kid := keyIDBytes(k)
+	return &signingKey{
+		key:     k,
+		kid:     base64.RawURLEncoding.EncodeToString(kid),
+		kidByte: kid[0],
+		usage:   new(keyUsage),
+	}
+}
+
+// retiring returns a copy of the key, a previous key, which retires at the
+// given time.
+func (sk *signingKey) retiring(since, retires time.Time) *signingKey {
+	return &signingKey{
+		key:     sk.key,
+		kid:     sk.kid,
+		kidByte: sk.kidByte,
+		usage:   sk.usage,
+		since:   since,
+		retires: retires,
+	}
+}
+
+// keyUsage counts the successful validations of a key.
+type keyUsage struct {
+	validations atomic.Uint64
+	lastUsed    atomic.Int64 // lastUsed is a Unix time in nanoseconds.
+}
+
+func (u *keyUsage) record(now time.Time) {
+	u.validations.Add(1)
+	u.lastUsed.Store(now.UnixNano())
+}
+
+func (sk *signingKey) pasetoKeys() *pasetoKeys {
+	return sk.paseto.derive(sk.key)
+}
+
+func (sk *signingKey) publicKey() ed25519.PublicKey {
+	return sk.pasetoKeys().signer.Public().(ed25519.PublicKey)
+}
+
+// keySet is an immutable set of keys: the current key, which generates and
+// validates tokens, and previous keys, which only validate them.
+type keySet struct {
+	current  *signingKey
+	previous []*signingKey
+}
+
+// keyring holds a Params' keys, which may be replaced while in use. Copies of a
+// Params share its keyring.
+type keyring struct {
+	mu   sync.Mutex // mu serializes updates.
+	keys atomic.Pointer[keySet]
+}
+
+func newKeyring(key []byte, old [][]byte, now time.Time) *keyring {
+	ks := &keySet{current: newSigningKey(key)}
+	for _, k := range old {
+		sk := newSigningKey(k)
+		sk.since = now
+		ks.previous = append(ks.previous, sk)
+	}
+
+	kr := new(keyring)
+	kr.keys.Store(ks)
+	return kr
+}
+
+func (kr *keyring) load() *keySet {
+	return kr.keys.Load()
+}
+
+func (kr *keyring) current() *signingKey {
+	return kr.load().current
+}
+
+// rotate makes the given key current, continuing to accept the current key
+// for the given overlap. Previous keys which have retired by now are dropped,
+// and those which had no retirement time retire with the current key.
+func (kr *keyring) rotate(key []byte, now time.Time, overlap time.Duration) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	old := kr.keys.Load()
+	if bytes.Equal(old.current.key, key) {
+		return
+	}
+
+	ks := &keySet{
+		current: newSigningKey(key),
+		previous: []*signingKey{
+			old.current.retiring(now, now.Add(overlap)),
+		},
+	}
+	for _, sk := range old.previous {
+		if sk.retired(now) || bytes.Equal(sk.key, key) {
+			continue
+		}
+
+		// Old keys given to New retire along with the current key.
+		if sk.retires.IsZero() {
+			sk = sk.retiring(sk.since, now.Add(overlap))
+		}
+		ks.previous = append(ks.previous, sk)
+	}
+	kr.keys.Store(ks)
+}
+
+// idle returns true if the key, a previous key, has validated no tokens for
+// the given duration since it stopped being current.
+func (sk *signingKey) idle(now time.Time, d time.Duration) bool {
+	last := sk.since
+	if t := sk.usage.lastUsed.Load(); t != 0 && t > last.UnixNano() {
+		last = time.Unix(0, t)
+	}
+	return now.Sub(last) > d
+}
+
+// retireIdle drops previous keys which have validated no tokens for the given
+// duration, along with those which have retired.
+func (kr *keyring) retireIdle(now time.Time, d time.Duration) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	old := kr.keys.Load()
+	ks := &keySet{current: old.current}
+	for _, sk := range old.previous {
+		if !sk.retired(now) && !sk.idle(now, d) {
+			ks.previous = append(ks.previous, sk)
+		}
+	}
+
+	if len(ks.previous) != len(old.previous) {
+		kr.keys.Store(ks)
+	}
+}
+
+// SetKey replaces the key with which tokens are generated and validated. Tokens
+// generated with the previous key remain valid for the given overlap, so that
+// rolling out a new key doesn't reject the tokens of live users. An overlap of
+// MaxAge covers every outstanding token. It's safe to call SetKey while the
+// Params are in use.
+func (p *Params) SetKey(key []byte, overlap time.Duration) {
+	p.keys.rotate(key, p.timer(), overlap)
+}
+
+// Rotate replaces the key with which tokens are generated and validated, as
+// SetKey does, with an overlap of MaxAge.
+func (p *Params) Rotate(key []byte) {
+	p.SetKey(key, p.MaxAge)
+}
+
+// KeyUsage describes how one of a Params' keys has been used.
+type KeyUsage struct {
+	KeyID       string    // KeyID is the key's ID, as returned by KeyID.
+	Current     bool      // Current is true if the key generates tokens.
+	Validations uint64    // Validations is the number of tokens validated.
+	LastUsed    time.Time // LastUsed is when a token was last validated.
+	Retires     time.Time // Retires is when a previous key stops being accepted, if ever.
+}
+
+// KeyUsage returns the usage of each of the keys which validate tokens, current
+// key first, so that operators can tell when a previous key is no longer in
+// use and can safely be retired. Usage is counted from when a key was set.
+func (p *Params) KeyUsage() []KeyUsage {
+	ks := p.keys.load()
+	usage := []KeyUsage{ks.current.keyUsage()}
+	usage[0].Current = true
+	for _, sk := range ks.previous {
+		usage = append(usage, sk.keyUsage())
+	}
+	return usage
+}
+
+func (sk *signingKey) keyUsage() KeyUsage {
+	ku := KeyUsage{
+		KeyID:       sk.kid,
+		Validations: sk.usage.validations.Load(),
+		Retires:     sk.retires,
+	}
+	if t := sk.usage.lastUsed.Load(); t != 0 {
+		ku.LastUsed = time.Unix(0, t)
+	}
+	return ku
+}
@@ -0,0 +1,177 @@
+package charlie
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetKey(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	p := New([]byte("one"))
+	p.timer = func() time.Time { return now }
+
+	t1 := p.Generate("woo")
+	p.SetKey([]byte("two"), 5*time.Minute)
+	t2 := p.Generate("woo")
+
+	if p.KeyID() != New([]byte("two")).KeyID() {
+		t.Error("Expected the key to have been replaced")
+	}
+
+	for _, token := range []string{t1, t2} {
+		if err := p.Validate("woo", token); err != nil {
+			t.Errorf("Token %q was invalid: %v", token, err)
+		}
+	}
+
+	// After the overlap, tokens generated with the previous key are invalid.
+	now = now.Add(6 * time.Minute)
+	if err := p.Validate("woo", t1); !errors.Is(err, ErrInvalidToken) {
+		t.Error("Token generated with a retired key was valid")
+	}
+
+	if err := p.Validate("woo", t2); err != nil {
+		t.Errorf("Token generated with the current key was invalid: %v", err)
+	}
+}
+
+func TestSetKeyUnknownKey(t *testing.T) {
+	p := New([]byte("one"))
+	p.Format = FormatJWT
+
+	t1 := p.Generate("woo")
+	p.SetKey([]byte("two"), time.Minute)
+	p.SetKey([]byte("three"), time.Minute)
+
+	if err := p.Validate("woo", t1); err != nil {
+		t.Errorf("Token generated with a previous key was invalid: %v", err)
+	}
+
+	other := New([]byte("four"))
+	other.Format = FormatJWT
+	if err := p.Validate("woo", other.Generate("woo")); err != ErrUnknownKey {
+		t.Errorf("Error was %v, but expected ErrUnknownKey", err)
+	}
+}
+
+func TestSetKeySameKey(t *testing.T) {
+	p := New([]byte("one"))
+	p.SetKey([]byte("one"), time.Minute)
+
+	if ks := p.keys.load(); len(ks.previous) != 0 {
+		t.Errorf("Expected no previous keys, but got %d", len(ks.previous))
+	}
+}
+
+func TestKeyUsage(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	p := New([]byte("one"))
+	p.timer = func() time.Time { return now }
+
+	var used []string
+	p.OnKeyUsed = func(kid string) { used = append(used, kid) }
+
+	old := p.Generate("woo")
+	p.SetKey([]byte("two"), time.Hour)
+
+	now = now.Add(time.Second)
+	for _, token := range []string{old, p.Generate("woo"), p.Generate("woo"), "bad"} {
+		_ = p.Validate("woo", token)
+	}
+
+	one, two := New([]byte("one")).KeyID(), New([]byte("two")).KeyID()
+	if len(used) != 3 || used[0] != one || used[1] != two || used[2] != two {
+		t.Errorf("Keys used were %v", used)
+	}
+
+	usage := p.KeyUsage()
+	if len(usage) != 2 {
+		t.Fatalf("Expected 2 keys, but got %v", usage)
+	}
+
+	if ku := usage[0]; ku.KeyID != two || !ku.Current || ku.Validations != 2 || !ku.LastUsed.Equal(now) {
+		t.Errorf("Current key usage was %+v", ku)
+	}
+
+	if ku := usage[1]; ku.KeyID != one || ku.Current || ku.Validations != 1 || !ku.Retires.Equal(now.Add(time.Hour-time.Second)) {
+		t.Errorf("Previous key usage was %+v", ku)
+	}
+}
+
+func TestIdleKeyTimeout(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	p := New([]byte("one"))
+	p.timer = func() time.Time { return now }
+	p.MaxAge = time.Hour
+	p.IdleKeyTimeout = 10 * time.Minute
+
+	t1, t2 := p.Generate("woo"), p.Generate("woo")
+	p.SetKey([]byte("two"), time.Hour)
+
+	// Validations keep the previous key in use.
+	now = now.Add(9 * time.Minute)
+	if err := p.Validate("woo", t1); err != nil {
+		t.Fatalf("Token generated with the previous key was invalid: %v", err)
+	}
+
+	now = now.Add(9 * time.Minute)
+	if err := p.Validate("woo", t2); err != nil {
+		t.Fatalf("Token generated with the previous key was invalid: %v", err)
+	}
+
+	// Once it's idle, it's dropped.
+	now = now.Add(11 * time.Minute)
+	if err := p.Validate("woo", t1); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Token generated with an idle key was valid: %v", err)
+	}
+
+	if usage := p.KeyUsage(); len(usage) != 1 {
+		t.Errorf("Expected the idle key to be dropped, but got %v", usage)
+	}
+}
+
+func TestOldKeys(t *testing.T) {
+	one, two := New([]byte("one")), New([]byte("two"))
+	t1, t2 := one.Generate("woo"), two.Generate("woo")
+
+	p := New([]byte("three"), []byte("one"), []byte("two"))
+	for _, token := range []string{t1, t2, p.Generate("woo")} {
+		if err := p.Validate("woo", token); err != nil {
+			t.Errorf("Token %q was invalid: %v", token, err)
+		}
+	}
+
+	if p.KeyID() != New([]byte("three")).KeyID() {
+		t.Error("Expected tokens to be generated with the first key")
+	}
+
+	if err := p.Validate("woo", New([]byte("four")).Generate("woo")); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Token generated with another key was valid: %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	p := New([]byte("two"), []byte("one"))
+	p.timer = func() time.Time { return now }
+
+	t1 := New([]byte("one")).Generate("woo")
+	p.Rotate([]byte("three"))
+
+	usage := p.KeyUsage()
+	if len(usage) != 3 {
+		t.Fatalf("Expected 3 keys, but got %v", usage)
+	}
+
+	for _, ku := range usage[1:] {
+		if !ku.Retires.Equal(now.Add(p.MaxAge)) {
+			t.Errorf("Key %s retires at %v, but expected %v", ku.KeyID, ku.Retires, now.Add(p.MaxAge))
+		}
+	}
+
+	now = now.Add(p.MaxAge)
+	if err := p.Validate("woo", t1); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Token generated with a retired key was valid: %v", err)
+	}
+}
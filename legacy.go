@@ -0,0 +1,98 @@
+package charlie
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// A LegacyValidator validates tokens issued by another framework, so that a
+// service migrating to Charlie, or sharing a frontend with an app built on
+// that framework, can accept requests from JavaScript which already sends
+// them. See HTTPParams.LegacyValidator.
+type LegacyValidator interface {
+	// ValidateLegacy returns true if the given token, presented with the
+	// given request, is valid. It returns an error only if validation fails
+	// unexpectedly.
+	ValidateLegacy(r *http.Request, token string) (bool, error)
+}
+
+// LegacyValidatorFunc is an adapter to allow the use of ordinary functions as
+// LegacyValidators.
+type LegacyValidatorFunc func(r *http.Request, token string) (bool, error)
+
+// ValidateLegacy calls f(r, token).
+func (f LegacyValidatorFunc) ValidateLegacy(r *http.Request, token string) (bool, error) {
+	return f(r, token)
+}
+
+// validateLegacy returns the first candidate which the LegacyValidator
+// accepts, if it's set.
+func (hp *HTTPParams) validateLegacy(r *http.Request, cs []candidate) (candidate, bool, error) {
+	if hp.LegacyValidator == nil {
+		return candidate{}, false, nil
+	}
+
+	for _, c := range cs {
+		ok, err := hp.LegacyValidator.ValidateLegacy(r, c.token)
+		if err != nil {
+			return candidate{}, false, err
+		} else if ok {
+			hp.logf(r, "csrf_legacy", logFields{source: c.source}, "Accepted a legacy CSRF token from the %s.", c.source)
+			c.source = "legacy"
+			return c, true, nil
+		}
+	}
+	return candidate{}, false, nil
+}
+
+// Django's CSRF secrets and masked tokens.
+const (
+	djangoChars        = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	djangoSecretLength = 32
+)
+
+// DjangoValidator returns a LegacyValidator which accepts tokens issued by
+// Django's CsrfViewMiddleware, given the name of its cookie (by default,
+// "csrftoken"). As in Django, a token is valid if it's the secret held in the
+// cookie, or that secret masked. Only cookie-based secrets are supported, not
+// those stored in Django's sessions (CSRF_USE_SESSIONS).
+func DjangoValidator(cookie string) LegacyValidator {
+	return LegacyValidatorFunc(func(r *http.Request, token string) (bool, error) {
+		c, err := r.Cookie(cookie)
+		if err != nil {
+			return false, nil
+		}
+
+		secret, ok := djangoUnmask(c.Value)
+		if !ok {
+			return false, nil
+		}
+
+		given, ok := djangoUnmask(token)
+		return ok && subtle.ConstantTimeCompare([]byte(secret), []byte(given)) == 1, nil
+	})
+}
+
+// djangoUnmask returns the secret of a Django CSRF token: either the secret
+// itself or, at twice its length, a mask followed by the secret enciphered
+// with it.
+func djangoUnmask(token string) (string, bool) {
+	if strings.Trim(token, djangoChars) != "" {
+		return "", false
+	}
+
+	switch len(token) {
+	case djangoSecretLength:
+		return token, true
+	case 2 * djangoSecretLength:
+		mask, cipher := token[:djangoSecretLength], token[djangoSecretLength:]
+		secret := make([]byte, djangoSecretLength)
+		for i := range secret {
+			x := strings.IndexByte(djangoChars, cipher[i]) - strings.IndexByte(djangoChars, mask[i])
+			secret[i] = djangoChars[(x+len(djangoChars))%len(djangoChars)]
+		}
+		return string(secret), true
+	}
+	return "", false
+}
@@ -0,0 +1,95 @@
+package charlie
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// djangoMask masks a Django CSRF secret, as Django's _mask_cipher_secret does.
+func djangoMask(secret, mask string) string {
+	cipher := make([]byte, len(secret))
+	for i := range cipher {
+		x := strings.IndexByte(djangoChars, secret[i]) + strings.IndexByte(djangoChars, mask[i])
+		cipher[i] = djangoChars[x%len(djangoChars)]
+	}
+	return mask + string(cipher)
+}
+
+func TestDjangoValidator(t *testing.T) {
+	const (
+		secret = "Xk3sbVQp9mZ0aLr7TfYc2NwEu8Hj5GdR"
+		mask   = "zz0a9Bq1Wm2nE3rT4yU5iO6pA7sD8fG9"
+	)
+
+	v := DjangoValidator("csrftoken")
+	for _, tc := range []struct {
+		cookie, token string
+		valid         bool
+	}{
+		{cookie: secret, token: secret, valid: true},
+		{cookie: secret, token: djangoMask(secret, mask), valid: true},
+		{cookie: djangoMask(secret, mask), token: secret, valid: true},
+		{cookie: secret, token: djangoMask(strings.Repeat("a", 32), mask)},
+		{cookie: secret, token: secret[1:]},
+		{cookie: secret, token: strings.Replace(secret, "X", "-", 1)},
+		{cookie: "", token: secret},
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "csrftoken", Value: tc.cookie})
+		}
+
+		valid, err := v.ValidateLegacy(req, tc.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if valid != tc.valid {
+			t.Errorf("Token %q with cookie %q was valid=%v, but expected %v", tc.token, tc.cookie, valid, tc.valid)
+		}
+	}
+}
+
+func TestHTTPLegacyValidator(t *testing.T) {
+	var sources []string
+	hp := &HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    "csrf",
+		SessionHeader: "session",
+		LegacyValidator: LegacyValidatorFunc(func(r *http.Request, token string) (bool, error) {
+			if token == "boom" {
+				return false, errors.New("boom")
+			}
+			return token == "legacy", nil
+		}),
+		OnTokenSource: func(r *http.Request, source string) {
+			sources = append(sources, source)
+		},
+	}
+	handler := hp.Wrap(noContentHandler)
+
+	for _, tc := range []struct {
+		token string
+		code  int
+	}{
+		{token: "legacy", code: 204},
+		{token: "nope", code: http.StatusForbidden},
+		{token: "boom", code: http.StatusInternalServerError},
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("csrf", tc.token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != tc.code {
+			t.Errorf("Expected a %d for %q, got %d", tc.code, tc.token, res.Code)
+		}
+	}
+
+	if len(sources) != 1 || sources[0] != "legacy" {
+		t.Errorf("Token sources were %v, but expected [legacy]", sources)
+	}
+}
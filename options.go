@@ -0,0 +1,113 @@
+package charlie
+
+import (
+	"errors"
+	"time"
+)
+
+// MinKeySize is the minimum size of keys accepted by NewWithOptions.
+const MinKeySize = 16
+
+// ErrShortKey is returned by NewWithOptions when given a key shorter than
+// MinKeySize.
+var ErrShortKey = errors.New("key is shorter than 16 bytes")
+
+// An Option configures the Params returned by NewWithOptions.
+type Option func(p *Params) error
+
+// WithMaxAge sets the maximum age of tokens.
+func WithMaxAge(d time.Duration) Option {
+	return func(p *Params) error {
+		if d <= 0 {
+			return errors.New("max age must be positive")
+		}
+		p.MaxAge = d
+		return nil
+	}
+}
+
+// WithClock sets the function which returns the current time, with which
+// tokens are generated and validated, in place of time.Now. Tests can use it
+// to simulate the passage of time, e.g. to check that expired tokens are
+// rejected, without waiting for them to expire. It must not be nil.
+func WithClock(now func() time.Time) Option {
+	return func(p *Params) error {
+		if now == nil {
+			return errors.New("clock must not be nil")
+		}
+		p.timer = now
+		return nil
+	}
+}
+
+// WithFormat sets the wire format of generated tokens.
+func WithFormat(f Format) Option {
+	return func(p *Params) error {
+		p.Format = f
+		return nil
+	}
+}
+
+// WithHash sets the hash function of the HMAC which authenticates
+// FormatCharlieV2 and FormatCharlieV3 tokens.
+func WithHash(h Hash) Option {
+	return func(p *Params) error {
+		if !h.valid() {
+			return errUnknownHash
+		}
+		p.Hash = h
+		return nil
+	}
+}
+
+// WithMACSize sets the length, in bytes, of the MACs of FormatCharlie,
+// FormatCharlieV2, and FormatCharlieV3 tokens. It must be between 16 and 32.
+func WithMACSize(n int) Option {
+	return func(p *Params) error {
+		if n < macSize || n > maxMACSize {
+			return errBadMACSize
+		}
+		p.MACSize = n
+		return nil
+	}
+}
+
+// WithOldKeys sets the old keys with which tokens are also validated. See New.
+func WithOldKeys(keys ...[]byte) Option {
+	return func(p *Params) error {
+		for _, k := range keys {
+			if len(k) < MinKeySize {
+				return ErrShortKey
+			}
+		}
+		p.keys = newKeyring(p.keys.current().key, keys, p.timer())
+		return nil
+	}
+}
+
+// WithEnvironment sets the environment whose tokens the Params generate and
+// validate. See Params.Environment.
+func WithEnvironment(env string) Option {
+	return func(p *Params) error {
+		p.Environment = env
+		return nil
+	}
+}
+
+// NewWithOptions returns a new set of parameters given a key and options, as
+// New does. Unlike New, it returns ErrShortKey if the key is shorter than
+// MinKeySize, rather than generating weakly keyed tokens, and an error if any
+// of the options are invalid.
+func NewWithOptions(key []byte, opts ...Option) (*Params, error) {
+	if len(key) < MinKeySize {
+		return nil, ErrShortKey
+	}
+
+	p := New(key)
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,60 @@
+package charlie
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := []byte("an-old-key-of-16-bytes")
+	p, err := NewWithOptions([]byte("a-key-of-at-least-16-bytes"),
+		WithMaxAge(time.Hour),
+		WithClock(func() time.Time { return now }),
+		WithFormat(FormatJWT),
+		WithOldKeys(old),
+		WithEnvironment("staging"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.MaxAge != time.Hour || p.Format != FormatJWT || p.Environment != "staging" {
+		t.Errorf("Options weren't applied: %+v", p)
+	}
+
+	token := p.Generate("woo")
+	now = now.Add(59 * time.Minute)
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Expected the token to be valid with the clock, but got %v", err)
+	}
+
+	o := New(old)
+	o.Format = FormatJWT
+	o.Environment = "staging"
+	if err := p.Validate("woo", o.Generate("woo")); err != nil {
+		t.Errorf("Expected a token from an old key to be valid, but got %v", err)
+	}
+}
+
+func TestNewWithOptionsErrors(t *testing.T) {
+	for name, f := range map[string]func() (*Params, error){
+		"nil key":   func() (*Params, error) { return NewWithOptions(nil) },
+		"short key": func() (*Params, error) { return NewWithOptions([]byte("fifteen bytes..")) },
+		"short old key": func() (*Params, error) {
+			return NewWithOptions([]byte("a-key-of-at-least-16-bytes"), WithOldKeys([]byte("yay")))
+		},
+	} {
+		if p, err := f(); err != ErrShortKey || p != nil {
+			t.Errorf("%s: was %v, %v, but expected ErrShortKey", name, p, err)
+		}
+	}
+
+	if _, err := NewWithOptions([]byte("a-key-of-at-least-16-bytes"), WithMaxAge(0)); err == nil {
+		t.Error("Expected a zero max age to be rejected")
+	}
+
+	if _, err := NewWithOptions([]byte("a-key-of-at-least-16-bytes"), WithClock(nil)); err == nil {
+		t.Error("Expected a nil clock to be rejected")
+	}
+}
@@ -0,0 +1,257 @@
+package charlie
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	pasetoLocal  = "v4.local."
+	pasetoPublic = "v4.public."
+
+	pasetoNonceSize = 32
+	pasetoTagSize   = 32
+)
+
+// pasetoKeys holds the PASETO keys derived from a key.
+type pasetoKeys struct {
+	once   sync.Once
+	local  []byte
+	signer ed25519.PrivateKey
+}
+
+func (pk *pasetoKeys) derive(key []byte) *pasetoKeys {
+	pk.once.Do(func() {
+		pk.local = deriveKey(key, "charlie/paseto/v4.local")
+		pk.signer = ed25519.NewKeyFromSeed(deriveKey(key, "charlie/paseto/v4.public"))
+	})
+	return pk
+}
+
+// PublicKey returns the Ed25519 public key which verifies tokens generated in
+// FormatPASETOPublic. It is derived from the key, so it's safe to distribute
+// to any party which needs to verify tokens.
+func (p *Params) PublicKey() ed25519.PublicKey {
+	return p.keys.current().publicKey()
+}
+
+type pasetoFooter struct {
+	Kid string `json:"kid"`
+}
+
+type pasetoClaims struct {
+	IssuedAt string `json:"iat"`
+	Expires  string `json:"exp"`
+	Subject  string `json:"sub,omitempty"`
+}
+
+// pasetoImplicit returns the implicit assertion of v4.public tokens for the
+// given user in the given environment. Binding the user's identity through it
+// rather than a sub claim keeps it out of the token, whose claims are only
+// signed, not encrypted.
+func pasetoImplicit(env, id string) []byte {
+	return pae([]byte(env), []byte(id))
+}
+
+// pasetoImplicit returns the implicit assertion of the Params' v4.public tokens
+// for the given user. Tokens scoped to an audience, an action, or a link of a
+// chain also bind those, so that, as with the MAC of the other formats, they're
+// valid only in that scope.
+func (p *Params) pasetoImplicit(id string) []byte {
+	if p.audience == "" && p.action == "" && p.chain == "" {
+		return pasetoImplicit(p.Environment, id)
+	}
+	return pae([]byte(p.Environment), []byte(id), []byte(p.audience), []byte(p.action), []byte(p.chain))
+}
+
+func (p *Params) generatePASETO(sk *signingKey, id string, now time.Time) string {
+	claims := pasetoClaims{
+		IssuedAt: now.UTC().Format(time.RFC3339),
+		Expires:  now.Add(p.MaxAge).UTC().Format(time.RFC3339),
+	}
+	if p.Format == FormatPASETOLocal {
+		claims.Subject = id
+	}
+	m, _ := json.Marshal(claims)
+
+	f, _ := json.Marshal(pasetoFooter{Kid: sk.kid})
+	footer := "." + base64.RawURLEncoding.EncodeToString(f)
+
+	if p.Format == FormatPASETOPublic {
+		sig := ed25519.Sign(sk.pasetoKeys().signer, pae([]byte(pasetoPublic), m, f, p.pasetoImplicit(id)))
+		return pasetoPublic + base64.RawURLEncoding.EncodeToString(append(m, sig...)) + footer
+	}
+
+	n := make([]byte, pasetoNonceSize)
+	p.random(n)
+
+	ek, n2, ak := pasetoLocalKeys(p.pasetoLocalKey(sk, id), n)
+	c, _ := chacha20.NewUnauthenticatedCipher(ek, n2)
+	c.XORKeyStream(m, m)
+
+	t := pasetoMAC(ak, pae([]byte(pasetoLocal), n, m, f, nil))
+	out := append(append(n, m...), t...)
+	return pasetoLocal + base64.RawURLEncoding.EncodeToString(out) + footer
+}
+
+func (p *Params) openPASETO(sk *signingKey, id, token string) (Claims, error) {
+	header := pasetoLocal
+	if p.Format == FormatPASETOPublic {
+		header = pasetoPublic
+	}
+
+	data, f, err := splitPASETO(header, token)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if len(f) > 0 {
+		var pf pasetoFooter
+		if json.Unmarshal(f, &pf) != nil {
+			return Claims{}, ErrBadEncoding
+		}
+
+		if pf.Kid != "" && pf.Kid != sk.kid {
+			return Claims{}, ErrUnknownKey
+		}
+	}
+
+	var m []byte
+	if p.Format == FormatPASETOPublic {
+		if len(data) < ed25519.SignatureSize {
+			return Claims{}, ErrBadEncoding
+		}
+
+		m = data[:len(data)-ed25519.SignatureSize]
+		sig := data[len(data)-ed25519.SignatureSize:]
+		if !ed25519.Verify(sk.publicKey(), pae([]byte(header), m, f, p.pasetoImplicit(id)), sig) {
+			return Claims{}, ErrBadMAC
+		}
+		return parsePASETOClaims(id, m, sig)
+	}
+
+	if len(data) < pasetoNonceSize+pasetoTagSize {
+		return Claims{}, ErrBadEncoding
+	}
+
+	n := data[:pasetoNonceSize]
+	c := data[pasetoNonceSize : len(data)-pasetoTagSize]
+	t := data[len(data)-pasetoTagSize:]
+
+	ek, n2, ak := pasetoLocalKeys(p.pasetoLocalKey(sk, id), n)
+	if !hmac.Equal(pasetoMAC(ak, pae([]byte(header), n, c, f, nil)), t) {
+		return Claims{}, ErrBadMAC
+	}
+
+	m = make([]byte, len(c))
+	s, _ := chacha20.NewUnauthenticatedCipher(ek, n2)
+	s.XORKeyStream(m, c)
+
+	return parsePASETOClaims(id, m, t)
+}
+
+// splitPASETO returns the decoded body and footer of a PASETO token with the
+// given header.
+func splitPASETO(header, token string) (data, footer []byte, err error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, ErrBadEncoding
+	}
+
+	body, f := token[len(header):], ""
+	if i := strings.IndexByte(body, '.'); i >= 0 {
+		body, f = body[:i], body[i+1:]
+	}
+
+	data, err = base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, nil, ErrBadEncoding
+	}
+
+	footer, err = base64.RawURLEncoding.DecodeString(f)
+	if err != nil {
+		return nil, nil, ErrBadEncoding
+	}
+	return data, footer, nil
+}
+
+func parsePASETOClaims(id string, m, tag []byte) (Claims, error) {
+	var claims pasetoClaims
+	if err := json.Unmarshal(m, &claims); err != nil {
+		return Claims{}, ErrBadEncoding
+	}
+
+	// v4.public tokens bind the user's identity through their implicit
+	// assertion instead.
+	if claims.Subject != "" && subtle.ConstantTimeCompare([]byte(claims.Subject), []byte(id)) != 1 {
+		return Claims{}, ErrBadMAC
+	}
+
+	iat, err := time.Parse(time.RFC3339, claims.IssuedAt)
+	if err != nil {
+		return Claims{}, ErrBadEncoding
+	}
+
+	exp, err := time.Parse(time.RFC3339, claims.Expires)
+	if err != nil {
+		return Claims{}, ErrBadEncoding
+	}
+
+	return Claims{IssuedAt: iat, Expires: exp, Subject: id, tag: string(tag)}, nil
+}
+
+// pasetoLocalKey returns the v4.local key for the given user's tokens.
+func (p *Params) pasetoLocalKey(sk *signingKey, id string) []byte {
+	if key, derived := p.boundKey(sk, id); derived {
+		return deriveKey(key, "charlie/paseto/v4.local")
+	}
+	return sk.pasetoKeys().local
+}
+
+// pasetoLocalKeys splits a v4.local key into an encryption key, a nonce, and
+// an authentication key for the given token nonce.
+func pasetoLocalKeys(key, n []byte) (ek, n2, ak []byte) {
+	h, _ := blake2b.New(56, key)
+	_, _ = h.Write([]byte("paseto-encryption-key"))
+	_, _ = h.Write(n)
+	tmp := h.Sum(nil)
+
+	h, _ = blake2b.New256(key)
+	_, _ = h.Write([]byte("paseto-auth-key-for-aead"))
+	_, _ = h.Write(n)
+
+	return tmp[:32], tmp[32:], h.Sum(nil)
+}
+
+func pasetoMAC(key, data []byte) []byte {
+	h, _ := blake2b.New256(key)
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+// pae is PASETO's pre-authentication encoding.
+func pae(pieces ...[]byte) []byte {
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(len(pieces)))
+	for _, piece := range pieces {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(piece)))
+		buf = append(buf, piece...)
+	}
+	return buf
+}
+
+// deriveKey derives a 256-bit key for the given purpose from a Params key.
+func deriveKey(key []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(purpose))
+	return h.Sum(nil)
+}
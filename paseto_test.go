@@ -0,0 +1,132 @@
+package charlie
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPASETORoundTrip(t *testing.T) {
+	for _, f := range []Format{FormatPASETOLocal, FormatPASETOPublic} {
+		p := formatParams(f)
+		token := p.Generate("woo")
+
+		if err := p.Validate("woo", token); err != nil {
+			t.Errorf("%v: %v", f, err)
+		}
+
+		if err := p.Validate("yay", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: Error was %v, but expected ErrInvalidToken", f, err)
+		}
+	}
+}
+
+func TestPASETOHeaders(t *testing.T) {
+	if token := formatParams(FormatPASETOLocal).Generate("woo"); !strings.HasPrefix(token, "v4.local.") {
+		t.Errorf("Token was %q, but expected a v4.local token", token)
+	}
+
+	if token := formatParams(FormatPASETOPublic).Generate("woo"); !strings.HasPrefix(token, "v4.public.") {
+		t.Errorf("Token was %q, but expected a v4.public token", token)
+	}
+}
+
+func TestPASETOPublicUndisclosedID(t *testing.T) {
+	token := formatParams(FormatPASETOPublic).Generate("woo")
+	b, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(b), "woo") {
+		t.Errorf("Token disclosed the user's identity: %s", b)
+	}
+}
+
+func TestPASETOPublicScoped(t *testing.T) {
+	p := formatParams(FormatPASETOPublic)
+
+	token := p.GenerateFor("woo", "delete-account")
+	if err := p.ValidateFor("woo", "delete-account", token); err != nil {
+		t.Error(err)
+	}
+
+	if err := p.ValidateFor("woo", "change-email", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error for another action was %v, but expected ErrInvalidToken", err)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error without an action was %v, but expected ErrInvalidToken", err)
+	}
+
+	if err := p.Verifier().Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verifier error was %v, but expected ErrInvalidToken", err)
+	}
+
+	chained := p.GenerateChained("woo", "prev")
+	if err := p.ValidateChained("woo", "other", chained); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error for another link was %v, but expected ErrInvalidToken", err)
+	}
+}
+
+func TestPASETOExpired(t *testing.T) {
+	for _, f := range []Format{FormatPASETOLocal, FormatPASETOPublic} {
+		p := formatParams(f)
+		token := p.Generate("woo")
+
+		p.timer = func() time.Time {
+			return time.Now().Add(20 * time.Minute)
+		}
+
+		if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: Error was %v, but expected ErrInvalidToken", f, err)
+		}
+	}
+}
+
+func TestPASETOTampered(t *testing.T) {
+	for _, f := range []Format{FormatPASETOLocal, FormatPASETOPublic} {
+		p := formatParams(f)
+		token := p.Generate("woo")
+
+		parts := strings.Split(token, ".")
+		b, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		b[len(b)/2] ^= 1
+		parts[2] = base64.RawURLEncoding.EncodeToString(b)
+		token = strings.Join(parts, ".")
+
+		if err := p.Validate("woo", token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: Error was %v, but expected ErrInvalidToken", f, err)
+		}
+	}
+}
+
+func TestPASETOPublicKey(t *testing.T) {
+	p := formatParams(FormatPASETOPublic)
+	parts := strings.Split(p.Generate("woo"), ".")
+
+	b, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	f, _ := base64.RawURLEncoding.DecodeString(parts[3])
+	m, sig := b[:len(b)-ed25519.SignatureSize], b[len(b)-ed25519.SignatureSize:]
+
+	// The implicit assertion is PAE(environment, identity).
+	i := pae(nil, []byte("woo"))
+	if !ed25519.Verify(p.PublicKey(), pae([]byte("v4.public."), m, f, i), sig) {
+		t.Error("Token did not verify with the public key")
+	}
+}
+
+func TestPASETOUnknownKey(t *testing.T) {
+	for _, f := range []Format{FormatPASETOLocal, FormatPASETOPublic} {
+		token := formatParams(f).Generate("woo")
+
+		other := New([]byte("adifferentsubmarine"))
+		other.Format = f
+		if err := other.Validate("woo", token); err != ErrUnknownKey {
+			t.Errorf("%v: Error was %v, but expected ErrUnknownKey", f, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package charlie
+
+// NewAngularHTTPParams returns HTTPParams following the XSRF-TOKEN convention
+// of Angular's HttpClient and axios, which read a token from the XSRF-TOKEN
+// cookie and send it back in the X-XSRF-TOKEN header of unsafe requests. The
+// cookie is issued with each response, and isn't HttpOnly, so that they can
+// read it.
+//
+// Tokens are bound to a DoubleSubmit cookie, so no session is needed. To bind
+// them to an existing session instead, unset DoubleSubmit and set
+// SessionCookie or another session source.
+func NewAngularHTTPParams(key []byte) *HTTPParams {
+	return &HTTPParams{
+		Key:          key,
+		CSRFHeader:   "X-XSRF-TOKEN",
+		IssueCookie:  "XSRF-TOKEN",
+		DoubleSubmit: true,
+	}
+}
+
+// NewRailsHTTPParams returns HTTPParams following Rails' conventions, so that
+// pages and scripts written for Rails (e.g. rails-ujs and Turbo) work
+// unchanged: tokens are read from the X-CSRF-Token header and the
+// authenticity_token form field, and injected into HTML responses in a
+// csrf-token meta tag and in forms, as csrf_meta_tags and form_with would.
+// Rails' own tokens can't be validated outside of Rails, which holds their
+// secrets in its sessions; to accept them during a migration, set a
+// LegacyValidator which asks the Rails app.
+//
+// As with NewAngularHTTPParams, tokens are bound to a DoubleSubmit cookie.
+func NewRailsHTTPParams(key []byte) *HTTPParams {
+	return &HTTPParams{
+		Key:           key,
+		CSRFHeader:    "X-CSRF-Token",
+		CSRFFormField: "authenticity_token",
+		InjectMeta:    "csrf-token",
+		InjectForms:   true,
+		DoubleSubmit:  true,
+	}
+}
+
+// NewDjangoHTTPParams returns HTTPParams following Django's conventions: tokens
+// are read from the X-CSRFToken header and the csrfmiddlewaretoken form field,
+// and tokens issued by Django itself are accepted with DjangoValidator, so
+// that a service sharing a frontend with a Django app accepts requests from
+// scripts which send Django's token from its csrftoken cookie. Pages rendered
+// by the service get tokens of its own with TemplateField.
+//
+// As with NewAngularHTTPParams, tokens are bound to a DoubleSubmit cookie.
+func NewDjangoHTTPParams(key []byte) *HTTPParams {
+	return &HTTPParams{
+		Key:             key,
+		CSRFHeader:      "X-CSRFToken",
+		CSRFFormField:   "csrfmiddlewaretoken",
+		LegacyValidator: DjangoValidator("csrftoken"),
+		DoubleSubmit:    true,
+	}
+}
@@ -0,0 +1,101 @@
+package charlie
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewAngularHTTPParams(t *testing.T) {
+	handler := NewAngularHTTPParams([]byte(testKey)).Wrap(noContentHandler)
+
+	// The first response sets the XSRF-TOKEN and ID cookies.
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range res.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+
+	xsrf := cookies["XSRF-TOKEN"]
+	if xsrf == nil || xsrf.HttpOnly || cookies["charlie_id"] == nil {
+		t.Fatalf("Unexpected cookies: %v", res.Result().Cookies())
+	}
+
+	// Angular sends the cookies back, along with the token in a header.
+	req := httptest.NewRequest("POST", "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	req.Header.Set("X-XSRF-TOKEN", xsrf.Value)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected a 204 with the X-XSRF-TOKEN header, got %d", res.Code)
+	}
+
+	req.Header.Del("X-XSRF-TOKEN")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected a 403 without the X-XSRF-TOKEN header, got %d", res.Code)
+	}
+}
+
+func TestNewRailsHTTPParams(t *testing.T) {
+	handler := NewRailsHTTPParams([]byte(testKey)).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, `<html><head></head><body><form method="post"></form></body></html>`)
+	}))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+	m := regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)">`).FindStringSubmatch(res.Body.String())
+	if m == nil || !strings.Contains(res.Body.String(), `name="authenticity_token"`) {
+		t.Fatalf("Expected a csrf-token meta tag and an authenticity_token field, got %s", res.Body)
+	}
+
+	// rails-ujs sends the meta tag's token in a header.
+	req := httptest.NewRequest("POST", "/", nil)
+	for _, c := range res.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	req.Header.Set("X-CSRF-Token", html.UnescapeString(m[1]))
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 200 {
+		t.Errorf("Expected a 200 with the X-CSRF-Token header, got %d", res.Code)
+	}
+}
+
+func TestNewDjangoHTTPParams(t *testing.T) {
+	handler := NewDjangoHTTPParams([]byte(testKey)).Wrap(noContentHandler)
+
+	// A script sends the token from Django's csrftoken cookie, without ever
+	// having been given a token by Charlie.
+	secret := strings.Repeat("aB3", 10) + "xY"
+	req := httptest.NewRequest("POST", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "csrftoken", Value: secret})
+	req.Header.Set("X-CSRFToken", secret)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != 204 {
+		t.Errorf("Expected a 204 with Django's token, got %d", res.Code)
+	}
+
+	req.Header.Set("X-CSRFToken", strings.Repeat("z", 32))
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected a 403 with the wrong token, got %d", res.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package charlie
+
+import "time"
+
+// A Reason is why a token is invalid.
+type Reason uint8
+
+const (
+	// ReasonBadEncoding is the reason for tokens which are malformed.
+	ReasonBadEncoding Reason = iota + 1
+
+	// ReasonWrongLength is the reason for tokens which are well-formed, but too
+	// long or too short for their format. They're also ErrBadEncoding.
+	ReasonWrongLength
+
+	// ReasonBadMAC is the reason for tokens which fail authentication.
+	ReasonBadMAC
+
+	// ReasonUnknownKey is the reason for tokens which name another key.
+	ReasonUnknownKey
+
+	// ReasonExpired is the reason for authentic tokens which have expired.
+	ReasonExpired
+
+	// ReasonFutureTimestamp is the reason for authentic tokens issued further
+	// in the future than BatchWindow or MaxClockSkew allows.
+	ReasonFutureTimestamp
+
+	// ReasonRevoked is the reason for authentic tokens which were revoked.
+	ReasonRevoked
+
+	// ReasonReplayed is the reason for authentic tokens which were already
+	// redeemed.
+	ReasonReplayed
+
+	// ReasonMissingToken is the reason for requests which present no token.
+	ReasonMissingToken
+
+	// ReasonMissingSession is the reason for requests without a session.
+	ReasonMissingSession
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonBadEncoding:
+		return "bad encoding"
+	case ReasonWrongLength:
+		return "wrong length"
+	case ReasonBadMAC:
+		return "bad MAC"
+	case ReasonUnknownKey:
+		return "unknown key"
+	case ReasonExpired:
+		return "expired"
+	case ReasonFutureTimestamp:
+		return "future timestamp"
+	case ReasonRevoked:
+		return "revoked"
+	case ReasonReplayed:
+		return "replayed"
+	case ReasonMissingToken:
+		return "missing token"
+	case ReasonMissingSession:
+		return "missing session"
+	}
+	return "unknown"
+}
+
+// A ValidationError is why a token is invalid. ErrBadMAC, ErrTokenExpired, and
+// the other specific errors are all ValidationErrors, and errors.Is(err, target)
+// is true for any ValidationError with the same Reason as target, as well as
+// for ErrInvalidToken, so callers checking for either continue to work.
+type ValidationError struct {
+	Reason   Reason    // Reason is why the token is invalid.
+	IssuedAt time.Time // IssuedAt is when the token was issued, if it's authentic.
+}
+
+func (e *ValidationError) Error() string {
+	return ErrInvalidToken.Error() + ": " + e.Reason.String()
+}
+
+// Is returns true for ErrInvalidToken and for ValidationErrors with the same
+// Reason. Tokens of the wrong length are also ErrBadEncoding.
+func (e *ValidationError) Is(target error) bool {
+	if target == ErrInvalidToken {
+		return true
+	}
+
+	t, ok := target.(*ValidationError)
+	return ok && (t.Reason == e.Reason || (t.Reason == ReasonBadEncoding && e.Reason == ReasonWrongLength))
+}
+
+var (
+	errWrongLength     error = &ValidationError{Reason: ReasonWrongLength}
+	errFutureTimestamp error = &ValidationError{Reason: ReasonFutureTimestamp}
+)
+
+// issuedAt returns err with the time at which the authentic token it's about
+// was issued, if it's a ValidationError.
+func issuedAt(err error, t time.Time) error {
+	if e, ok := err.(*ValidationError); ok && !t.IsZero() {
+		return &ValidationError{Reason: e.Reason, IssuedAt: t}
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package charlie
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidationError(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	p := New([]byte("yay for dumbledore"))
+	p.MaxClockSkew = time.Minute
+	p.timer = func() time.Time { return now }
+
+	token := p.Generate("woo")
+	data, _ := base64.URLEncoding.DecodeString(token)
+	long := base64.URLEncoding.EncodeToString(append(data, 0))
+	future := p.GenerateAt("woo", now.Add(time.Hour))
+
+	for _, tc := range []struct {
+		token    string
+		at       time.Time
+		reason   Reason
+		issuedAt time.Time
+	}{
+		{token: "%%%", at: now, reason: ReasonBadEncoding},
+		{token: long, at: now, reason: ReasonWrongLength},
+		{token: p.Generate("yay"), at: now, reason: ReasonBadMAC},
+		{token: token, at: now.Add(4 * time.Hour), reason: ReasonExpired, issuedAt: now},
+		{token: future, at: now, reason: ReasonFutureTimestamp, issuedAt: now.Add(time.Hour)},
+	} {
+		now := tc.at
+		p.timer = func() time.Time { return now }
+
+		var e *ValidationError
+		err := p.Validate("woo", tc.token)
+		if !errors.As(err, &e) || !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%v: error was %v, but expected a ValidationError", tc.reason, err)
+			continue
+		}
+
+		if e.Reason != tc.reason || !e.IssuedAt.Equal(tc.issuedAt) {
+			t.Errorf("Error was %v issued at %v, but expected %v issued at %v",
+				e.Reason, e.IssuedAt, tc.reason, tc.issuedAt)
+		}
+	}
+}
+
+func TestValidationErrorIs(t *testing.T) {
+	expired := &ValidationError{Reason: ReasonExpired, IssuedAt: time.Now()}
+	if !errors.Is(expired, ErrTokenExpired) || errors.Is(expired, ErrBadMAC) {
+		t.Error("ValidationErrors should match only those with the same Reason")
+	}
+
+	if !errors.Is(errWrongLength, ErrBadEncoding) {
+		t.Error("Tokens of the wrong length should be ErrBadEncoding")
+	}
+
+	if errors.Is(ErrInvalidToken, ErrTokenExpired) {
+		t.Error("ErrInvalidToken shouldn't be ErrTokenExpired")
+	}
+
+	if got, want := expired.Error(), "invalid token: expired"; got != want {
+		t.Errorf("Error was %q, but expected %q", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package charlie
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// A Reloader replaces the key of a Params with the contents of a key file each
+// time the process receives SIGHUP, so that keys can be rotated by replacing
+// the file and signalling the process, as with nginx. Only the key is reloaded;
+// the rest of the Params' configuration is as the process set it.
+type Reloader struct {
+	Params  *Params
+	KeyFile string
+
+	// Overlap is how long tokens generated with the previous key remain valid.
+	// It defaults to the Params' MaxAge.
+	Overlap time.Duration
+
+	// OnReload, if non-nil, is called after each reload with its error, if
+	// any. If the key file can't be read, the current key remains in use.
+	OnReload func(err error)
+}
+
+// Reload replaces the key of the Params with the contents of the key file. It
+// returns ErrShortKey, and keeps the current key, if the file holds fewer than
+// MinKeySize bytes.
+func (rl *Reloader) Reload() error {
+	key, err := os.ReadFile(rl.KeyFile)
+	if err == nil && len(key) < MinKeySize {
+		err = ErrShortKey
+	}
+
+	if err == nil {
+		overlap := rl.Overlap
+		if overlap == 0 {
+			overlap = rl.Params.MaxAge
+		}
+		rl.Params.SetKey(key, overlap)
+	}
+
+	if rl.OnReload != nil {
+		rl.OnReload(err)
+	}
+	return err
+}
+
+// Run reloads the key each time the process receives SIGHUP until ctx is
+// done, returning ctx's error.
+func (rl *Reloader) Run(ctx context.Context) error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+			_ = rl.Reload()
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package charlie
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloaderReload(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("ayellowsubmarine2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New([]byte("one"))
+	old := p.Generate("woo")
+
+	var reloads []error
+	rl := &Reloader{
+		Params:   p,
+		KeyFile:  keyFile,
+		OnReload: func(err error) { reloads = append(reloads, err) },
+	}
+	if err := rl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.KeyID() != New([]byte("ayellowsubmarine2")).KeyID() {
+		t.Error("Expected the key to have been replaced")
+	}
+
+	if err := p.Validate("woo", old); err != nil {
+		t.Errorf("Token generated with the previous key was invalid: %v", err)
+	}
+
+	if len(reloads) != 1 || reloads[0] != nil {
+		t.Errorf("Reloads were %v, but expected one success", reloads)
+	}
+}
+
+func TestReloaderReloadMissingFile(t *testing.T) {
+	var reloads []error
+	p := New([]byte("one"))
+	rl := &Reloader{
+		Params:   p,
+		KeyFile:  filepath.Join(t.TempDir(), "key"),
+		OnReload: func(err error) { reloads = append(reloads, err) },
+	}
+
+	if err := rl.Reload(); err == nil {
+		t.Error("Expected an error")
+	}
+
+	if len(reloads) != 1 || reloads[0] == nil {
+		t.Errorf("Reloads were %v, but expected one failure", reloads)
+	}
+
+	if p.KeyID() != New([]byte("one")).KeyID() {
+		t.Error("Expected the key to be unchanged")
+	}
+}
+
+func TestReloaderReloadShortKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New([]byte("one"))
+	rl := &Reloader{Params: p, KeyFile: keyFile}
+	if err := rl.Reload(); err != ErrShortKey {
+		t.Errorf("Error was %v, but expected ErrShortKey", err)
+	}
+
+	if p.KeyID() != New([]byte("one")).KeyID() {
+		t.Error("Expected the key to be unchanged")
+	}
+}
+
+func TestReloaderRun(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("ayellowsubmarine2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan error, 1)
+	p := New([]byte("one"))
+	rl := &Reloader{
+		Params:   p,
+		KeyFile:  keyFile,
+		OnReload: func(err error) { reloaded <- err },
+	}
+
+	// Keep SIGHUP from killing the test process before Run registers for it.
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, syscall.SIGHUP)
+	defer signal.Stop(ignored)
+
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- rl.Run(ctx) }()
+
+	// Signal until Run has registered for SIGHUP.
+	for deadline := time.Now().Add(time.Second); ; {
+		if err := proc.Signal(syscall.SIGHUP); err != nil {
+			t.Skip(err)
+		}
+
+		select {
+		case err := <-reloaded:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Millisecond):
+			if time.Now().Before(deadline) {
+				continue
+			}
+			t.Fatal("Timed out waiting for a reload")
+		}
+		break
+	}
+
+	if p.KeyID() != New([]byte("ayellowsubmarine2")).KeyID() {
+		t.Error("Expected the key to have been replaced")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Error was %v, but expected Canceled", err)
+	}
+}
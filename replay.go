@@ -0,0 +1,100 @@
+package charlie
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// ErrTokenReplayed is returned when the provided token is authentic and
+// unexpired, but has already been redeemed, as recorded by the ReplayStore.
+var ErrTokenReplayed error = &ValidationError{Reason: ReasonReplayed}
+
+// A ReplayStore records which tokens have been redeemed, so that each is valid
+// only once. Implementations backed by shared stores (e.g. Redis, with SET NX
+// and an expiry) allow tokens to be redeemed once across a fleet of servers.
+type ReplayStore interface {
+	// Seen records the given token as redeemed until it expires, returning
+	// true if it already was. It must be atomic: of concurrent calls with the
+	// same token, only one may return false. Tokens are given in a canonical
+	// form (the base64url encoding of the MAC, signature, or tag which
+	// authenticated them) rather than as presented, so that re-encodings of a
+	// redeemed token are recognized.
+	Seen(ctx context.Context, token string, expires time.Time) (bool, error)
+}
+
+// MemoryReplayStore is a ReplayStore which records tokens in memory, for
+// single-server deployments. Tokens are forgotten once they expire.
+type MemoryReplayStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	sweep  time.Time
+	timer  func() time.Time
+}
+
+// NewMemoryReplayStore returns a new, empty MemoryReplayStore.
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{
+		tokens: make(map[string]time.Time),
+		timer:  time.Now,
+	}
+}
+
+// Seen implements ReplayStore.
+func (s *MemoryReplayStore) Seen(ctx context.Context, token string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timer()
+	if now.After(s.sweep) {
+		for t, exp := range s.tokens {
+			if now.After(exp) {
+				delete(s.tokens, t)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+
+	if exp, ok := s.tokens[token]; ok && !now.After(exp) {
+		return true, nil
+	}
+	s.tokens[token] = expires
+	return false, nil
+}
+
+// checkReplay returns ErrTokenReplayed if the token with the given claims has
+// already been redeemed. Tokens are recorded by their decoded tags rather than
+// as presented, since decoding is lenient (e.g. base64 ignores newlines) and
+// the same token may be presented in many encodings.
+func (p *Params) checkReplay(ctx context.Context, c Claims) error {
+	if p.ReplayStore == nil {
+		return nil
+	}
+
+	expires := c.IssuedAt.Add(p.MaxAge)
+	if !c.Expires.IsZero() && c.Expires.Before(expires) {
+		expires = c.Expires
+	}
+
+	key := base64.RawURLEncoding.EncodeToString([]byte(c.tag))
+	var seen, checked bool
+	err := p.callBackend(ctx, "replay store", p.ReplayBreaker, func(ctx context.Context) error {
+		var err error
+		seen, err = p.ReplayStore.Seen(ctx, key, expires)
+		checked = err == nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if !checked && p.BackendPolicy == Degrade && p.degraded != nil {
+		seen, _ = p.degraded.Seen(ctx, key, expires)
+	}
+
+	if seen {
+		return ErrTokenReplayed
+	}
+	return nil
+}
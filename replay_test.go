@@ -0,0 +1,115 @@
+package charlie
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestReplayStore(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatBranca
+	p.ReplayStore = NewMemoryReplayStore()
+
+	token := p.Generate("woo")
+	if info := p.Inspect("woo", token); !info.Valid {
+		t.Fatalf("Token was invalid: %v", info.Err)
+	}
+
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrTokenReplayed) || !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error was %v, but expected ErrTokenReplayed", err)
+	}
+
+	// Invalid tokens aren't recorded
+	if err := p.Validate("boo", p.Generate("woo")); !errors.Is(err, ErrBadMAC) {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+
+	if err := p.Validate("woo", p.Generate("woo")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryReplayStoreExpiry(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	s := NewMemoryReplayStore()
+	s.timer = func() time.Time { return now }
+
+	ctx := context.Background()
+	if seen, _ := s.Seen(ctx, "a", now.Add(time.Minute)); seen {
+		t.Error("Expected a new token not to have been seen")
+	}
+
+	if seen, _ := s.Seen(ctx, "a", now.Add(time.Minute)); !seen {
+		t.Error("Expected the token to have been seen")
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = s.Seen(ctx, "b", now.Add(time.Minute))
+	if _, ok := s.tokens["a"]; ok {
+		t.Error("Expected the expired token to be forgotten")
+	}
+}
+
+type failingReplayStore struct{}
+
+func (failingReplayStore) Seen(ctx context.Context, token string, expires time.Time) (bool, error) {
+	return false, errTestBackend
+}
+
+func TestReplayStoreFailure(t *testing.T) {
+	p := New([]byte("yay"))
+	p.ReplayStore = failingReplayStore{}
+
+	if err := p.Validate("woo", p.Generate("woo")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Error was %v, but expected ErrBackendUnavailable", err)
+	}
+
+	p.BackendPolicy = Degrade
+	token := p.Generate("woo")
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Expected the token to be accepted, but got %v", err)
+	}
+
+	// Degraded, replays are still rejected locally.
+	if err := p.Validate("woo", token); !errors.Is(err, ErrTokenReplayed) {
+		t.Errorf("Error was %v, but expected ErrTokenReplayed", err)
+	}
+
+	// Failing open, they aren't.
+	p.BackendPolicy = FailOpen
+	p.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := p.Validate("woo", token); err != nil {
+		t.Errorf("Expected the token to be accepted, but got %v", err)
+	}
+}
+
+func TestReplayStoreReencoding(t *testing.T) {
+	for _, f := range []Format{FormatCharlie, FormatCharlieV3, FormatJWT, FormatPASETOLocal, FormatBranca, FormatCOSE} {
+		p := New([]byte("yay"))
+		p.Format = f
+		p.ReplayStore = NewMemoryReplayStore()
+
+		token := p.Generate("woo")
+		if err := p.Validate("woo", token); err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+
+		// base64 decoding skips newlines, so these decode to the same token.
+		// Branca's base62 has no such leniency.
+		i := len(token) - 4
+		for _, reencoded := range []string{token[:i] + "\n" + token[i:], token[:i] + "\r\n" + token[i:]} {
+			err := p.Validate("woo", reencoded)
+			if f == FormatBranca && err == nil || f != FormatBranca && !errors.Is(err, ErrTokenReplayed) {
+				t.Errorf("%v: error was %v, but expected ErrTokenReplayed", f, err)
+			}
+		}
+	}
+}
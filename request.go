@@ -0,0 +1,58 @@
+package charlie
+
+import "net/http"
+
+// A RequestOption configures ValidateRequest.
+type RequestOption func(o *requestOptions)
+
+type requestOptions struct {
+	session, token []Extractor
+}
+
+// WithSession sets the Extractors of the user's session ID. They're tried in
+// order, and the first non-empty value is used.
+func WithSession(extractors ...Extractor) RequestOption {
+	return func(o *requestOptions) {
+		o.session = extractors
+	}
+}
+
+// WithToken sets the Extractors of the token. They're tried in order, and the
+// first non-empty value is used. By default, the token is read from the
+// X-CSRF-Token header.
+func WithToken(extractors ...Extractor) RequestOption {
+	return func(o *requestOptions) {
+		o.token = extractors
+	}
+}
+
+// ValidateRequest validates the token presented with the given request for the
+// user's session, for handlers which validate tokens outside of the middleware
+// (e.g. for each message received over a WebSocket). The session ID is read
+// with the Extractors given by WithSession; if there are none, or the request
+// has no session, ErrMissingSession is returned, and if it has no token,
+// ErrMissingToken. Errors returned by the Extractors are returned as-is, and
+// the request's context bounds validation as with ValidateContext.
+func (p *Params) ValidateRequest(r *http.Request, opts ...RequestOption) error {
+	o := requestOptions{token: []Extractor{FromHeader("X-CSRF-Token")}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	id, err := extract(r, o.session)
+	if err != nil {
+		return err
+	}
+
+	token, err := extract(r, o.token)
+	if err != nil {
+		return err
+	}
+
+	if id == "" {
+		return ErrMissingSession
+	} else if token == "" {
+		return ErrMissingToken
+	}
+	return p.ValidateContext(r.Context(), id, token)
+}
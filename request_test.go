@@ -0,0 +1,62 @@
+package charlie
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateRequest(t *testing.T) {
+	p := New([]byte("yay"))
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "woo"})
+	req.Header.Set("X-CSRF-Token", p.Generate("woo"))
+
+	if err := p.ValidateRequest(req, WithSession(FromCookie("session"))); err != nil {
+		t.Errorf("Valid token was rejected: %v", err)
+	}
+
+	if err := p.ValidateRequest(req); err != ErrMissingSession {
+		t.Errorf("Error without a session was %v, but expected ErrMissingSession", err)
+	}
+
+	if err := p.ValidateRequest(req, WithSession(FromHeader("X-Session"))); err != ErrMissingSession {
+		t.Errorf("Error with an empty session was %v, but expected ErrMissingSession", err)
+	}
+
+	err := p.ValidateRequest(req, WithSession(FromCookie("session")), WithToken(FromHeader("X-Other")))
+	if err != ErrMissingToken {
+		t.Errorf("Error without a token was %v, but expected ErrMissingToken", err)
+	}
+}
+
+func TestValidateRequestExtractorError(t *testing.T) {
+	p := New([]byte("yay"))
+	bad := errors.New("bad")
+
+	req := httptest.NewRequest("POST", "/", nil)
+	err := p.ValidateRequest(req, WithSession(ExtractorFunc("bad", func(r *http.Request) (string, error) {
+		return "", bad
+	})))
+	if err != bad {
+		t.Errorf("Error was %v, but expected %v", err, bad)
+	}
+}
+
+func TestValidateRequestCanceled(t *testing.T) {
+	p := New([]byte("yay"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest("POST", "/", nil).WithContext(ctx)
+	req.Header.Set("X-Session", "woo")
+	req.Header.Set("X-CSRF-Token", p.Generate("woo"))
+
+	if err := p.ValidateRequest(req, WithSession(FromHeader("X-Session"))); err != context.Canceled {
+		t.Errorf("Error was %v, but expected Canceled", err)
+	}
+}
@@ -0,0 +1,85 @@
+package charlie
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ErrTokenRevoked is returned when the provided token is authentic and
+// unexpired, but was issued before the user's tokens were revoked, as recorded
+// by the Revoker.
+var ErrTokenRevoked error = &ValidationError{Reason: ReasonRevoked}
+
+// A Revoker records when each user's tokens were last revoked (e.g. on logout or
+// a password change), so that tokens issued before then are invalid, rather
+// than remaining valid until they expire. Tokens whose timestamps have only
+// one-second resolution, as those of most formats do, are revoked only if
+// they were issued in an earlier second, so that tokens issued just after a
+// revocation remain valid.
+type Revoker interface {
+	// RevokedAt returns when the given user's tokens were last revoked, or
+	// the zero time if they never were.
+	RevokedAt(ctx context.Context, id string) (time.Time, error)
+}
+
+// MemoryRevoker is a Revoker which records revocations in memory, for
+// single-server deployments.
+type MemoryRevoker struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	timer   func() time.Time
+}
+
+// NewMemoryRevoker returns a new MemoryRevoker, with no revocations.
+func NewMemoryRevoker() *MemoryRevoker {
+	return &MemoryRevoker{
+		revoked: make(map[string]time.Time),
+		timer:   time.Now,
+	}
+}
+
+// Revoke revokes all of the given user's tokens issued until now.
+func (r *MemoryRevoker) Revoke(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revoked[id] = r.timer()
+}
+
+// RevokedAt implements Revoker.
+func (r *MemoryRevoker) RevokedAt(ctx context.Context, id string) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.revoked[id], nil
+}
+
+// checkRevoked returns ErrTokenRevoked if a token with the given claims was
+// issued at or before the user's tokens were last revoked, at the resolution of
+// the token's timestamp.
+func (p *Params) checkRevoked(ctx context.Context, id string, c Claims) error {
+	if p.Revoker == nil {
+		return nil
+	}
+
+	var revokedAt time.Time
+	err := p.callBackend(ctx, "revoker", p.RevokerBreaker, func(ctx context.Context) error {
+		var err error
+		revokedAt, err = p.Revoker.RevokedAt(ctx, id)
+		return err
+	})
+	if err != nil || revokedAt.IsZero() {
+		return err
+	}
+
+	revoked := !c.IssuedAt.After(revokedAt)
+	if c.IssuedAt.Nanosecond() == 0 {
+		revoked = c.IssuedAt.Before(revokedAt.Truncate(time.Second))
+	}
+
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
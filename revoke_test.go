@@ -0,0 +1,83 @@
+package charlie
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRevoker(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	r := NewMemoryRevoker()
+	r.timer = func() time.Time { return now }
+
+	p := New([]byte("yay"))
+	p.timer = func() time.Time { return now }
+	p.Revoker = r
+
+	token := p.Generate("woo")
+	other := p.Generate("boo")
+	if err := p.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Second)
+	r.Revoke("woo")
+
+	if err := p.Validate("woo", token); !errors.Is(err, ErrTokenRevoked) || !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error was %v, but expected ErrTokenRevoked", err)
+	}
+
+	if err := p.Validate("boo", other); err != nil {
+		t.Errorf("Expected another user's token to be valid, but got %v", err)
+	}
+
+	now = now.Add(time.Second)
+	if err := p.Validate("woo", p.Generate("woo")); err != nil {
+		t.Errorf("Expected a token issued after the revocation to be valid, but got %v", err)
+	}
+}
+
+func TestRevokerSameSecond(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	r := NewMemoryRevoker()
+	r.timer = func() time.Time { return now }
+
+	p := New([]byte("yay"))
+	p.timer = func() time.Time { return now }
+	p.Revoker = r
+
+	now = now.Add(300 * time.Millisecond)
+	r.Revoke("woo")
+
+	now = now.Add(300 * time.Millisecond)
+	if err := p.Validate("woo", p.Generate("woo")); err != nil {
+		t.Errorf("Expected a token issued later in the same second to be valid, but got %v", err)
+	}
+
+	p.Format = FormatCharlieV3
+	if err := p.Validate("woo", p.Generate("woo")); err != nil {
+		t.Errorf("Expected a v3 token issued after the revocation to be valid, but got %v", err)
+	}
+
+	p.timer = func() time.Time { return now.Add(-500 * time.Millisecond) }
+	if err := p.Validate("woo", p.Generate("woo")); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Error for a v3 token issued before the revocation was %v, but expected ErrTokenRevoked", err)
+	}
+}
+
+type failingRevoker struct{}
+
+func (failingRevoker) RevokedAt(ctx context.Context, id string) (time.Time, error) {
+	return time.Time{}, errTestBackend
+}
+
+func TestRevokerFailure(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Revoker = failingRevoker{}
+
+	if err := p.Validate("woo", p.Generate("woo")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Error was %v, but expected ErrBackendUnavailable", err)
+	}
+}
@@ -0,0 +1,60 @@
+package charlie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ScriptVersion is the version of the script served by ScriptHandler. It's
+// incremented whenever the script's behavior changes.
+const ScriptVersion = "1"
+
+//go:embed charlie.js
+var script []byte
+
+// ScriptHandler returns an http.Handler which serves a JavaScript helper,
+// configured to match the middleware, for pages to include with a script tag.
+// It attaches a token to each same-origin fetch and XMLHttpRequest request
+// with an unsafe method, sending it in the CSRFHeader. The token is read from
+// a meta tag with the given name (e.g. <meta name="csrf-token" content="...">)
+// if non-empty, from the IssueCookie, and from the IssueHeader of earlier
+// responses, preferring the freshest. The script also exposes the current
+// token as window.charlie.token().
+func (hp *HTTPParams) ScriptHandler(meta string) http.Handler {
+	config, _ := json.Marshal(scriptConfig{
+		Version:     ScriptVersion,
+		Header:      hp.CSRFHeader,
+		Cookie:      hp.IssueCookie,
+		IssueHeader: hp.IssueHeader,
+		Meta:        meta,
+	})
+
+	var body bytes.Buffer
+	body.Write(bytes.TrimSpace(script))
+	body.WriteString("(")
+	body.Write(config)
+	body.WriteString(");\n")
+
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + ScriptVersion + "-" + hex.EncodeToString(sum[:8]) + `"`
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "charlie.js", time.Time{}, bytes.NewReader(body.Bytes()))
+	})
+}
+
+type scriptConfig struct {
+	Version     string `json:"version"`
+	Header      string `json:"header"`
+	Cookie      string `json:"cookie,omitempty"`
+	IssueHeader string `json:"issueHeader,omitempty"`
+	Meta        string `json:"meta,omitempty"`
+}
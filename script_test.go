@@ -0,0 +1,48 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScriptHandler(t *testing.T) {
+	hp := &HTTPParams{
+		Key:         []byte("yay"),
+		CSRFHeader:  "X-CSRF-Token",
+		IssueCookie: "csrf",
+	}
+	h := hp.ScriptHandler("csrf-token")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/charlie.js", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status was %d", w.Code)
+	}
+
+	if v := w.Header().Get("Content-Type"); v != "text/javascript; charset=utf-8" {
+		t.Errorf("Content-Type was %q", v)
+	}
+
+	body := w.Body.String()
+	expected := `({"version":"1","header":"X-CSRF-Token","cookie":"csrf","meta":"csrf-token"});`
+	if !strings.HasSuffix(strings.TrimSpace(body), expected) {
+		t.Errorf("Script didn't end with its config: %q", body[len(body)-100:])
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("No ETag")
+	}
+
+	r := httptest.NewRequest("GET", "/charlie.js", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Status was %d, but expected 304", w.Code)
+	}
+}
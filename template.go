@@ -0,0 +1,75 @@
+package charlie
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+)
+
+type tokenKey struct{}
+
+// issuedToken is a token issued with a response, and the form field in which
+// the middleware expects it back.
+type issuedToken struct {
+	token, field string
+	rw           *responseWriter
+}
+
+// withToken returns the request with the given issued token in its context.
+func (hp *HTTPParams) withToken(r *http.Request, rw *responseWriter, token string) *http.Request {
+	t := &issuedToken{token: token, field: hp.CSRFFormField, rw: rw}
+	return r.WithContext(context.WithValue(r.Context(), tokenKey{}, t))
+}
+
+// issuedTokenFromContext returns the token issued with the response to the
+// request whose context is ctx, if any. As the response now carries the token
+// in its body, it's kept out of shared caches.
+func issuedTokenFromContext(ctx context.Context) *issuedToken {
+	t, _ := ctx.Value(tokenKey{}).(*issuedToken)
+	if t != nil && t.rw != nil {
+		t.rw.issued = true
+	}
+	return t
+}
+
+// TokenFromContext returns the token the middleware generated for the response
+// to the request whose context is ctx, for handlers to embed in HTML or JSON
+// bodies, or an empty string if the request has no session. Responses whose
+// handlers call it before writing their headers get the same Cache-Control as
+// responses with issued tokens.
+func TokenFromContext(ctx context.Context) string {
+	if t := issuedTokenFromContext(ctx); t != nil {
+		return t.token
+	}
+	return ""
+}
+
+// TemplateField returns a hidden form input holding the token issued with the
+// response to the request whose context is ctx, named after the middleware's
+// CSRFFormField, e.g. <input type="hidden" name="csrf" value="...">. It
+// returns nothing if no token was issued or the middleware doesn't read tokens
+// from forms.
+func TemplateField(ctx context.Context) template.HTML {
+	t := issuedTokenFromContext(ctx)
+	if t == nil || t.field == "" {
+		return ""
+	}
+
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(t.field) +
+		`" value="` + template.HTMLEscapeString(t.token) + `">`)
+}
+
+// TemplateFuncs returns functions for html/template: csrfField, which is
+// TemplateField, and csrfToken, which is TokenFromContext. A form can then
+// include its token with one line:
+//
+//	<form method="post">
+//	  {{ csrfField .Context }}
+//	  ...
+//	</form>
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"csrfField": TemplateField,
+		"csrfToken": TokenFromContext,
+	}
+}
@@ -0,0 +1,82 @@
+package charlie
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTemplateField(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFFormField: "csrf",
+		SessionHeader: testSessionHeader,
+		IssueHeader:   testCSRFHeader,
+	}
+
+	tmpl := template.Must(template.New("form").Funcs(TemplateFuncs()).Parse(
+		`<form method="post">{{ csrfField .Context }}</form>`))
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = tmpl.Execute(w, r)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(testSessionHeader, testSessionID)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	token := res.Header().Get(testCSRFHeader)
+	want := `<form method="post"><input type="hidden" name="csrf" value="` + token + `"></form>`
+	if token == "" || res.Body.String() != want {
+		t.Errorf("Rendered %q, but expected %q", res.Body.String(), want)
+	}
+
+	if err := New(v.Key).Validate(testSessionID, token); err != nil {
+		t.Errorf("Rendered token was invalid: %v", err)
+	}
+}
+
+func TestTemplateFieldWithoutToken(t *testing.T) {
+	if f := TemplateField(context.Background()); f != "" {
+		t.Errorf("Expected no field without a token, got %q", f)
+	}
+
+	v := HTTPParams{CSRFFormField: `"><script>`}
+	r := v.withToken(httptest.NewRequest("GET", "/", nil), nil, "woo")
+	if f := string(TemplateField(r.Context())); strings.Contains(f, "<script>") {
+		t.Errorf("Field name wasn't escaped: %q", f)
+	}
+}
+
+func TestTokenFromContext(t *testing.T) {
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		CSRFHeader:    testCSRFHeader,
+		SessionHeader: testSessionHeader,
+	}
+
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(TokenFromContext(r.Context())))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Body.Len() != 0 {
+		t.Errorf("Expected no token without a session, got %q", res.Body.String())
+	}
+
+	req.Header.Set(testSessionHeader, testSessionID)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if err := New(v.Key).Validate(testSessionID, res.Body.String()); err != nil {
+		t.Errorf("Token %q was invalid: %v", res.Body.String(), err)
+	}
+
+	if cc := res.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control was %q, but expected no-store", cc)
+	}
+}
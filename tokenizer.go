@@ -0,0 +1,60 @@
+package charlie
+
+import (
+	"context"
+	"strconv"
+)
+
+// A Tokenizer generates and validates tokens for identities of type ID, such as
+// integer user IDs or UUIDs, binding each to the same bytes wherever it's
+// used. Tokens are those Params generates for the bound bytes, so a Tokenizer
+// and Params with the same configuration accept each other's tokens.
+type Tokenizer[ID comparable] struct {
+	Params *Params
+	Bind   func(id ID) []byte // Bind returns the bytes a token is bound to.
+}
+
+// NewTokenizer returns a Tokenizer which binds identities with the given
+// function.
+func NewTokenizer[ID comparable](p *Params, bind func(id ID) []byte) *Tokenizer[ID] {
+	return &Tokenizer[ID]{Params: p, Bind: bind}
+}
+
+// Generate returns a new token for the given user.
+func (t *Tokenizer[ID]) Generate(id ID) string {
+	return t.Params.Generate(string(t.Bind(id)))
+}
+
+// GenerateContext returns a new token for the given user, as with
+// Params.GenerateContext.
+func (t *Tokenizer[ID]) GenerateContext(ctx context.Context, id ID) (string, error) {
+	return t.Params.GenerateContext(ctx, string(t.Bind(id)))
+}
+
+// Validate validates the given token for the given user.
+func (t *Tokenizer[ID]) Validate(id ID, token string) error {
+	return t.Params.Validate(string(t.Bind(id)), token)
+}
+
+// ValidateContext validates the given token for the given user, as with
+// Params.ValidateContext.
+func (t *Tokenizer[ID]) ValidateContext(ctx context.Context, id ID, token string) error {
+	return t.Params.ValidateContext(ctx, string(t.Bind(id)), token)
+}
+
+// BindString binds string identities to their bytes.
+func BindString[ID ~string](id ID) []byte {
+	return []byte(id)
+}
+
+// BindInt binds integer identities to their decimal representation, as
+// formatted by strconv.
+func BindInt[ID ~int | ~int8 | ~int16 | ~int32 | ~int64](id ID) []byte {
+	return strconv.AppendInt(nil, int64(id), 10)
+}
+
+// BindUint binds unsigned integer identities to their decimal representation,
+// as formatted by strconv.
+func BindUint[ID ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64](id ID) []byte {
+	return strconv.AppendUint(nil, uint64(id), 10)
+}
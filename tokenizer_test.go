@@ -0,0 +1,68 @@
+package charlie
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	type userID int64
+
+	p := New([]byte("yay"))
+	tok := NewTokenizer(p, BindInt[userID])
+
+	token := tok.Generate(12345)
+	if err := tok.Validate(12345, token); err != nil {
+		t.Errorf("Token was invalid: %v", err)
+	}
+
+	if err := tok.Validate(12346, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Token was valid for another user: %v", err)
+	}
+
+	if err := p.Validate("12345", token); err != nil {
+		t.Errorf("Token wasn't bound to the decimal ID: %v", err)
+	}
+
+	token, err := tok.GenerateContext(context.Background(), 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tok.ValidateContext(context.Background(), 12345, token); err != nil {
+		t.Errorf("Token was invalid: %v", err)
+	}
+}
+
+func TestTokenizerBytes(t *testing.T) {
+	type uuid [16]byte
+
+	tok := NewTokenizer(New([]byte("yay")), func(id uuid) []byte { return id[:] })
+	a, b := uuid{1}, uuid{2}
+
+	token := tok.Generate(a)
+	if err := tok.Validate(a, token); err != nil {
+		t.Errorf("Token was invalid: %v", err)
+	}
+
+	if err := tok.Validate(b, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Token was valid for another user: %v", err)
+	}
+}
+
+func TestBindings(t *testing.T) {
+	type name string
+
+	if v := string(BindString(name("woo"))); v != "woo" {
+		t.Errorf("BindString was %q", v)
+	}
+
+	if v := string(BindInt(int8(-12))); v != "-12" {
+		t.Errorf("BindInt was %q", v)
+	}
+
+	if v := string(BindUint(uint64(1 << 63))); v != "9223372036854775808" {
+		t.Errorf("BindUint was %q", v)
+	}
+}
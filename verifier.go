@@ -0,0 +1,71 @@
+package charlie
+
+import (
+	"crypto/ed25519"
+	"time"
+)
+
+// A Verifier validates FormatPASETOPublic tokens with only the public keys
+// which verify them, so that services which accept tokens needn't hold the key
+// which generates them. It accepts only tokens which aren't scoped to an
+// audience, an action, or a chain link.
+type Verifier struct {
+	keys  []ed25519.PublicKey
+	timer func() time.Time
+
+	MaxAge       time.Duration // MaxAge is the maximum age of tokens.
+	MaxClockSkew time.Duration // MaxClockSkew is as Params.MaxClockSkew.
+	Environment  string        // Environment is as Params.Environment.
+}
+
+// NewVerifier returns a Verifier which validates tokens with any of the given
+// public keys, as returned by Params.PublicKey.
+func NewVerifier(keys ...ed25519.PublicKey) *Verifier {
+	return &Verifier{
+		keys:   keys,
+		timer:  time.Now,
+		MaxAge: 10 * time.Minute,
+	}
+}
+
+// Verifier returns a Verifier which validates the FormatPASETOPublic tokens
+// the Params generate, with the public keys of its current and previous keys.
+func (p *Params) Verifier() *Verifier {
+	ks := p.keys.load()
+	v := NewVerifier(ks.current.publicKey())
+	for _, sk := range ks.previous {
+		v.keys = append(v.keys, sk.publicKey())
+	}
+	v.MaxAge = p.MaxAge
+	v.MaxClockSkew = p.MaxClockSkew
+	v.Environment = p.Environment
+	return v
+}
+
+// Validate validates the given token for the given user.
+func (v *Verifier) Validate(id, token string) error {
+	data, f, err := splitPASETO(pasetoPublic, token)
+	if err != nil {
+		return err
+	} else if len(data) < ed25519.SignatureSize {
+		return ErrBadEncoding
+	}
+
+	m := data[:len(data)-ed25519.SignatureSize]
+	sig := data[len(data)-ed25519.SignatureSize:]
+	msg := pae([]byte(pasetoPublic), m, f, pasetoImplicit(v.Environment, id))
+	for _, k := range v.keys {
+		if !ed25519.Verify(k, msg, sig) {
+			continue
+		}
+
+		c, err := parsePASETOClaims(id, m, sig)
+		if err != nil {
+			return err
+		}
+
+		p := Params{MaxAge: v.MaxAge, MaxClockSkew: v.MaxClockSkew}
+		return p.checkExpiry(c, v.timer())
+	}
+	return ErrBadMAC
+}
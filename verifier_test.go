@@ -0,0 +1,59 @@
+package charlie
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifier(t *testing.T) {
+	p := New([]byte("yay"))
+	p.Format = FormatPASETOPublic
+	p.Environment = "staging"
+
+	v := NewVerifier(p.PublicKey())
+	v.Environment = "staging"
+
+	token := p.Generate("woo")
+	if err := v.Validate("woo", token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Validate("boo", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Error was %v, but expected ErrInvalidToken", err)
+	}
+
+	if err := NewVerifier(New([]byte("boo")).PublicKey()).Validate("woo", token); err != ErrBadMAC {
+		t.Errorf("Error was %v, but expected ErrBadMAC", err)
+	}
+
+	v.timer = func() time.Time { return time.Now().Add(time.Hour) }
+	if err := v.Validate("woo", token); err != ErrTokenExpired {
+		t.Errorf("Error was %v, but expected ErrTokenExpired", err)
+	}
+
+	p.Format = FormatCharlie
+	if err := v.Validate("woo", p.Generate("woo")); err != ErrBadEncoding {
+		t.Errorf("Error was %v, but expected ErrBadEncoding", err)
+	}
+}
+
+func TestParamsVerifier(t *testing.T) {
+	old := New([]byte("one"))
+	old.Format = FormatPASETOPublic
+
+	p := New([]byte("two"), []byte("one"))
+	p.Format = FormatPASETOPublic
+	p.MaxAge = time.Hour
+
+	v := p.Verifier()
+	if v.MaxAge != time.Hour {
+		t.Errorf("MaxAge was %v, but expected %v", v.MaxAge, time.Hour)
+	}
+
+	for _, token := range []string{p.Generate("woo"), old.Generate("woo")} {
+		if err := v.Validate("woo", token); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package charlie
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A TokenWriter sends a freshly issued token with a response. It's called
+// before the wrapped handler, so may set headers and trailers or wrap the
+// response in some other way.
+type TokenWriter interface {
+	WriteToken(w http.ResponseWriter, r *http.Request, token string)
+}
+
+// TokenWriterFunc is an adapter to allow the use of ordinary functions as
+// TokenWriters.
+type TokenWriterFunc func(w http.ResponseWriter, r *http.Request, token string)
+
+// WriteToken calls f(w, r, token).
+func (f TokenWriterFunc) WriteToken(w http.ResponseWriter, r *http.Request, token string) {
+	f(w, r, token)
+}
+
+// ToHeader returns a TokenWriter which sends the token in the given response
+// header.
+func ToHeader(name string) TokenWriter {
+	return TokenWriterFunc(func(w http.ResponseWriter, r *http.Request, token string) {
+		w.Header().Set(name, token)
+	})
+}
+
+// ToCookie returns a TokenWriter which sends the token in the given cookie. The
+// cookie isn't HttpOnly, so that JavaScript can read it and send it back in a
+// header.
+func ToCookie(name string) TokenWriter {
+	return ToCookieWith(http.Cookie{
+		Name:     name,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ToCookieWith returns a TokenWriter which sends the token in a cookie with the
+// given name and attributes (e.g. Domain, Path, MaxAge, SameSite, and
+// HttpOnly). Its Path defaults to "/" and its SameSite to Lax, and it's always
+// Secure, even over plain HTTP, lest a token leak to a network attacker; see
+// ToInsecureCookieWith for development without TLS. Cookies whose names have
+// the "__Host-" prefix have Path "/" and no Domain, as browsers otherwise
+// reject them.
+func ToCookieWith(template http.Cookie) TokenWriter {
+	return cookieWriter(template, false)
+}
+
+// ToInsecureCookieWith returns a TokenWriter like ToCookieWith, except that the
+// cookie is only Secure over TLS, unless its template or its name's prefix
+// says otherwise, for development over plain HTTP. It's unsafe in production.
+func ToInsecureCookieWith(template http.Cookie) TokenWriter {
+	return cookieWriter(template, true)
+}
+
+// cookieWriter returns a TokenWriter which sends the token in a cookie with the
+// given template, per newCookie.
+func cookieWriter(template http.Cookie, insecure bool) TokenWriter {
+	return TokenWriterFunc(func(w http.ResponseWriter, r *http.Request, token string) {
+		http.SetCookie(w, newCookie(template, token, r, insecure))
+	})
+}
+
+// newCookie returns a cookie with the given value and the template's name and
+// attributes, per ToCookieWith, or per ToInsecureCookieWith if insecure.
+func newCookie(template http.Cookie, value string, r *http.Request, insecure bool) *http.Cookie {
+	c := template
+	c.Value = value
+	c.Secure = c.Secure || !insecure || r.TLS != nil
+
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
+	}
+
+	if strings.HasPrefix(c.Name, "__Host-") {
+		c.Secure, c.Path, c.Domain = true, "/", ""
+	} else if strings.HasPrefix(c.Name, "__Secure-") {
+		c.Secure = true
+	}
+	return &c
+}
+
+// ToTrailer returns a TokenWriter which sends the token in the given response
+// trailer, for streamed responses whose headers are written before the client
+// needs a fresh token. Trailers are only sent with chunked responses.
+func ToTrailer(name string) TokenWriter {
+	return TokenWriterFunc(func(w http.ResponseWriter, r *http.Request, token string) {
+		w.Header().Set(http.TrailerPrefix+name, token)
+	})
+}
@@ -0,0 +1,128 @@
+package charlie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenWriters(t *testing.T) {
+	var custom string
+	v := HTTPParams{
+		Key:           []byte(testKey),
+		SessionCookie: testSessionCookie,
+		EnforceIf:     func(r *http.Request) bool { return false },
+		TokenWriters: []TokenWriter{
+			ToTrailer("X-Next-Token"),
+			TokenWriterFunc(func(w http.ResponseWriter, r *http.Request, token string) {
+				custom = token
+			}),
+		},
+	}
+	handler := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"a":1}` + "\n"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: testSessionCookie, Value: testSessionID})
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	token := res.Result().Trailer.Get("X-Next-Token")
+	if token == "" {
+		t.Fatal("Expected a token in the response trailer")
+	}
+
+	if custom != token {
+		t.Errorf("Custom writer was sent %q, but expected %q", custom, token)
+	}
+
+	if err := v.params().Validate(testSessionID, token); err != nil {
+		t.Errorf("Issued token was invalid: %v", err)
+	}
+
+	if v := res.Header().Get("Cache-Control"); v != "no-store" {
+		t.Errorf("Cache-Control was %q, but expected no-store", v)
+	}
+}
+
+func TestToHeaderAndCookie(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	res := httptest.NewRecorder()
+	ToHeader("X-Token").WriteToken(res, req, "token")
+	ToCookie("XSRF-TOKEN").WriteToken(res, req, "token")
+
+	if v := res.Header().Get("X-Token"); v != "token" {
+		t.Errorf("Header was %q, but expected token", v)
+	}
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "token" || !cookies[0].Secure || cookies[0].HttpOnly {
+		t.Errorf("Unexpected cookies: %v", cookies)
+	}
+}
+
+func TestToCookieWithDefaultsAndPrefixes(t *testing.T) {
+	for _, tc := range []struct {
+		template http.Cookie
+		tls      bool
+		insecure bool
+		want     http.Cookie
+	}{
+		{
+			template: http.Cookie{Name: "csrf"},
+			want:     http.Cookie{Name: "csrf", Path: "/", SameSite: http.SameSiteLaxMode, Secure: true},
+		},
+		{
+			template: http.Cookie{Name: "csrf"},
+			insecure: true,
+			want:     http.Cookie{Name: "csrf", Path: "/", SameSite: http.SameSiteLaxMode},
+		},
+		{
+			template: http.Cookie{Name: "csrf"},
+			tls:      true,
+			insecure: true,
+			want:     http.Cookie{Name: "csrf", Path: "/", SameSite: http.SameSiteLaxMode, Secure: true},
+		},
+		{
+			template: http.Cookie{Name: "__Secure-csrf"},
+			insecure: true,
+			want:     http.Cookie{Name: "__Secure-csrf", Path: "/", SameSite: http.SameSiteLaxMode, Secure: true},
+		},
+		{
+			template: http.Cookie{Name: "csrf", Path: "/app", SameSite: http.SameSiteStrictMode, HttpOnly: true},
+			tls:      true,
+			want:     http.Cookie{Name: "csrf", Path: "/app", SameSite: http.SameSiteStrictMode, HttpOnly: true, Secure: true},
+		},
+		{
+			template: http.Cookie{Name: "__Host-csrf", Path: "/app", Domain: "example.com"},
+			want:     http.Cookie{Name: "__Host-csrf", Path: "/", SameSite: http.SameSiteLaxMode, Secure: true},
+		},
+		{
+			template: http.Cookie{Name: "__Secure-csrf", Domain: "example.com"},
+			want:     http.Cookie{Name: "__Secure-csrf", Path: "/", Domain: "example.com", SameSite: http.SameSiteLaxMode, Secure: true},
+		},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.tls {
+			req = httptest.NewRequest("GET", "https://example.com/", nil)
+		}
+
+		tw := ToCookieWith(tc.template)
+		if tc.insecure {
+			tw = ToInsecureCookieWith(tc.template)
+		}
+
+		res := httptest.NewRecorder()
+		tw.WriteToken(res, req, "woo")
+
+		want := tc.want
+		want.Value = "woo"
+		if got := res.Result().Cookies()[0]; got.Name != want.Name || got.Value != want.Value ||
+			got.Path != want.Path || got.Domain != want.Domain || got.SameSite != want.SameSite ||
+			got.Secure != want.Secure || got.HttpOnly != want.HttpOnly {
+			t.Errorf("Cookie was %v, but expected %v", got, &want)
+		}
+	}
+}